@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Assertion is a property of the graph of a diagram, stated with
+//
+//	(assert :acyclic :single-root :max-depth 6 :reaches "done")
+//
+// and checked by the validator, so that a diagram can double as the
+// specification of what it shows
+type Assertion struct {
+	// Name is the assertion, such as "acyclic" or "max-depth"
+	Name string
+
+	// Limit bounds max-depth and max-out-degree, and Node names the node
+	// or group every node must reach for reaches
+	Limit int
+	Node  string
+
+	Span Span
+}
+
+// assertionArguments lists the assertions with the kind of argument they
+// take, if any
+var assertionArguments = map[string]string{
+	"acyclic":            "",
+	"connected":          "",
+	"weakly-connected":   "",
+	"strongly-connected": "",
+	"single-root":        "",
+	"max-depth":          "limit",
+	"max-out-degree":     "limit",
+	"reaches":            "node",
+}
+
+func (a Assertion) String() string {
+	switch assertionArguments[a.Name] {
+	case "limit":
+		return fmt.Sprintf("assert :%s %d", a.Name, a.Limit)
+	case "node":
+		return fmt.Sprintf("assert :%s '%s'", a.Name, a.Node)
+	}
+	return "assert :" + a.Name
+}
+
+// interpretAssert handles (assert :acyclic :max-depth 6 ...): keywords
+// naming assertions, followed by the limit or node of those that take one
+func interpretAssert(in *Interpreter, diagram *Diagram, form Value) error {
+	for i := 1; i < len(form.List); i++ {
+		key := form.List[i]
+		if key.Kind != ValueKeyword {
+			in.report(newSourceError(key.Span, "expected assertion, got %s", key.describe()))
+			continue
+		}
+		argument, ok := assertionArguments[key.Text]
+		if !ok {
+			in.report(newSourceError(key.Span, "unknown assertion: :%s", key.Text))
+			continue
+		}
+
+		assertion := Assertion{Name: key.Text, Span: key.Span}
+		if argument != "" {
+			if i+1 >= len(form.List) || form.List[i+1].Kind == ValueKeyword {
+				in.report(newSourceError(elementSpan(form, i+1), "expected %s, got %s", argument, describeElement(form, i+1)))
+				continue
+			}
+			i++
+			value := form.List[i]
+			assertion.Span.End = value.Span.End
+
+			var err error
+			if argument == "limit" {
+				var n int64
+				n, err = value.AsInt()
+				if err == nil && n < 0 {
+					err = fmt.Errorf("expected a limit of 0 or more, got %d", n)
+				}
+				assertion.Limit = int(n)
+			} else {
+				assertion.Node, err = value.AsString()
+			}
+			if err != nil {
+				in.report(newSourceError(value.Span, "invalid :%s: %v", key.Text, err))
+				continue
+			}
+		}
+		diagram.Assertions = append(diagram.Assertions, assertion)
+	}
+	return nil
+}
+
+// validateAssertions checks the (assert ...) forms of a diagram against
+// its graph. Edges to undeclared IDs are left to validateEdgeReferences,
+// and an edge to a group counts as an edge to each of its members.
+func (v *Validator) validateAssertions(diagram *Diagram) {
+	if len(diagram.Assertions) == 0 {
+		return
+	}
+
+	g := newDiagramGraph(diagram)
+	nodeSpans := make(map[string]Span)
+	for _, node := range diagram.Nodes {
+		if _, ok := nodeSpans[node.ID]; !ok {
+			nodeSpans[node.ID] = node.Span
+		}
+	}
+	edgeSpan := func(e graphEdge) Span {
+		return diagram.Edges[e.index].Span
+	}
+
+	for _, a := range diagram.Assertions {
+		switch a.Name {
+		case "acyclic":
+			for _, cycle := range g.allCycles() {
+				var related []RelatedLocation
+				for _, e := range cycle[1:] {
+					related = append(related, RelatedLocation{Span: edgeSpan(e), Message: fmt.Sprintf("%s -> %s", e.from, e.to)})
+				}
+				v.assertionFailed(a, edgeSpan(cycle[0]), related, "cycle %s", pathString(cycle))
+			}
+
+		case "connected", "weakly-connected", "strongly-connected":
+			if len(g.nodes) == 0 {
+				continue
+			}
+			first := g.nodes[0]
+			if a.Name != "strongly-connected" || diagram.Options.Undirected {
+				joined := g.connected(first)
+				v.assertionFailedAt(a, nodeSpans, g.nodes, func(id string) string {
+					if joined[id] {
+						return ""
+					}
+					return fmt.Sprintf("'%s' is not connected to '%s'", id, first)
+				})
+				continue
+			}
+			from, to := g.reachable([]string{first}), g.reaching([]string{first})
+			v.assertionFailedAt(a, nodeSpans, g.nodes, func(id string) string {
+				switch {
+				case !from[id]:
+					return fmt.Sprintf("no path from '%s' to '%s'", first, id)
+				case !to[id]:
+					return fmt.Sprintf("no path from '%s' to '%s'", id, first)
+				}
+				return ""
+			})
+
+		case "single-root":
+			roots := g.roots()
+			switch {
+			case len(roots) == 0 && len(g.nodes) > 0:
+				v.assertionFailed(a, a.Span, nil, "no root: every node has an incoming edge")
+			case len(roots) > 1:
+				var related []RelatedLocation
+				for _, id := range roots[1:] {
+					related = append(related, RelatedLocation{Span: nodeSpans[id], Message: fmt.Sprintf("root '%s'", id)})
+				}
+				v.assertionFailed(a, nodeSpans[roots[0]], related, "%d roots: %s", len(roots), strings.Join(roots, ", "))
+			}
+
+		case "max-depth":
+			path, component := g.longestPath()
+			if len(path) > a.Limit {
+				v.assertionFailed(a, edgeSpan(path[a.Limit]), nil, "path of depth %d: %s", len(path), componentPathString(path, component))
+			}
+
+		case "max-out-degree":
+			for _, id := range g.nodes {
+				edges := make(map[int]bool)
+				for _, e := range g.out[id] {
+					edges[e.index] = true
+				}
+				if len(edges) > a.Limit {
+					v.assertionFailed(a, nodeSpans[id], nil, "node '%s' has %d outgoing edges", id, len(edges))
+				}
+			}
+
+		case "reaches":
+			targets, ok := g.members[a.Node]
+			if !ok {
+				v.errors = append(v.errors, ValidatorError{
+					Code:    CodeInvalidAssertion,
+					Message: fmt.Sprintf("%s: unknown node '%s'", a, a.Node),
+					Span:    a.Span,
+				})
+				continue
+			}
+			reached := g.reaching(targets)
+			v.assertionFailedAt(a, nodeSpans, g.nodes, func(id string) string {
+				if reached[id] {
+					return ""
+				}
+				return fmt.Sprintf("no path from '%s' to '%s'", id, a.Node)
+			})
+		}
+	}
+}
+
+// assertionFailed records a violated assertion at span, the place that
+// breaks it, with a note pointing at the assertion
+func (v *Validator) assertionFailed(a Assertion, span Span, related []RelatedLocation, format string, args ...interface{}) {
+	if !span.IsValid() {
+		span = a.Span
+	}
+	if a.Span.IsValid() {
+		related = append(related, RelatedLocation{Span: a.Span, Message: "asserted here"})
+	}
+	v.errors = append(v.errors, ValidatorError{
+		Code:    CodeAssertionFailed,
+		Message: fmt.Sprintf("%s: %s", a, fmt.Sprintf(format, args...)),
+		Span:    span,
+		Related: related,
+	})
+}
+
+// assertionFailedAt records a violated assertion at the first of ids for
+// which problem returns a message, counting the others
+func (v *Validator) assertionFailedAt(a Assertion, nodeSpans map[string]Span, ids []string, problem func(id string) string) {
+	var failing []string
+	var message string
+	for _, id := range ids {
+		if m := problem(id); m != "" {
+			if message == "" {
+				message = m
+			}
+			failing = append(failing, id)
+		}
+	}
+	switch len(failing) {
+	case 0:
+	case 1:
+		v.assertionFailed(a, nodeSpans[failing[0]], nil, "%s", message)
+	case 2:
+		v.assertionFailed(a, nodeSpans[failing[0]], nil, "%s (and 1 other node)", message)
+	default:
+		v.assertionFailed(a, nodeSpans[failing[0]], nil, "%s (and %d other nodes)", message, len(failing)-1)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// assertionErrors validates input and returns the messages of its errors
+func assertionErrors(t *testing.T, input string) []string {
+	t.Helper()
+	validator := NewValidator()
+	validator.Validate(ParseTestInput(t, input))
+	var messages []string
+	for _, err := range validator.GetErrors() {
+		messages = append(messages, err.Message)
+	}
+	return messages
+}
+
+// TestAssertions tests each assertion on a diagram that holds and one
+// that breaks it
+func TestAssertions(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{"acyclic", `(diagram (assert :acyclic) (nodes (id "A") (id "B")) (edges ("A" "B")))`, nil},
+		{
+			"cycle",
+			`(diagram (assert :acyclic) (nodes (id "A") (id "B") (id "C")) (edges ("A" "B") ("B" "C") ("C" "A") ("C" "C")))`,
+			[]string{"assert :acyclic: cycle C -> C", "assert :acyclic: cycle A -> B -> C -> A"},
+		},
+		{"connected", `(diagram (assert :connected) (nodes (id "A") (id "B") (id "C")) (edges ("A" "B") ("C" "B")))`, nil},
+		{
+			"strongly connected",
+			`(diagram (assert :strongly-connected) (nodes (id "A") (id "B")) (edges ("A" "B") ("B" "A")))`,
+			nil,
+		},
+		{
+			"not strongly connected",
+			`(diagram (assert :strongly-connected) (nodes (id "A") (id "B") (id "C")) (edges ("A" "B") ("C" "A")))`,
+			[]string{"assert :strongly-connected: no path from 'B' to 'A' (and 1 other node)"},
+		},
+		{
+			"undirected strongly connected",
+			`(diagram (options :directed false) (assert :strongly-connected) (nodes (id "A") (id "B") (id "C")) (edges ("A" "B") ("C" "B")))`,
+			nil,
+		},
+		{
+			"weakly connected",
+			`(diagram (assert :weakly-connected) (nodes (id "A") (id "B") (id "C") (id "D")) (edges ("A" "B") ("C" "B")))`,
+			[]string{"assert :weakly-connected: 'D' is not connected to 'A'"},
+		},
+		{
+			"group members",
+			`(diagram (assert :weakly-connected) (group "g" (nodes (id "A") (id "B"))) (nodes (id "C")) (edges ("g" "C")))`,
+			nil,
+		},
+		{
+			"single root",
+			`(diagram (assert :single-root) (nodes (id "A") (id "B") (id "C")) (edges ("A" "C") ("B" "C")))`,
+			[]string{"assert :single-root: 2 roots: A, B"},
+		},
+		{
+			"no root",
+			`(diagram (assert :single-root) (nodes (id "A") (id "B")) (edges ("A" "B") ("B" "A")))`,
+			[]string{"assert :single-root: no root: every node has an incoming edge"},
+		},
+		{
+			"max depth",
+			`(diagram (assert :max-depth 2) (nodes (id "A") (id "B") (id "C") (id "D")) (edges ("A" "B") ("B" "C") ("A" "D") ("C" "D")))`,
+			[]string{"assert :max-depth 2: path of depth 3: A -> B -> C -> D"},
+		},
+		{
+			"max depth with cycle",
+			`(diagram (assert :max-depth 1) (nodes (id "A") (id "B") (id "C")) (edges ("A" "B") ("B" "C") ("C" "B")))`,
+			nil,
+		},
+		{
+			"max depth without roots",
+			`(diagram (assert :max-depth 0) (nodes (id "A") (id "B") (id "C")) (edges ("A" "B") ("B" "A") ("B" "C")))`,
+			[]string{"assert :max-depth 0: path of depth 1: {A, B} -> C"},
+		},
+		{
+			"max out-degree",
+			`(diagram (assert :max-out-degree 1) (nodes (id "A") (id "B") (id "C")) (edges ("A" "B") ("A" "C") ("B" "C")))`,
+			[]string{"assert :max-out-degree 1: node 'A' has 2 outgoing edges"},
+		},
+		{
+			"reaches",
+			`(diagram (assert :reaches "end") (nodes (id "A") (id "B") (id "end") (id "C")) (edges ("A" "B") ("B" "end") ("end" "C")))`,
+			[]string{"assert :reaches 'end': no path from 'C' to 'end'"},
+		},
+		{
+			"reaches group",
+			`(diagram (assert :reaches "done") (group "done" (nodes (id "ok") (id "failed"))) (nodes (id "A") (id "B")) (edges ("A" "ok")))`,
+			[]string{"assert :reaches 'done': no path from 'B' to 'done'"},
+		},
+		{
+			"back edge",
+			`(diagram (assert :acyclic :reaches "A") (nodes (id "A") (id "B") (id "C")) (edges ("A" "B" :dir back) ("A" "C") ("C" "B")))`,
+			[]string{"assert :acyclic: cycle A -> C -> B -> A"},
+		},
+		{
+			"edge without direction",
+			`(diagram (assert :acyclic :reaches "A") (nodes (id "A") (id "B")) (edges ("A" "B" :dir none)))`,
+			nil,
+		},
+		{
+			"edges without direction joining a cycle",
+			`(diagram (assert :acyclic) (nodes (id "A") (id "B") (id "C")) (edges ("A" "B" :dir none) ("A" "C") ("B" "C") ("C" "A" :dir both)))`,
+			[]string{"assert :acyclic: cycle A -> C -> A"},
+		},
+		{
+			"undirected tree",
+			`(diagram (options :directed false) (assert :acyclic :reaches "C" :max-depth 2) (nodes (id "A") (id "B") (id "C") (id "D")) (edges ("A" "B") ("B" "C") ("D" "B")))`,
+			nil,
+		},
+		{
+			"undirected cycle",
+			`(diagram (options :directed false) (assert :acyclic :max-depth 1) (nodes (id "A") (id "B") (id "C") (id "D")) (edges ("A" "B") ("B" "C") ("C" "A") ("C" "D")))`,
+			[]string{"assert :acyclic: cycle A -> B -> C -> A"},
+		},
+		{
+			"undirected depth",
+			`(diagram (options :directed false) (assert :max-depth 1) (nodes (id "A") (id "B") (id "C")) (edges ("A" "B") ("C" "B")))`,
+			[]string{"assert :max-depth 1: path of depth 2: A -> B -> C"},
+		},
+		{
+			"unknown node",
+			`(diagram (assert :reaches "end") (nodes (id "A")))`,
+			[]string{"assert :reaches 'end': unknown node 'end'"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := assertionErrors(t, tt.input)
+			if !reflect.DeepEqual(messages, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, messages)
+			}
+		})
+	}
+}
+
+// TestAssertMaxDepthEdgeOrder tests that the depth of a diagram with
+// cycles does not depend on the order of its edges
+func TestAssertMaxDepthEdgeOrder(t *testing.T) {
+	orders := []string{
+		`("a" "c") ("a" "b") ("b" "c") ("c" "b") ("c" "d")`,
+		`("a" "b") ("a" "c") ("b" "c") ("c" "b") ("c" "d")`,
+	}
+	for _, edges := range orders {
+		t.Run(edges, func(t *testing.T) {
+			for limit, expected := range map[int][]string{
+				2: nil,
+				1: {"assert :max-depth 1: path of depth 2: a -> {b, c} -> d"},
+			} {
+				input := fmt.Sprintf(`(diagram (assert :max-depth %d) (nodes (id "a") (id "b") (id "c") (id "d")) (edges %s))`, limit, edges)
+				if messages := assertionErrors(t, input); !reflect.DeepEqual(messages, expected) {
+					t.Errorf("max-depth %d: expected %q, got %q", limit, expected, messages)
+				}
+			}
+		})
+	}
+}
+
+// TestAssertionDiagnostic tests that a failed assertion points at what
+// breaks it and at the assertion
+func TestAssertionDiagnostic(t *testing.T) {
+	input := "(assert :acyclic)\n(diagram\n  (nodes (id \"A\") (id \"B\"))\n  (edges\n    (\"A\" \"B\")\n    (\"B\" \"A\")))"
+	diagnostics := diagnosticsFor(t, input)
+	if len(diagnostics) != 1 {
+		t.Fatalf("Expected 1 diagnostic, got %v", diagnostics)
+	}
+
+	expected := `test.sxd:5:5: error[E017]: assert :acyclic: cycle A -> B -> A
+        ("A" "B")
+        ^
+test.sxd:6:5: note: B -> A
+        ("B" "A")))
+        ^
+test.sxd:1:9: note: asserted here
+    (assert :acyclic)
+            ^`
+	if diagnostics[0].Error() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, diagnostics[0].Error())
+	}
+}
+
+// TestInterpreterAssertErrors tests malformed (assert ...) forms
+func TestInterpreterAssertErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"unknown", `(diagram (assert :tree))`, "1:18: unknown assertion: :tree"},
+		{"not a keyword", `(diagram (assert acyclic))`, "1:18: expected assertion, got acyclic"},
+		{"missing limit", `(diagram (assert :max-depth :acyclic))`, "1:29: expected limit, got :acyclic"},
+		{"bad limit", `(diagram (assert :max-depth "deep"))`, `1:29: invalid :max-depth: expected integer, got "deep"`},
+		{"negative limit", `(diagram (assert :max-out-degree -1))`, "1:34: invalid :max-out-degree: expected a limit of 0 or more, got -1"},
+		{"missing node", `(diagram (assert :reaches))`, "1:26: expected node, got )"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewParser(NewLexer(tt.input)).ParseDiagram()
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error containing '%s', got: %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
-	"fmt"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 // Diagram represents the root AST node
 type Diagram struct {
+	// Name is set by (diagram "name" ...) and selects the diagram in
+	// files holding several
+	Name string
+
 	Width           int
 	Height          int
 	LayoutDirection string
@@ -14,6 +19,49 @@ type Diagram struct {
 	EdgeStyle       map[string]string
 	Nodes           []Node
 	Edges           []Edge
+	Groups          []Group
+	Classes         []Class
+	Options         Options
+	Profiles        []Profile
+
+	// Title, Description and Meta describe the diagram for documentation
+	// tools; they are written to the SVG as <title>, <desc> and <metadata>.
+	// Meta holds (meta :key value ...) entries such as author and version.
+	Title       string
+	Description string
+	Meta        map[string]string
+
+	// TitlePosition shows the title in a band above ("top") or below
+	// ("bottom") the drawing; empty leaves it out of the picture
+	TitlePosition string
+
+	// Lint configures the rules of lisvg lint, set by (lint ...)
+	Lint LintConfig
+
+	// Assertions are the properties of the graph stated by (assert ...)
+	Assertions []Assertion
+
+	// Source locations of the node-style and edge-style entries
+	NodeStyleSpans map[string]Span
+	EdgeStyleSpans map[string]Span
+}
+
+// SetMeta sets a (meta ...) entry of the diagram
+func (d *Diagram) SetMeta(key, value string) {
+	if d.Meta == nil {
+		d.Meta = make(map[string]string)
+	}
+	d.Meta[key] = value
+}
+
+// Options holds the diagram-level settings of (options ...)
+type Options struct {
+	// ImplicitNodes creates nodes for edge endpoints that are not declared
+	ImplicitNodes bool
+
+	// Undirected is set by :directed false; edges then default to no
+	// arrowheads and do not impose an order when ranking
+	Undirected bool
 }
 
 // Node represents a diagram node
@@ -21,6 +69,17 @@ type Node struct {
 	ID         string
 	Label      string
 	Attributes map[string]string
+	Classes    []string
+
+	// Values holds the attributes as read, keeping numbers, booleans and
+	// lists typed. Attributes holds the same values as text.
+	Values map[string]Value
+
+	// Implicit is set on nodes created for undeclared edge endpoints
+	Implicit bool
+
+	Span      Span
+	AttrSpans map[string]Span
 }
 
 // Edge represents a diagram edge
@@ -29,12 +88,232 @@ type Edge struct {
 	To         string
 	Label      string
 	Attributes map[string]string
+	Classes    []string
+	Values     map[string]Value
+
+	// Ports the edge attaches to, from "id:port" endpoints or :from-port
+	// and :to-port; empty for the default side
+	FromPort string
+	ToPort   string
+
+	Span      Span
+	AttrSpans map[string]Span
+}
+
+// Group represents a labelled cluster of nodes. Member nodes are listed
+// by ID and also appear in Diagram.Nodes; groups may nest.
+type Group struct {
+	ID         string
+	Label      string
+	Attributes map[string]string
+	Values     map[string]Value
+	Nodes      []string
+	Groups     []Group
+
+	Span      Span
+	AttrSpans map[string]Span
+}
+
+// Class is a named set of attributes defined with defclass and applied
+// to nodes and edges with :class
+type Class struct {
+	Name       string
+	Attributes map[string]string
+	Values     map[string]Value
+
+	Span      Span
+	AttrSpans map[string]Span
+}
+
+// AttrSpan returns the source location of an attribute, falling back to
+// the location of the class definition
+func (c Class) AttrSpan(key string) Span {
+	if span, ok := c.AttrSpans[key]; ok {
+		return span
+	}
+	return c.Span
+}
+
+// FindClass returns the class with the given name
+func (d *Diagram) FindClass(name string) (Class, bool) {
+	for _, class := range d.Classes {
+		if class.Name == name {
+			return class, true
+		}
+	}
+	return Class{}, false
+}
+
+// NodeAttribute returns an attribute of node, taken from the node itself,
+// else from its classes, with later classes taking precedence, else from
+// node-style
+func (d *Diagram) NodeAttribute(node Node, key string) (string, bool) {
+	if value, ok := node.Attributes[key]; ok {
+		return value, true
+	}
+	if value, ok := d.classAttribute(node.Classes, key); ok {
+		return value, true
+	}
+	value, ok := d.NodeStyle[key]
+	return value, ok
+}
+
+// EdgeAttribute returns an attribute of edge, resolved like NodeAttribute
+// with edge-style last
+func (d *Diagram) EdgeAttribute(edge Edge, key string) (string, bool) {
+	if value, ok := edge.Attributes[key]; ok {
+		return value, true
+	}
+	if value, ok := d.classAttribute(edge.Classes, key); ok {
+		return value, true
+	}
+	value, ok := d.EdgeStyle[key]
+	return value, ok
+}
+
+// EdgeDir is the direction of an edge, set with :dir
+type EdgeDir string
+
+const (
+	DirForward EdgeDir = "forward"
+	DirBack    EdgeDir = "back"
+	DirBoth    EdgeDir = "both"
+	DirNone    EdgeDir = "none"
+)
+
+// isValidEdgeDir reports whether dir is a known :dir value
+func isValidEdgeDir(dir string) bool {
+	spec, _ := LookupAttribute("dir")
+	return spec.Allows(dir)
+}
+
+// EdgeDirection returns the direction of edge: its own or class :dir,
+// then edge-style, then forward for directed and none for undirected
+// diagrams. Invalid values are ignored here and reported by the validator.
+func (d *Diagram) EdgeDirection(edge Edge) EdgeDir {
+	if dir, ok := d.EdgeAttribute(edge, "dir"); ok && isValidEdgeDir(dir) {
+		return EdgeDir(dir)
+	}
+	if dir, ok := d.EdgeStyle["dir"]; ok && isValidEdgeDir(dir) {
+		return EdgeDir(dir)
+	}
+	if d.Options.Undirected {
+		return DirNone
+	}
+	return DirForward
+}
+
+func (d *Diagram) classAttribute(classes []string, key string) (string, bool) {
+	for i := len(classes) - 1; i >= 0; i-- {
+		if class, ok := d.FindClass(classes[i]); ok {
+			if value, ok := class.Attributes[key]; ok {
+				return value, true
+			}
+		}
+	}
+	return "", false
+}
+
+// AddImplicitNodes declares a node for every edge endpoint that names
+// neither a node nor a group, and returns the nodes it created. The new
+// nodes have no attributes of their own, so they take on node-style.
+func (d *Diagram) AddImplicitNodes() []Node {
+	known := make(map[string]bool)
+	for _, node := range d.Nodes {
+		known[node.ID] = true
+	}
+	for _, group := range d.AllGroups() {
+		known[group.ID] = true
+	}
+
+	var created []Node
+	for _, edge := range d.Edges {
+		for _, id := range []string{edge.From, edge.To} {
+			if id == "" || known[id] {
+				continue
+			}
+			known[id] = true
+			node := Node{
+				ID:         id,
+				Label:      id,
+				Attributes: make(map[string]string),
+				Values:     make(map[string]Value),
+				Span:       edge.Span,
+				AttrSpans:  make(map[string]Span),
+				Implicit:   true,
+			}
+			d.Nodes = append(d.Nodes, node)
+			created = append(created, node)
+		}
+	}
+	return created
+}
+
+// AllGroups returns every group of the diagram, parents before children
+func (d *Diagram) AllGroups() []Group {
+	var groups []Group
+	var walk func([]Group)
+	walk = func(list []Group) {
+		for _, group := range list {
+			groups = append(groups, group)
+			walk(group.Groups)
+		}
+	}
+	walk(d.Groups)
+	return groups
+}
+
+// FindGroup returns the group with the given ID, searching nested groups
+func (d *Diagram) FindGroup(id string) (Group, bool) {
+	for _, group := range d.AllGroups() {
+		if group.ID == id {
+			return group, true
+		}
+	}
+	return Group{}, false
+}
+
+// Members returns the IDs of all nodes in the group and its subgroups
+func (g Group) Members() []string {
+	members := append([]string{}, g.Nodes...)
+	for _, child := range g.Groups {
+		members = append(members, child.Members()...)
+	}
+	return members
+}
+
+// AttrSpan returns the source location of an attribute, falling back to
+// the location of the node itself
+func (n Node) AttrSpan(key string) Span {
+	if span, ok := n.AttrSpans[key]; ok {
+		return span
+	}
+	return n.Span
+}
+
+// AttrSpan returns the source location of an attribute, falling back to
+// the location of the group itself
+func (g Group) AttrSpan(key string) Span {
+	if span, ok := g.AttrSpans[key]; ok {
+		return span
+	}
+	return g.Span
+}
+
+// AttrSpan returns the source location of an attribute, falling back to
+// the location of the edge itself
+func (e Edge) AttrSpan(key string) Span {
+	if span, ok := e.AttrSpans[key]; ok {
+		return span
+	}
+	return e.Span
 }
 
 // Token represents a lexical token
 type Token struct {
 	Type  TokenType
 	Value string
+	Span  Span
 }
 
 type TokenType int
@@ -46,384 +325,441 @@ const (
 	TokenKeyword
 	TokenString
 	TokenEOF
+	TokenError
+	TokenComment
 )
 
 // Lexer tokenizes S-expressions
 type Lexer struct {
-	input string
-	pos   int
-	ch    byte
+	source *Source
+	input  string
+	pos    int
+	ch     byte
+	line   int
+	col    int
+	err    *SourceError
+
+	// KeepComments makes the lexer return comments as TokenComment
+	// instead of skipping them, for tools that rewrite source
+	KeepComments bool
 }
 
 func NewLexer(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewFileLexer("", input)
+}
+
+// NewFileLexer creates a lexer whose positions refer to the named file
+func NewFileLexer(filename, input string) *Lexer {
+	l := &Lexer{
+		source: NewSource(filename, input),
+		input:  input,
+		line:   1,
+	}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.col = 0
+	}
 	if l.pos >= len(l.input) {
 		l.ch = 0
 	} else {
 		l.ch = l.input[l.pos]
 	}
+	if utf8.RuneStart(l.ch) {
+		l.col++
+	}
 	l.pos++
 }
 
+// atEOF reports whether the lexer has consumed all input
+func (l *Lexer) atEOF() bool {
+	return l.pos > len(l.input)
+}
+
+// errorf records a lexical error to be returned with the current token
+func (l *Lexer) errorf(pos Pos, format string, args ...interface{}) {
+	if l.err == nil {
+		l.err = newSourceError(Span{Start: pos, End: l.position()}, format, args...)
+	}
+}
+
+// position returns the source position of the current character
+func (l *Lexer) position() Pos {
+	return Pos{
+		Source: l.source,
+		Offset: l.pos - 1,
+		Line:   l.line,
+		Column: l.col,
+	}
+}
+
+// Source returns the source the lexer reads from
+func (l *Lexer) Source() *Source {
+	return l.source
+}
+
 func (l *Lexer) skipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
 		l.readChar()
 	}
 }
 
+// rest returns the input from the current character on
+func (l *Lexer) rest() string {
+	if l.atEOF() {
+		return ""
+	}
+	return l.input[l.pos-1:]
+}
+
+// atComment reports whether a comment starts at the current character: a
+// ; line comment, a #| ... |# block comment or a #; datum comment
+func (l *Lexer) atComment() bool {
+	return l.ch == ';' || strings.HasPrefix(l.rest(), "#|") || strings.HasPrefix(l.rest(), "#;")
+}
+
+// skipComment skips the comment starting at the current character
 func (l *Lexer) skipComment() {
-	if l.ch == ';' {
+	switch {
+	case l.ch == ';':
 		// Skip until end of line
 		for l.ch != '\n' && l.ch != '\r' && l.ch != 0 {
 			l.readChar()
 		}
-	}
-}
-
-func (l *Lexer) readString() string {
-	position := l.pos
-	for l.ch != '"' && l.ch != 0 {
+	case strings.HasPrefix(l.rest(), "#|"):
+		l.skipBlockComment()
+	case strings.HasPrefix(l.rest(), "#;"):
+		start := l.position()
+		l.readChar()
 		l.readChar()
+		l.skipDatum(start)
 	}
-	return l.input[position-1 : l.pos-1]
 }
 
-func (l *Lexer) readAtom() string {
-	position := l.pos - 1
-	for l.ch != ' ' && l.ch != '\t' && l.ch != '\n' && l.ch != '\r' && l.ch != '(' && l.ch != ')' && l.ch != 0 {
+// skipBlockComment skips a #| ... |# comment, which may contain other
+// block comments
+func (l *Lexer) skipBlockComment() {
+	start := l.position()
+	depth := 0
+	for {
+		switch {
+		case l.atEOF():
+			l.errorf(start, "unterminated block comment: expected '|#' before end of input")
+			return
+		case strings.HasPrefix(l.rest(), "#|"):
+			depth++
+			l.readChar()
+		case strings.HasPrefix(l.rest(), "|#"):
+			depth--
+			l.readChar()
+			if depth == 0 {
+				l.readChar()
+				return
+			}
+		}
 		l.readChar()
 	}
-	return l.input[position : l.pos-1]
 }
 
-func (l *Lexer) NextToken() Token {
+// skipDatum skips the complete S-expression commented out by the #; at
+// start. Comments before it are skipped too, so #; #; a b skips a and b.
+func (l *Lexer) skipDatum(start Pos) {
+	depth := 0
 	for {
 		l.skipWhitespace()
-
-		// Skip comments
-		if l.ch == ';' {
+		if l.atComment() {
 			l.skipComment()
 			continue
 		}
-		break
-	}
+		switch l.ch {
+		case 0:
+			if depth > 0 {
+				l.errorf(start, "unterminated datum comment: expected ')' before end of input")
+			} else {
+				l.errorf(start, "expected an expression after '#;', got end of input")
+			}
+			return
+		case ')':
+			if depth == 0 {
+				l.errorf(start, "expected an expression after '#;', got ')'")
+				return
+			}
+		}
 
-	switch l.ch {
-	case '(':
-		l.readChar()
-		return Token{TokenLParen, "("}
-	case ')':
-		l.readChar()
-		return Token{TokenRParen, ")"}
-	case '"':
-		l.readChar()
-		value := l.readString()
-		l.readChar() // skip closing quote
-		return Token{TokenString, value}
-	case 0:
-		return Token{TokenEOF, ""}
-	default:
-		if l.ch == ':' {
-			l.readChar()
-			atom := l.readAtom()
-			return Token{TokenKeyword, atom}
+		tokenType, _ := l.scanToken(l.position())
+		switch tokenType {
+		case TokenLParen:
+			depth++
+		case TokenRParen:
+			depth--
+		}
+		if depth == 0 {
+			return
 		}
-		atom := l.readAtom()
-		return Token{TokenAtom, atom}
 	}
 }
 
-// Parser parses S-expressions into AST
-type Parser struct {
-	lexer *Lexer
-	cur   Token
-	peek  Token
-}
-
-func NewParser(lexer *Lexer) *Parser {
-	p := &Parser{lexer: lexer}
-	p.nextToken()
-	p.nextToken()
-	return p
-}
-
-func (p *Parser) nextToken() {
-	p.cur = p.peek
-	p.peek = p.lexer.NextToken()
-}
-
-func (p *Parser) ParseDiagram() (*Diagram, error) {
-	if p.cur.Type != TokenLParen {
-		return nil, fmt.Errorf("expected '(', got %s", p.cur.Value)
-	}
-	p.nextToken()
-
-	if p.cur.Type != TokenAtom || p.cur.Value != "diagram" {
-		return nil, fmt.Errorf("expected 'diagram', got %s", p.cur.Value)
-	}
-	p.nextToken()
-
-	diagram := &Diagram{
-		Width:           800,
-		Height:          400,
-		LayoutDirection: "top-to-bottom",
-		NodeStyle:       make(map[string]string),
-		EdgeStyle:       make(map[string]string),
-		Nodes:           []Node{},
-		Edges:           []Edge{},
-	}
-
-	for p.cur.Type != TokenRParen && p.cur.Type != TokenEOF {
-		if p.cur.Type != TokenLParen {
-			return nil, fmt.Errorf("expected '(', got %s", p.cur.Value)
+// readString reads a quoted string literal, starting after the opening
+// quote and stopping after the closing one. Backslash escapes are decoded:
+// \" \\ \n \t \r and \u{XXXX} for a Unicode code point.
+func (l *Lexer) readString(start Pos) string {
+	var sb strings.Builder
+	for {
+		if l.atEOF() {
+			l.errorf(start, "unterminated string literal")
+			return sb.String()
 		}
-		p.nextToken()
 
-		switch p.cur.Value {
-		case "size":
-			if err := p.parseSize(diagram); err != nil {
-				return nil, err
-			}
-		case "layout-direction":
-			if err := p.parseLayoutDirection(diagram); err != nil {
-				return nil, err
-			}
-		case "node-style":
-			if err := p.parseNodeStyle(diagram); err != nil {
-				return nil, err
-			}
-		case "edge-style":
-			if err := p.parseEdgeStyle(diagram); err != nil {
-				return nil, err
-			}
-		case "nodes":
-			if err := p.parseNodes(diagram); err != nil {
-				return nil, err
-			}
-		case "edges":
-			if err := p.parseEdges(diagram); err != nil {
-				return nil, err
-			}
+		switch l.ch {
+		case '"':
+			l.readChar()
+			return sb.String()
+		case '\\':
+			l.readEscape(&sb)
 		default:
-			return nil, fmt.Errorf("unknown directive: %s", p.cur.Value)
+			sb.WriteByte(l.ch)
+			l.readChar()
 		}
 	}
-
-	if p.cur.Type != TokenRParen {
-		return nil, fmt.Errorf("expected ')', got %s", p.cur.Value)
-	}
-
-	return diagram, nil
 }
 
-func (p *Parser) parseSize(diagram *Diagram) error {
-	p.nextToken() // consume 'size'
+// readEscape decodes a single backslash escape sequence into sb
+func (l *Lexer) readEscape(sb *strings.Builder) {
+	escapePos := l.position()
+	l.readChar() // consume backslash
 
-	if p.cur.Type != TokenAtom {
-		return fmt.Errorf("expected width, got %s", p.cur.Value)
-	}
-	width, err := strconv.Atoi(p.cur.Value)
-	if err != nil {
-		return fmt.Errorf("invalid width: %s", p.cur.Value)
-	}
-	diagram.Width = width
-	p.nextToken()
-
-	if p.cur.Type != TokenAtom {
-		return fmt.Errorf("expected height, got %s", p.cur.Value)
-	}
-	height, err := strconv.Atoi(p.cur.Value)
-	if err != nil {
-		return fmt.Errorf("invalid height: %s", p.cur.Value)
-	}
-	diagram.Height = height
-	p.nextToken()
-
-	if p.cur.Type != TokenRParen {
-		return fmt.Errorf("expected ')', got %s", p.cur.Value)
-	}
-	p.nextToken()
-	return nil
-}
-
-func (p *Parser) parseLayoutDirection(diagram *Diagram) error {
-	p.nextToken() // consume 'layout-direction'
-
-	if p.cur.Type != TokenString && p.cur.Type != TokenAtom {
-		return fmt.Errorf("expected layout direction, got %s", p.cur.Value)
-	}
-
-	direction := p.cur.Value
-	// Validate direction
-	switch direction {
-	case "top-to-bottom", "bottom-to-top", "left-to-right", "right-to-left":
-		diagram.LayoutDirection = direction
+	switch l.ch {
+	case '"':
+		sb.WriteByte('"')
+	case '\\':
+		sb.WriteByte('\\')
+	case 'n':
+		sb.WriteByte('\n')
+	case 't':
+		sb.WriteByte('\t')
+	case 'r':
+		sb.WriteByte('\r')
+	case 'u':
+		l.readChar()
+		if l.ch != '{' {
+			l.errorf(escapePos, "invalid unicode escape: expected '{' after \\u")
+			return
+		}
+		l.readChar()
+		digits := l.pos - 1
+		for isHexDigit(l.ch) {
+			l.readChar()
+		}
+		hex := l.input[digits : l.pos-1]
+		if l.ch != '}' {
+			l.errorf(escapePos, "invalid unicode escape: expected '}' after \\u{%s", hex)
+			return
+		}
+		code, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil || len(hex) > 6 || !utf8.ValidRune(rune(code)) {
+			l.errorf(escapePos, "invalid unicode escape: \\u{%s} is not a valid code point", hex)
+		} else {
+			sb.WriteRune(rune(code))
+		}
 	default:
-		return fmt.Errorf("invalid layout direction: %s", direction)
-	}
-
-	p.nextToken()
-
-	if p.cur.Type != TokenRParen {
-		return fmt.Errorf("expected ')', got %s", p.cur.Value)
+		if l.atEOF() {
+			return // reported as an unterminated string
+		}
+		r, _ := utf8.DecodeRuneInString(l.input[l.pos-1:])
+		l.errorf(escapePos, "invalid escape sequence: \\%c", r)
+		return
 	}
-	p.nextToken()
-	return nil
+	l.readChar()
 }
 
-func (p *Parser) parseNodeStyle(diagram *Diagram) error {
-	p.nextToken() // consume 'node-style'
-
-	for p.cur.Type != TokenRParen {
-		if p.cur.Type != TokenKeyword {
-			return fmt.Errorf("expected keyword, got %s", p.cur.Value)
+// readRawString reads a triple-quoted string, starting after the opening
+// delimiter. No escapes are processed. A line break directly after the
+// opening delimiter is dropped, as is a closing line containing only
+// indentation, and the indentation common to all lines is removed so long
+// labels can be indented along with the surrounding code.
+func (l *Lexer) readRawString(start Pos) string {
+	content := l.pos - 1
+	for {
+		if l.atEOF() {
+			l.errorf(start, "unterminated raw string literal")
+			return l.input[content:]
 		}
-		key := p.cur.Value
-		p.nextToken()
-
-		if p.cur.Type != TokenString && p.cur.Type != TokenAtom {
-			return fmt.Errorf("expected value, got %s", p.cur.Value)
+		if strings.HasPrefix(l.input[l.pos-1:], `"""`) {
+			value := l.input[content : l.pos-1]
+			l.readChar()
+			l.readChar()
+			l.readChar()
+			return dedentRawString(value)
 		}
-		value := p.cur.Value
-		diagram.NodeStyle[key] = value
-		p.nextToken()
+		l.readChar()
 	}
-	p.nextToken() // consume ')'
-	return nil
 }
 
-func (p *Parser) parseEdgeStyle(diagram *Diagram) error {
-	p.nextToken() // consume 'edge-style'
+// dedentRawString trims the delimiter lines of a raw string and removes
+// the indentation shared by its non-blank lines
+func dedentRawString(value string) string {
+	value = strings.ReplaceAll(value, "\r\n", "\n")
+	value = strings.TrimPrefix(value, "\n")
+
+	lines := strings.Split(value, "\n")
+	if last := lines[len(lines)-1]; len(lines) > 1 && strings.TrimLeft(last, " \t") == "" {
+		lines = lines[:len(lines)-1]
+	}
 
-	for p.cur.Type != TokenRParen {
-		if p.cur.Type != TokenKeyword {
-			return fmt.Errorf("expected keyword, got %s", p.cur.Value)
+	indent := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		width := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent < 0 || width < indent {
+			indent = width
 		}
-		key := p.cur.Value
-		p.nextToken()
+	}
 
-		if p.cur.Type != TokenString && p.cur.Type != TokenAtom {
-			return fmt.Errorf("expected value, got %s", p.cur.Value)
+	for i, line := range lines {
+		if len(line) >= indent && indent > 0 {
+			lines[i] = line[indent:]
+		} else if strings.TrimSpace(line) == "" {
+			lines[i] = ""
 		}
-		value := p.cur.Value
-		diagram.EdgeStyle[key] = value
-		p.nextToken()
 	}
-	p.nextToken() // consume ')'
-	return nil
+	return strings.Join(lines, "\n")
 }
 
-func (p *Parser) parseNodes(diagram *Diagram) error {
-	p.nextToken() // consume 'nodes'
+func isHexDigit(ch byte) bool {
+	return ('0' <= ch && ch <= '9') || ('a' <= ch && ch <= 'f') || ('A' <= ch && ch <= 'F')
+}
 
-	for p.cur.Type != TokenRParen {
-		if p.cur.Type != TokenLParen {
-			return fmt.Errorf("expected '(', got %s", p.cur.Value)
-		}
-		p.nextToken()
+func (l *Lexer) readAtom() string {
+	position := l.pos - 1
+	for l.ch != ' ' && l.ch != '\t' && l.ch != '\n' && l.ch != '\r' && l.ch != '(' && l.ch != ')' && l.ch != 0 {
+		l.readChar()
+	}
+	return l.input[position : l.pos-1]
+}
 
-		if p.cur.Type != TokenAtom || p.cur.Value != "id" {
-			return fmt.Errorf("expected 'id', got %s", p.cur.Value)
+func (l *Lexer) NextToken() Token {
+	for {
+		l.skipWhitespace()
+		if !l.atComment() {
+			break
 		}
-		p.nextToken()
 
-		if p.cur.Type != TokenString && p.cur.Type != TokenAtom {
-			return fmt.Errorf("expected node id, got %s", p.cur.Value)
+		start := l.position()
+		l.skipComment()
+		if l.KeepComments {
+			return l.checkError(Token{
+				Type:  TokenComment,
+				Value: strings.TrimRight(l.input[start.Offset:l.pos-1], " \t"),
+				Span:  Span{Start: start, End: l.position()},
+			})
 		}
-		nodeID := p.cur.Value
-		p.nextToken()
-
-		node := Node{
-			ID:         nodeID,
-			Label:      nodeID,
-			Attributes: make(map[string]string),
+		if l.err != nil {
+			return l.checkError(Token{})
 		}
+	}
 
-		// Parse attributes
-		for p.cur.Type != TokenRParen {
-			if p.cur.Type != TokenKeyword {
-				return fmt.Errorf("expected keyword, got %s", p.cur.Value)
-			}
-			key := p.cur.Value
-			p.nextToken()
-
-			if p.cur.Type != TokenString && p.cur.Type != TokenAtom {
-				return fmt.Errorf("expected value, got %s", p.cur.Value)
-			}
-			value := p.cur.Value
-
-			if key == "label" {
-				node.Label = value
-			} else {
-				node.Attributes[key] = value
-			}
-			p.nextToken()
-		}
+	start := l.position()
+	tokenType, value := l.scanToken(start)
+	return l.checkError(Token{
+		Type:  tokenType,
+		Value: value,
+		Span:  Span{Start: start, End: l.position()},
+	})
+}
 
-		diagram.Nodes = append(diagram.Nodes, node)
-		p.nextToken() // consume ')'
+// checkError replaces token with an error token if a lexical error was
+// recorded while reading it
+func (l *Lexer) checkError(token Token) Token {
+	if l.err != nil {
+		token = Token{Type: TokenError, Value: l.err.Message, Span: l.err.Span}
+		l.err = nil
 	}
-	p.nextToken() // consume ')'
-	return nil
+	return token
 }
 
-func (p *Parser) parseEdges(diagram *Diagram) error {
-	p.nextToken() // consume 'edges'
-
-	for p.cur.Type != TokenRParen {
-		if p.cur.Type != TokenLParen {
-			return fmt.Errorf("expected '(', got %s", p.cur.Value)
+func (l *Lexer) scanToken(start Pos) (TokenType, string) {
+	switch l.ch {
+	case '(':
+		l.readChar()
+		return TokenLParen, "("
+	case ')':
+		l.readChar()
+		return TokenRParen, ")"
+	case '"':
+		if strings.HasPrefix(l.input[l.pos-1:], `"""`) {
+			l.readChar()
+			l.readChar()
+			l.readChar()
+			return TokenString, l.readRawString(start)
 		}
-		p.nextToken()
-
-		if p.cur.Type != TokenString && p.cur.Type != TokenAtom {
-			return fmt.Errorf("expected from node, got %s", p.cur.Value)
+		l.readChar()
+		return TokenString, l.readString(start)
+	case 0:
+		return TokenEOF, ""
+	default:
+		if l.ch == ':' {
+			l.readChar()
+			atom := l.readAtom()
+			return TokenKeyword, atom
 		}
-		from := p.cur.Value
-		p.nextToken()
+		atom := l.readAtom()
+		return TokenAtom, atom
+	}
+}
 
-		if p.cur.Type != TokenString && p.cur.Type != TokenAtom {
-			return fmt.Errorf("expected to node, got %s", p.cur.Value)
-		}
-		to := p.cur.Value
-		p.nextToken()
-
-		edge := Edge{
-			From:       from,
-			To:         to,
-			Label:      "",
-			Attributes: make(map[string]string),
-		}
+// Parser parses S-expressions into AST. It reads forms with a Reader and
+// hands them to an Interpreter.
+type Parser struct {
+	reader      *Reader
+	interpreter *Interpreter
+}
 
-		// Parse attributes
-		for p.cur.Type != TokenRParen {
-			if p.cur.Type != TokenKeyword {
-				return fmt.Errorf("expected keyword, got %s", p.cur.Value)
-			}
-			key := p.cur.Value
-			p.nextToken()
+func NewParser(lexer *Lexer) *Parser {
+	return &Parser{
+		reader:      NewReader(lexer),
+		interpreter: NewInterpreter(),
+	}
+}
 
-			if p.cur.Type != TokenString && p.cur.Type != TokenAtom {
-				return fmt.Errorf("expected value, got %s", p.cur.Value)
-			}
-			value := p.cur.Value
+// SetEvaluator enables the evaluation stage: forms, including those of
+// included files, are evaluated by ev before they are interpreted
+func (p *Parser) SetEvaluator(ev *Evaluator) {
+	p.interpreter.Evaluator = ev
+}
 
-			if key == "label" {
-				edge.Label = value
-			} else {
-				edge.Attributes[key] = value
-			}
-			p.nextToken()
-		}
+// ParseDiagrams reads the rest of the input and interprets it as the
+// diagrams of a file. Parsing recovers from syntax errors, so the returned
+// error is an ErrorList with every problem found; the diagrams hold
+// whatever could be recovered.
+func (p *Parser) ParseDiagrams() ([]*Diagram, error) {
+	var errors ErrorList
+
+	forms, _ := p.reader.ReadAll()
+	if len(forms) == 0 {
+		errors.Add(p.reader.Err())
+		errors.Add(newSourceError(p.reader.Span(), "expected '(', got end of input"))
+		return nil, errors
+	}
+
+	diagrams, err := p.interpreter.InterpretFile(forms)
+	errors.Add(p.reader.Err())
+	errors.Add(err)
+	errors.Sort()
+	return diagrams, errors.Err()
+}
 
-		diagram.Edges = append(diagram.Edges, edge)
-		p.nextToken() // consume ')'
+// ParseDiagram parses the input like ParseDiagrams and returns its first
+// diagram
+func (p *Parser) ParseDiagram() (*Diagram, error) {
+	diagrams, err := p.ParseDiagrams()
+	if len(diagrams) == 0 {
+		return nil, err
 	}
-	p.nextToken() // consume ')'
-	return nil
+	return diagrams[0], err
 }
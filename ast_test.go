@@ -17,66 +17,66 @@ func TestLexer(t *testing.T) {
 			name:  "basic tokens",
 			input: "( ) atom :keyword \"string\"",
 			expected: []Token{
-				{TokenLParen, "("},
-				{TokenRParen, ")"},
-				{TokenAtom, "atom"},
-				{TokenKeyword, "keyword"},
-				{TokenString, "string"},
-				{TokenEOF, ""},
+				{Type: TokenLParen, Value: "("},
+				{Type: TokenRParen, Value: ")"},
+				{Type: TokenAtom, Value: "atom"},
+				{Type: TokenKeyword, Value: "keyword"},
+				{Type: TokenString, Value: "string"},
+				{Type: TokenEOF, Value: ""},
 			},
 		},
 		{
 			name:  "empty input",
 			input: "",
 			expected: []Token{
-				{TokenEOF, ""},
+				{Type: TokenEOF, Value: ""},
 			},
 		},
 		{
 			name:  "whitespace handling",
 			input: "  (  \t\n  )  ",
 			expected: []Token{
-				{TokenLParen, "("},
-				{TokenRParen, ")"},
-				{TokenEOF, ""},
+				{Type: TokenLParen, Value: "("},
+				{Type: TokenRParen, Value: ")"},
+				{Type: TokenEOF, Value: ""},
 			},
 		},
 		{
 			name:  "comment handling",
 			input: "; this is a comment\n( atom ); another comment\n",
 			expected: []Token{
-				{TokenLParen, "("},
-				{TokenAtom, "atom"},
-				{TokenRParen, ")"},
-				{TokenEOF, ""},
+				{Type: TokenLParen, Value: "("},
+				{Type: TokenAtom, Value: "atom"},
+				{Type: TokenRParen, Value: ")"},
+				{Type: TokenEOF, Value: ""},
 			},
 		},
 		{
 			name:  "string with spaces",
 			input: "\"hello world\"",
 			expected: []Token{
-				{TokenString, "hello world"},
-				{TokenEOF, ""},
+				{Type: TokenString, Value: "hello world"},
+				{Type: TokenEOF, Value: ""},
 			},
 		},
 		{
 			name:  "complex atoms",
 			input: "node-style edge-style123 abc_def",
 			expected: []Token{
-				{TokenAtom, "node-style"},
-				{TokenAtom, "edge-style123"},
-				{TokenAtom, "abc_def"},
-				{TokenEOF, ""},
+				{Type: TokenAtom, Value: "node-style"},
+				{Type: TokenAtom, Value: "edge-style123"},
+				{Type: TokenAtom, Value: "abc_def"},
+				{Type: TokenEOF, Value: ""},
 			},
 		},
 		{
 			name:  "multiple keywords",
 			input: ":shape :label :stroke",
 			expected: []Token{
-				{TokenKeyword, "shape"},
-				{TokenKeyword, "label"},
-				{TokenKeyword, "stroke"},
-				{TokenEOF, ""},
+				{Type: TokenKeyword, Value: "shape"},
+				{Type: TokenKeyword, Value: "label"},
+				{Type: TokenKeyword, Value: "stroke"},
+				{Type: TokenEOF, Value: ""},
 			},
 		},
 	}
@@ -88,6 +88,7 @@ func TestLexer(t *testing.T) {
 
 			for {
 				token := lexer.NextToken()
+				token.Span = Span{}
 				tokens = append(tokens, token)
 				if token.Type == TokenEOF {
 					break
@@ -113,11 +114,17 @@ func TestLexerEdgeCases(t *testing.T) {
 			input: "\"unclosed string",
 			check: func(t *testing.T, lexer *Lexer) {
 				token := lexer.NextToken()
-				if token.Type != TokenString {
-					t.Errorf("Expected TokenString, got %v", token.Type)
+				if token.Type != TokenError {
+					t.Errorf("Expected TokenError, got %v", token.Type)
 				}
-				if token.Value != "unclosed string" {
-					t.Errorf("Expected 'unclosed string', got '%s'", token.Value)
+				if token.Value != "unterminated string literal" {
+					t.Errorf("Expected 'unterminated string literal', got '%s'", token.Value)
+				}
+				if token.Span.Start.Column != 1 {
+					t.Errorf("Expected error at opening quote, got column %d", token.Span.Start.Column)
+				}
+				if next := lexer.NextToken(); next.Type != TokenEOF {
+					t.Errorf("Expected TokenEOF after unterminated string, got %+v", next)
 				}
 			},
 		},
@@ -154,6 +161,278 @@ func TestLexerEdgeCases(t *testing.T) {
 	}
 }
 
+// TestLexerStringLiterals tests escape sequences and raw strings
+func TestLexerStringLiterals(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"escaped quote", `"say \"hi\""`, `say "hi"`},
+		{"escaped backslash", `"C:\\path"`, `C:\path`},
+		{"newline and tab", `"a\nb\tc"`, "a\nb\tc"},
+		{"unicode escape", `"\u{3042}\u{1F30D}"`, "あ🌍"},
+		{"literal newline", "\"line1\nline2\"", "line1\nline2"},
+		{"raw string", `"""no \n escapes "here" """`, `no \n escapes "here" `},
+		{
+			name:     "raw multi-line string",
+			input:    "\"\"\"\n      First line\n        indented\n      Last line\n      \"\"\"",
+			expected: "First line\n  indented\nLast line",
+		},
+		{"empty raw string", `""""""`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lexer := NewLexer(tt.input)
+			token := lexer.NextToken()
+			if token.Type != TokenString {
+				t.Fatalf("Expected TokenString, got %+v", token)
+			}
+			if token.Value != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, token.Value)
+			}
+			if next := lexer.NextToken(); next.Type != TokenEOF {
+				t.Errorf("Expected TokenEOF, got %+v", next)
+			}
+		})
+	}
+}
+
+// TestLexerStringErrors tests lexical errors in string literals
+func TestLexerStringErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		message string
+		column  int
+	}{
+		{"invalid escape", `(id "a\qb")`, `invalid escape sequence: \q`, 7},
+		{"unicode without braces", `"\u0041"`, `expected '{' after \u`, 2},
+		{"unterminated unicode", `"\u{41"`, `expected '}' after \u{41`, 2},
+		{"invalid code point", `"\u{110000}"`, `\u{110000} is not a valid code point`, 2},
+		{"empty code point", `"\u{}"`, `\u{} is not a valid code point`, 2},
+		{"unterminated raw string", `x """never closed`, "unterminated raw string literal", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lexer := NewLexer(tt.input)
+			var errToken *Token
+			for {
+				token := lexer.NextToken()
+				if token.Type == TokenError {
+					errToken = &token
+					break
+				}
+				if token.Type == TokenEOF {
+					break
+				}
+			}
+
+			if errToken == nil {
+				t.Fatalf("Expected a lexical error")
+			}
+			if !strings.Contains(errToken.Value, tt.message) {
+				t.Errorf("Expected error containing '%s', got '%s'", tt.message, errToken.Value)
+			}
+			if errToken.Span.Start.Column != tt.column {
+				t.Errorf("Expected error at column %d, got %d", tt.column, errToken.Span.Start.Column)
+			}
+		})
+	}
+}
+
+// TestParserStringErrors tests that lexical errors surface from the parser
+func TestParserStringErrors(t *testing.T) {
+	AssertParseError(t, `(diagram (nodes (id "A" :label "bad \x")))`, "invalid escape sequence")
+	AssertParseError(t, `(diagram (nodes (id "A" :label "open)))`, "1:32: unterminated string literal")
+}
+
+// TestLexerPositions tests that tokens record their source spans
+func TestLexerPositions(t *testing.T) {
+	lexer := NewFileLexer("pos.sxd", "(id\n  \"開始\" :label)")
+
+	expected := []struct {
+		value     string
+		line, col int
+		endCol    int
+	}{
+		{"(", 1, 1, 2},
+		{"id", 1, 2, 4},
+		{"開始", 2, 3, 7},
+		{"label", 2, 8, 14},
+		{")", 2, 14, 15},
+		{"", 2, 15, 15},
+	}
+
+	for _, exp := range expected {
+		token := lexer.NextToken()
+		if token.Value != exp.value {
+			t.Fatalf("Expected token '%s', got '%s'", exp.value, token.Value)
+		}
+		start := token.Span.Start
+		if start.Line != exp.line || start.Column != exp.col {
+			t.Errorf("Token '%s': expected start %d:%d, got %d:%d", exp.value, exp.line, exp.col, start.Line, start.Column)
+		}
+		if token.Span.End.Column != exp.endCol {
+			t.Errorf("Token '%s': expected end column %d, got %d", exp.value, exp.endCol, token.Span.End.Column)
+		}
+		if start.Filename() != "pos.sxd" {
+			t.Errorf("Token '%s': expected file pos.sxd, got %s", exp.value, start.Filename())
+		}
+	}
+}
+
+// TestLexerKeepComments tests that comments become tokens on request
+func TestLexerKeepComments(t *testing.T) {
+	lexer := NewLexer("(a ; note  \n b #| x |# #;(c d)) ;; end")
+	lexer.KeepComments = true
+
+	expected := []struct {
+		tokenType TokenType
+		value     string
+	}{
+		{TokenLParen, "("},
+		{TokenAtom, "a"},
+		{TokenComment, "; note"},
+		{TokenAtom, "b"},
+		{TokenComment, "#| x |#"},
+		{TokenComment, "#;(c d)"},
+		{TokenRParen, ")"},
+		{TokenComment, ";; end"},
+		{TokenEOF, ""},
+	}
+
+	for _, exp := range expected {
+		token := lexer.NextToken()
+		if token.Type != exp.tokenType || token.Value != exp.value {
+			t.Errorf("Expected token %d %q, got %d %q", exp.tokenType, exp.value, token.Type, token.Value)
+		}
+	}
+}
+
+// TestLexerBlockComments tests that #| |# and #; comments are skipped
+func TestLexerBlockComments(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{"block comment", "a #| skipped (b |# c", []string{"a", "c"}},
+		{"nested block comments", "a #| outer #| inner |# still outer |# c", []string{"a", "c"}},
+		{"multi-line block comment", "a #|\n(group \"g\"\n  (nodes))\n|#\nc", []string{"a", "c"}},
+		{"datum comment atom", "a #;b c", []string{"a", "c"}},
+		{"datum comment list", `(a #;(group "g" (nodes (id ")"))) c)`, []string{"(", "a", "c", ")"}},
+		{"datum comment after space and comment", "a #; ; note\n  (b) c", []string{"a", "c"}},
+		{"stacked datum comments", "#; #; a b c", []string{"c"}},
+		{"block comment in datum comment", "#; #| x |# (b) c", []string{"c"}},
+		{"colors are atoms", "#fff #|x|##000", []string{"#fff", "#000"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lexer := NewLexer(tt.input)
+			var values []string
+			for {
+				token := lexer.NextToken()
+				if token.Type == TokenError {
+					t.Fatalf("Unexpected error: %s", token.Value)
+				}
+				if token.Type == TokenEOF {
+					break
+				}
+				values = append(values, token.Value)
+			}
+			if strings.Join(values, " ") != strings.Join(tt.expected, " ") {
+				t.Errorf("Expected tokens %q, got %q", tt.expected, values)
+			}
+		})
+	}
+
+	// Positions after a comment are those of the source
+	lexer := NewLexer("#| one\ntwo |# #;(x\n y)\n  (id")
+	token := lexer.NextToken()
+	if token.Span.Start.Line != 4 || token.Span.Start.Column != 3 {
+		t.Errorf("Expected '(' at 4:3, got %d:%d", token.Span.Start.Line, token.Span.Start.Column)
+	}
+}
+
+// TestLexerCommentErrors tests errors for incomplete block and datum
+// comments
+func TestLexerCommentErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		message string
+		column  int
+	}{
+		{"unterminated block comment", "a #| never closed", "unterminated block comment: expected '|#' before end of input", 3},
+		{"unterminated nested block comment", "#| #| inner |# a", "unterminated block comment: expected '|#' before end of input", 1},
+		{"datum comment at end of input", "a #;", "expected an expression after '#;', got end of input", 3},
+		{"datum comment before ')'", "(a #; )", "expected an expression after '#;', got ')'", 4},
+		{"unclosed datum comment", "#;(a (b)", "unterminated datum comment: expected ')' before end of input", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lexer := NewLexer(tt.input)
+			var errToken *Token
+			for {
+				token := lexer.NextToken()
+				if token.Type == TokenError {
+					errToken = &token
+					break
+				}
+				if token.Type == TokenEOF {
+					break
+				}
+			}
+
+			if errToken == nil {
+				t.Fatalf("Expected a lexical error")
+			}
+			if errToken.Value != tt.message {
+				t.Errorf("Expected error '%s', got '%s'", tt.message, errToken.Value)
+			}
+			if errToken.Span.Start.Column != tt.column {
+				t.Errorf("Expected error at column %d, got %d", tt.column, errToken.Span.Start.Column)
+			}
+		})
+	}
+
+	AssertParseError(t, "(diagram\n  #| (nodes (id \"A\"))\n  (edges))", "2:3: unterminated block comment")
+	AssertParseError(t, "(diagram (nodes (id \"A\" #;)))", "1:25: expected an expression after '#;', got ')'")
+}
+
+// TestParserSpans tests that parsed nodes, edges and styles carry spans
+func TestParserSpans(t *testing.T) {
+	input := `(diagram
+  (node-style :shape "rect")
+  (nodes
+    (id "A" :shape "ellipse"))
+  (edges
+    ("A" "B" :style "dashed")))`
+
+	diagram := ParseTestInput(t, input)
+
+	if span := diagram.NodeStyleSpans["shape"]; span.Start.Line != 2 || span.Start.Column != 15 {
+		t.Errorf("Expected node-style shape at 2:15, got %s", span)
+	}
+	if span := diagram.Nodes[0].Span; span.Start.Line != 4 || span.Start.Column != 5 {
+		t.Errorf("Expected node at 4:5, got %s", span)
+	}
+	if span := diagram.Nodes[0].AttrSpan("shape"); span.Start.Line != 4 || span.Start.Column != 13 {
+		t.Errorf("Expected node shape at 4:13, got %s", span)
+	}
+	if span := diagram.Edges[0].Span; span.Start.Line != 6 || span.End.Column != 30 {
+		t.Errorf("Expected edge at line 6 ending at column 30, got %+v", span)
+	}
+	if span := diagram.Edges[0].AttrSpan("missing"); span != diagram.Edges[0].Span {
+		t.Errorf("Expected missing attribute to fall back to edge span")
+	}
+}
+
 // TestParser tests the parser functionality
 func TestParser(t *testing.T) {
 	tests := []struct {
@@ -295,6 +574,7 @@ func TestParser(t *testing.T) {
 				return
 			}
 
+			clearSpans(diagram)
 			if !reflect.DeepEqual(diagram, tt.expected) {
 				t.Errorf("Expected diagram %+v, got %+v", tt.expected, diagram)
 			}
@@ -302,6 +582,23 @@ func TestParser(t *testing.T) {
 	}
 }
 
+// clearSpans removes source locations and typed values so parsed diagrams
+// can be compared against literals
+func clearSpans(diagram *Diagram) {
+	diagram.NodeStyleSpans = nil
+	diagram.EdgeStyleSpans = nil
+	for i := range diagram.Nodes {
+		diagram.Nodes[i].Span = Span{}
+		diagram.Nodes[i].AttrSpans = nil
+		diagram.Nodes[i].Values = nil
+	}
+	for i := range diagram.Edges {
+		diagram.Edges[i].Span = Span{}
+		diagram.Edges[i].AttrSpans = nil
+		diagram.Edges[i].Values = nil
+	}
+}
+
 // TestParserErrors tests error handling in parser
 func TestParserErrors(t *testing.T) {
 	tests := []struct {
@@ -461,54 +758,53 @@ func TestLexerErrorCases(t *testing.T) {
 			name:  "keyword without colon",
 			input: "keyword",
 			expected: []Token{
-				{TokenAtom, "keyword"},
-				{TokenEOF, ""},
+				{Type: TokenAtom, Value: "keyword"},
+				{Type: TokenEOF, Value: ""},
 			},
 		},
 		{
 			name:  "escaped characters in string",
 			input: `"string with \"quotes\""`,
 			expected: []Token{
-				{TokenString, `string with \`},
-				{TokenAtom, `quotes\""`},
-				{TokenEOF, ""},
+				{Type: TokenString, Value: `string with "quotes"`},
+				{Type: TokenEOF, Value: ""},
 			},
 		},
 		{
 			name:  "numbers as atoms",
 			input: "123 456.789 -10",
 			expected: []Token{
-				{TokenAtom, "123"},
-				{TokenAtom, "456.789"},
-				{TokenAtom, "-10"},
-				{TokenEOF, ""},
+				{Type: TokenAtom, Value: "123"},
+				{Type: TokenAtom, Value: "456.789"},
+				{Type: TokenAtom, Value: "-10"},
+				{Type: TokenEOF, Value: ""},
 			},
 		},
 		{
 			name:  "mixed parentheses",
 			input: "((()))()",
 			expected: []Token{
-				{TokenLParen, "("},
-				{TokenLParen, "("},
-				{TokenLParen, "("},
-				{TokenRParen, ")"},
-				{TokenRParen, ")"},
-				{TokenRParen, ")"},
-				{TokenLParen, "("},
-				{TokenRParen, ")"},
-				{TokenEOF, ""},
+				{Type: TokenLParen, Value: "("},
+				{Type: TokenLParen, Value: "("},
+				{Type: TokenLParen, Value: "("},
+				{Type: TokenRParen, Value: ")"},
+				{Type: TokenRParen, Value: ")"},
+				{Type: TokenRParen, Value: ")"},
+				{Type: TokenLParen, Value: "("},
+				{Type: TokenRParen, Value: ")"},
+				{Type: TokenEOF, Value: ""},
 			},
 		},
 		{
 			name:  "unicode characters",
 			input: "(ñode 世界 🌍)",
 			expected: []Token{
-				{TokenLParen, "("},
-				{TokenAtom, "ñode"},
-				{TokenAtom, "世界"},
-				{TokenAtom, "🌍"},
-				{TokenRParen, ")"},
-				{TokenEOF, ""},
+				{Type: TokenLParen, Value: "("},
+				{Type: TokenAtom, Value: "ñode"},
+				{Type: TokenAtom, Value: "世界"},
+				{Type: TokenAtom, Value: "🌍"},
+				{Type: TokenRParen, Value: ")"},
+				{Type: TokenEOF, Value: ""},
 			},
 		},
 	}
@@ -520,6 +816,7 @@ func TestLexerErrorCases(t *testing.T) {
 
 			for {
 				token := lexer.NextToken()
+				token.Span = Span{}
 				tokens = append(tokens, token)
 				if token.Type == TokenEOF {
 					break
@@ -650,6 +947,84 @@ func TestParserRecovery(t *testing.T) {
 	})
 }
 
+// TestParserReportsAllErrors tests that the parser resynchronises after
+// each malformed form and reports every error in one run
+func TestParserReportsAllErrors(t *testing.T) {
+	input := `(diagram
+  (size wide 400)
+  (colour "red")
+  (nodes
+    (id "A" :label "ok")
+    (name "B")
+    (id "C" shape "rect" :label "C"))
+  (edges
+    ("A")
+    ("A" "C" :label)
+    ("A" "C" :style "\q")))`
+
+	parser := NewParser(NewFileLexer("many.sxd", input))
+	diagram, err := parser.ParseDiagram()
+	if err == nil {
+		t.Fatalf("Expected errors")
+	}
+
+	errors, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("Expected ErrorList, got %T", err)
+	}
+
+	expected := []string{
+		"many.sxd:2:9: invalid width: wide",
+		"many.sxd:3:4: unknown directive: colour",
+		"many.sxd:6:6: expected 'id', got name",
+		"many.sxd:7:13: expected keyword, got shape",
+		"many.sxd:9:9: expected to node, got )",
+		"many.sxd:10:20: expected value, got )",
+		"many.sxd:11:22: invalid escape sequence: \\q",
+	}
+	if len(errors) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d:\n%v", len(expected), len(errors), err)
+	}
+	for i, exp := range expected {
+		if !strings.HasPrefix(errors[i].Error(), exp) {
+			t.Errorf("Error %d: expected '%s', got '%s'", i, exp, errors[i].Error())
+		}
+	}
+	if !strings.HasPrefix(err.Error(), "7 errors:\n") {
+		t.Errorf("Expected error count header, got: %v", err)
+	}
+
+	// Well-formed parts are still available to tools such as editors
+	if diagram == nil {
+		t.Fatalf("Expected partial diagram")
+	}
+	if len(diagram.Nodes) != 2 || diagram.Nodes[1].Label != "C" {
+		t.Errorf("Expected nodes A and C to be recovered, got %+v", diagram.Nodes)
+	}
+	if len(diagram.Edges) != 2 {
+		t.Errorf("Expected 2 recovered edges, got %d", len(diagram.Edges))
+	}
+}
+
+// TestParserStrayParens tests recovery from unbalanced parentheses
+func TestParserStrayParens(t *testing.T) {
+	_, err := NewParser(NewLexer(") (diagram (nodes (id \"A\"))")).ParseDiagram()
+	if err == nil {
+		t.Fatalf("Expected errors")
+	}
+
+	errors := err.(ErrorList)
+	if len(errors) != 2 {
+		t.Fatalf("Expected 2 errors, got %d: %v", len(errors), err)
+	}
+	if !strings.Contains(errors[0].Error(), "1:1: unexpected ')'") {
+		t.Errorf("Unexpected first error: %v", errors[0])
+	}
+	if !strings.Contains(errors[1].Error(), "1:3: unclosed '('") {
+		t.Errorf("Unexpected second error: %v", errors[1])
+	}
+}
+
 // BenchmarkParser benchmarks parser performance
 func BenchmarkParser(b *testing.B) {
 	input := `(diagram
@@ -674,3 +1049,37 @@ func BenchmarkParser(b *testing.B) {
 		}
 	}
 }
+
+// TestAddImplicitNodes tests declaring nodes for undeclared edge endpoints
+func TestAddImplicitNodes(t *testing.T) {
+	input := `(diagram
+		(options :implicit-nodes true)
+		(node-style :fill "#eef")
+		(nodes (id "A" :shape "ellipse"))
+		(group "g" (nodes (id "B")))
+		(edges ("A" "C" "D") ("C" "g") ("D" "A")))`
+
+	diagram := ParseTestInput(t, input)
+	if err := NewValidator().Validate(diagram); err == nil {
+		t.Errorf("Expected undeclared nodes to be rejected before they are added")
+	}
+
+	created := diagram.AddImplicitNodes()
+	if len(created) != 2 || created[0].ID != "C" || created[1].ID != "D" {
+		t.Fatalf("Expected nodes C and D to be created, got %+v", created)
+	}
+	if !created[0].Implicit || created[0].Label != "C" || len(created[0].Attributes) != 0 {
+		t.Errorf("Unexpected implicit node %+v", created[0])
+	}
+	if created[0].Span.Start.Line != 6 {
+		t.Errorf("Expected implicit node to point at the edge, got %s", created[0].Span)
+	}
+	if len(diagram.Nodes) != 4 {
+		t.Errorf("Expected 4 nodes, got %d", len(diagram.Nodes))
+	}
+
+	ValidateTestDiagram(t, diagram)
+	if more := diagram.AddImplicitNodes(); len(more) != 0 {
+		t.Errorf("Expected no further nodes, got %+v", more)
+	}
+}
@@ -0,0 +1,566 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ValueType is the type an attribute value must have
+type ValueType int
+
+const (
+	TypeAny ValueType = iota
+	TypeString
+	TypeNumber
+	TypeInt
+	TypeBool
+	TypeColor
+	TypeLength
+	TypeDashArray
+	TypeList
+)
+
+func (t ValueType) String() string {
+	switch t {
+	case TypeString:
+		return "string"
+	case TypeNumber:
+		return "number"
+	case TypeInt:
+		return "integer"
+	case TypeBool:
+		return "boolean"
+	case TypeColor:
+		return "color"
+	case TypeLength:
+		return "length"
+	case TypeDashArray:
+		return "dash array"
+	case TypeList:
+		return "list"
+	default:
+		return "any"
+	}
+}
+
+// AttributeTarget is a set of the kinds of element an attribute applies to
+type AttributeTarget int
+
+const (
+	TargetNode AttributeTarget = 1 << iota
+	TargetEdge
+	TargetGroup
+	TargetDiagram
+)
+
+// targetNames names each kind of element, singular and plural
+var targetNames = []struct {
+	target         AttributeTarget
+	single, plural string
+}{
+	{TargetNode, "node", "nodes"},
+	{TargetEdge, "edge", "edges"},
+	{TargetGroup, "group", "groups"},
+	{TargetDiagram, "diagram", "diagrams"},
+}
+
+func (t AttributeTarget) String() string {
+	var names []string
+	for _, name := range targetNames {
+		if t&name.target != 0 {
+			names = append(names, name.single)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// plural names the kinds of element in t for messages, as in "nodes or
+// edges"
+func (t AttributeTarget) plural() string {
+	var names []string
+	for _, name := range targetNames {
+		if t&name.target != 0 {
+			names = append(names, name.plural)
+		}
+	}
+	return strings.Join(names, " or ")
+}
+
+// AttributeSpec describes an attribute: the elements it applies to, the
+// type and values it accepts and how it is drawn
+type AttributeSpec struct {
+	Name        string
+	AppliesTo   AttributeTarget
+	Type        ValueType
+	Default     string
+	Values      []string // the values allowed, or nil for any of Type
+	Description string
+
+	// CSS is the property the attribute is drawn with, if any: written
+	// to the stylesheet from node-style, edge-style and classes, and as
+	// an inline style when set on a single element. LabelCSS sets it on
+	// the label instead of the shape.
+	CSS      string
+	LabelCSS bool
+}
+
+// attributeRegistry lists every attribute the language knows. Diagram
+// attributes are those of (options ...).
+var attributeRegistry = []AttributeSpec{
+	{Name: "label", AppliesTo: TargetNode | TargetEdge | TargetGroup, Type: TypeString,
+		Default: "the ID for nodes and groups", Description: "Text drawn on the element; accepts label markup"},
+	{Name: "class", AppliesTo: TargetNode | TargetEdge, Type: TypeList,
+		Description: "Classes defined with defclass to apply, later ones winning"},
+	{Name: "shape", AppliesTo: TargetNode, Type: TypeString, Default: "rect",
+		Values:      []string{"rect", "rectangle", "box", "ellipse", "circle", "oval", "diamond", "rhombus"},
+		Description: "Outline of the node"},
+	{Name: "fill", AppliesTo: TargetNode | TargetGroup, Type: TypeColor, Default: "#ffffff, #f8f8f8 for groups",
+		Description: "Fill color of the node or group box", CSS: "fill"},
+	{Name: "stroke", AppliesTo: TargetNode | TargetEdge | TargetGroup, Type: TypeColor, Default: "#000000, #999999 for groups",
+		Description: "Color of the outline or line", CSS: "stroke"},
+	{Name: "stroke-width", AppliesTo: TargetNode | TargetEdge | TargetGroup, Type: TypeLength, Default: "1",
+		Description: "Width of the outline or line", CSS: "stroke-width"},
+	{Name: "stroke-dasharray", AppliesTo: TargetNode | TargetEdge | TargetGroup, Type: TypeDashArray, Default: "none, 4 2 for groups",
+		Description: "Dash pattern of the outline or line: none, or lengths separated by spaces or commas", CSS: "stroke-dasharray"},
+	{Name: "opacity", AppliesTo: TargetNode | TargetEdge | TargetGroup, Type: TypeNumber, Default: "1",
+		Description: "Opacity from 0 to 1", CSS: "opacity"},
+	{Name: "color", AppliesTo: TargetNode | TargetEdge, Type: TypeColor, Default: "#000000",
+		Description: "Color of the label text", CSS: "fill", LabelCSS: true},
+	{Name: "font-size", AppliesTo: TargetNode | TargetEdge, Type: TypeLength, Default: "12px for nodes, 10px for edges",
+		Description: "Size of the label text", CSS: "font-size", LabelCSS: true},
+	{Name: "style", AppliesTo: TargetEdge, Type: TypeString, Default: "solid",
+		Values:      []string{"solid", "dashed", "dotted", "bold", "invis", "invisible"},
+		Description: "Line style of the edge"},
+	{Name: "dir", AppliesTo: TargetEdge, Type: TypeString, Default: "forward, or none in undirected diagrams",
+		Values:      []string{string(DirForward), string(DirBack), string(DirBoth), string(DirNone)},
+		Description: "Arrowheads drawn on the edge"},
+	{Name: "weight", AppliesTo: TargetNode | TargetEdge, Type: TypeNumber,
+		Description: "Relative importance, for tools reading the diagram"},
+	{Name: "from-port", AppliesTo: TargetEdge, Type: TypeString,
+		Description: "Port of the source node the edge leaves from"},
+	{Name: "to-port", AppliesTo: TargetEdge, Type: TypeString,
+		Description: "Port of the target node the edge enters"},
+	{Name: "ports", AppliesTo: TargetNode, Type: TypeList,
+		Description: "Named ports edges can attach to, in order along the side"},
+	{Name: "tags", AppliesTo: TargetNode | TargetEdge | TargetGroup, Type: TypeList,
+		Description: "Tags selecting the element in profiles"},
+	{Name: "when", AppliesTo: TargetNode | TargetEdge | TargetGroup, Type: TypeString,
+		Description: "Condition on --define variables for drawing the element"},
+	{Name: "implicit-nodes", AppliesTo: TargetDiagram, Type: TypeBool, Default: "false",
+		Description: "Create nodes for edge endpoints that are not declared"},
+	{Name: "directed", AppliesTo: TargetDiagram, Type: TypeBool, Default: "true",
+		Description: "Draw arrowheads and rank edges by direction"},
+}
+
+// LookupAttribute returns the description of a known attribute
+func LookupAttribute(name string) (AttributeSpec, bool) {
+	for _, spec := range attributeRegistry {
+		if spec.Name == name {
+			return spec, true
+		}
+	}
+	return AttributeSpec{}, false
+}
+
+// attributeType returns the type an attribute must have, TypeAny for
+// unknown attributes
+func attributeType(name string) ValueType {
+	if spec, ok := LookupAttribute(name); ok {
+		return spec.Type
+	}
+	return TypeAny
+}
+
+// Allows reports whether value is one of the allowed values of the
+// attribute; attributes without a list of values allow anything
+func (a AttributeSpec) Allows(value string) bool {
+	if a.Values == nil {
+		return true
+	}
+	for _, allowed := range a.Values {
+		if value == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAttributeName returns an error if name is not an attribute of the
+// elements in target, suggesting a close known name
+func checkAttributeName(name string, target AttributeTarget) error {
+	spec, ok := LookupAttribute(name)
+	if !ok {
+		if suggestion := suggestAttribute(name, target); suggestion != "" {
+			return fmt.Errorf("unknown attribute :%s (did you mean :%s?)", name, suggestion)
+		}
+		return fmt.Errorf("unknown attribute :%s", name)
+	}
+	if spec.AppliesTo&target == 0 {
+		return fmt.Errorf(":%s does not apply to %s, only to %s", name, target.plural(), spec.AppliesTo.plural())
+	}
+	return nil
+}
+
+// suggestAttribute returns the known attribute of target closest to
+// name, if one is close enough to be a likely typo
+func suggestAttribute(name string, target AttributeTarget) string {
+	best, bestDistance := "", len(name)/3+1
+	for _, spec := range attributeRegistry {
+		if spec.AppliesTo&target == 0 {
+			continue
+		}
+		if d := editDistance(name, spec.Name); d <= bestDistance && (best == "" || d < editDistance(name, best)) {
+			best = spec.Name
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+// WriteAttributeReference writes the description of the named attributes,
+// or of all of them if names is empty, as printed by lisvg attrs
+func WriteAttributeReference(w io.Writer, names []string) error {
+	specs := attributeRegistry
+	if len(names) > 0 {
+		specs = nil
+		for _, name := range names {
+			name = strings.TrimPrefix(name, ":")
+			spec, ok := LookupAttribute(name)
+			if !ok {
+				return checkAttributeName(name, TargetNode|TargetEdge|TargetGroup|TargetDiagram)
+			}
+			specs = append(specs, spec)
+		}
+	}
+
+	for i, spec := range specs {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, ":%s\n", spec.Name)
+		fmt.Fprintf(w, "    %s\n", spec.Description)
+		fmt.Fprintf(w, "    applies to: %s\n", spec.AppliesTo)
+		fmt.Fprintf(w, "    type:       %s\n", spec.Type)
+		if spec.Values != nil {
+			fmt.Fprintf(w, "    values:     %s\n", strings.Join(spec.Values, ", "))
+		}
+		if spec.Default != "" {
+			fmt.Fprintf(w, "    default:    %s\n", spec.Default)
+		}
+	}
+	return nil
+}
+
+// Length is a CSS length such as 12px or 1.5em. Unit is empty for plain
+// numbers, which SVG reads as user units.
+type Length struct {
+	Value float64
+	Unit  string
+}
+
+func (l Length) String() string {
+	return strconv.FormatFloat(l.Value, 'f', -1, 64) + l.Unit
+}
+
+// pixelsPerUnit gives the size in px of the absolute units; plain numbers
+// are px
+var pixelsPerUnit = map[string]float64{
+	"": 1, "px": 1, "pt": 4.0 / 3, "pc": 16, "in": 96, "cm": 96 / 2.54, "mm": 96 / 25.4,
+}
+
+// Pixels returns the length in px. Relative units such as em and % depend
+// on where the length is used and are not converted.
+func (l Length) Pixels() (float64, bool) {
+	factor, ok := pixelsPerUnit[l.Unit]
+	return l.Value * factor, ok
+}
+
+// lengthUnits lists the units accepted by ParseLength
+var lengthUnits = []string{"px", "em", "rem", "ex", "pt", "pc", "cm", "mm", "in", "%"}
+
+// ParseLength parses a number with an optional CSS unit
+func ParseLength(text string) (Length, error) {
+	number := strings.TrimSpace(text)
+	unit := ""
+	for _, u := range lengthUnits {
+		if strings.HasSuffix(number, u) {
+			number, unit = strings.TrimSuffix(number, u), u
+			break
+		}
+	}
+
+	value, err := parseFiniteFloat(number)
+	if err != nil {
+		return Length{}, fmt.Errorf("invalid length %q", text)
+	}
+	return Length{Value: value, Unit: unit}, nil
+}
+
+// ParseDashArray parses a stroke dash pattern, none or a list of
+// non-negative lengths separated by spaces or commas, and returns it
+// normalised for the stylesheet
+func ParseDashArray(text string) (string, error) {
+	if strings.TrimSpace(text) == "none" {
+		return "none", nil
+	}
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty dash array")
+	}
+	lengths := make([]string, len(fields))
+	for i, field := range fields {
+		length, err := ParseLength(field)
+		if err != nil {
+			return "", err
+		}
+		if length.Value < 0 {
+			return "", fmt.Errorf("negative dash length %q", field)
+		}
+		lengths[i] = length.String()
+	}
+	return strings.Join(lengths, " "), nil
+}
+
+// parseFiniteFloat parses a decimal number, rejecting Inf and NaN
+func parseFiniteFloat(text string) (float64, error) {
+	if !looksNumeric(text) {
+		return 0, fmt.Errorf("invalid number %q", text)
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsInf(value, 0) || math.IsNaN(value) {
+		return 0, fmt.Errorf("invalid number %q", text)
+	}
+	return value, nil
+}
+
+// AsString returns the text of an atom
+func (v Value) AsString() (string, error) {
+	if !v.IsAtom() {
+		return "", v.typeError(TypeString)
+	}
+	return v.Text, nil
+}
+
+// AsInt returns the value as an integer. Strings holding an integer are
+// accepted, so values written as "2" and 2 behave the same.
+func (v Value) AsInt() (int64, error) {
+	switch v.Kind {
+	case ValueInt:
+		return v.Int, nil
+	case ValueString:
+		if n, err := strconv.ParseInt(strings.TrimSpace(v.Text), 10, 64); err == nil {
+			return n, nil
+		}
+	}
+	return 0, v.typeError(TypeInt)
+}
+
+// AsFloat returns the value as a number
+func (v Value) AsFloat() (float64, error) {
+	switch v.Kind {
+	case ValueInt:
+		return float64(v.Int), nil
+	case ValueFloat:
+		return v.Float, nil
+	case ValueString:
+		if f, err := parseFiniteFloat(strings.TrimSpace(v.Text)); err == nil {
+			return f, nil
+		}
+	}
+	return 0, v.typeError(TypeNumber)
+}
+
+// AsBool returns the value as a boolean
+func (v Value) AsBool() (bool, error) {
+	switch v.Kind {
+	case ValueBool:
+		return v.Bool, nil
+	case ValueString:
+		switch v.Text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, v.typeError(TypeBool)
+}
+
+// AsLength returns the value as a length. Plain numbers have no unit.
+func (v Value) AsLength() (Length, error) {
+	switch v.Kind {
+	case ValueInt, ValueFloat:
+		f, _ := v.AsFloat()
+		return Length{Value: f}, nil
+	case ValueString, ValueSymbol:
+		if length, err := ParseLength(v.Text); err == nil {
+			return length, nil
+		}
+	}
+	return Length{}, v.typeError(TypeLength)
+}
+
+// AsDashArray returns the value as a dash pattern, normalised as by
+// ParseDashArray. A single number is a pattern of one length.
+func (v Value) AsDashArray() (string, error) {
+	switch v.Kind {
+	case ValueInt, ValueFloat:
+		if length, err := v.AsLength(); err == nil && length.Value >= 0 {
+			return length.String(), nil
+		}
+	case ValueString, ValueSymbol:
+		pattern, err := ParseDashArray(v.Text)
+		if err != nil {
+			return "", fmt.Errorf("%v: %v", v.typeError(TypeDashArray), err)
+		}
+		return pattern, nil
+	}
+	return "", v.typeError(TypeDashArray)
+}
+
+// AsColor returns the value as a paint, normalised as by ParsePaint
+func (v Value) AsColor() (string, error) {
+	if v.Kind != ValueString && v.Kind != ValueSymbol {
+		return "", v.typeError(TypeColor)
+	}
+	paint, err := ParsePaint(v.Text)
+	if err != nil {
+		return "", fmt.Errorf("%v: %v", v.typeError(TypeColor), err)
+	}
+	return paint, nil
+}
+
+// AsList returns the elements of a list value. A single string is split
+// on whitespace, so :tags "db critical" and :tags ("db" "critical") are
+// the same.
+func (v Value) AsList() ([]string, error) {
+	switch v.Kind {
+	case ValueList:
+		items := make([]string, len(v.List))
+		for i, elem := range v.List {
+			if !elem.IsAtom() {
+				return nil, v.typeError(TypeList)
+			}
+			items[i] = elem.Text
+		}
+		return items, nil
+	case ValueString, ValueSymbol:
+		return strings.Fields(v.Text), nil
+	}
+	return nil, v.typeError(TypeList)
+}
+
+// CheckType reports whether the value can be read as type t
+func (v Value) CheckType(t ValueType) error {
+	var err error
+	switch t {
+	case TypeString:
+		_, err = v.AsString()
+	case TypeNumber:
+		_, err = v.AsFloat()
+	case TypeInt:
+		_, err = v.AsInt()
+	case TypeBool:
+		_, err = v.AsBool()
+	case TypeColor:
+		_, err = v.AsColor()
+	case TypeLength:
+		_, err = v.AsLength()
+	case TypeDashArray:
+		_, err = v.AsDashArray()
+	case TypeList:
+		_, err = v.AsList()
+	}
+	return err
+}
+
+func (v Value) typeError(expected ValueType) error {
+	return fmt.Errorf("expected %s, got %s", expected, v.describe())
+}
+
+// attrValue looks up a typed attribute value, falling back to the text of
+// attributes that were set without one
+func attrValue(values map[string]Value, attrs map[string]string, key string) (Value, bool) {
+	if value, ok := values[key]; ok {
+		return value, true
+	}
+	if text, ok := attrs[key]; ok {
+		return Value{Kind: ValueString, Text: text}, true
+	}
+	return Value{}, false
+}
+
+// Attr returns the typed value of an attribute; use the As methods of
+// Value to read it, e.g. node.Attr("stroke-width") then AsLength
+func (n Node) Attr(key string) (Value, bool) {
+	return attrValue(n.Values, n.Attributes, key)
+}
+
+// Attr returns the typed value of an attribute
+func (e Edge) Attr(key string) (Value, bool) {
+	return attrValue(e.Values, e.Attributes, key)
+}
+
+// Attr returns the typed value of an attribute
+func (g Group) Attr(key string) (Value, bool) {
+	return attrValue(g.Values, g.Attributes, key)
+}
+
+// Attr returns the typed value of an attribute
+func (c Class) Attr(key string) (Value, bool) {
+	return attrValue(c.Values, c.Attributes, key)
+}
+
+// cssValue renders an attribute value for a stylesheet, normalising
+// lengths so that "2" and 2.0 are written alike and colors so that red,
+// #f00 and rgb(255, 0, 0) are
+func cssValue(key, text string) string {
+	switch attributeType(key) {
+	case TypeLength:
+		if length, err := ParseLength(text); err == nil {
+			return length.String()
+		}
+	case TypeColor:
+		if paint, err := ParsePaint(text); err == nil {
+			return paint
+		}
+	case TypeDashArray:
+		if pattern, err := ParseDashArray(text); err == nil {
+			return pattern
+		}
+	}
+	return text
+}
+
+// safeCSSValue reports whether a value can be written into a declaration
+// of the stylesheet without ending it, its rule or the style element.
+// The validator rejects such values; this keeps diagrams that skipped
+// validation from injecting markup into the SVG.
+func safeCSSValue(text string) bool {
+	return !strings.ContainsAny(text, "<>;{}&\"\\")
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParseLength tests parsing numbers with CSS units
+func TestParseLength(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Length
+		valid    bool
+	}{
+		{"2", Length{Value: 2}, true},
+		{"1.5", Length{Value: 1.5}, true},
+		{"12px", Length{Value: 12, Unit: "px"}, true},
+		{"0.8em", Length{Value: 0.8, Unit: "em"}, true},
+		{"50%", Length{Value: 50, Unit: "%"}, true},
+		{"thick", Length{}, false},
+		{"px", Length{}, false},
+		{"12furlongs", Length{}, false},
+		{"Inf", Length{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			length, err := ParseLength(tt.input)
+			if (err == nil) != tt.valid {
+				t.Fatalf("ParseLength(%q) error = %v, expected valid=%v", tt.input, err, tt.valid)
+			}
+			if length != tt.expected {
+				t.Errorf("ParseLength(%q) = %+v, expected %+v", tt.input, length, tt.expected)
+			}
+		})
+	}
+
+	if s := (Length{Value: 2.5, Unit: "px"}).String(); s != "2.5px" {
+		t.Errorf("Expected 2.5px, got %s", s)
+	}
+}
+
+// TestParseDashArray tests parsing and normalising dash patterns
+func TestParseDashArray(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		valid    bool
+	}{
+		{"none", "none", true},
+		{"4 2", "4 2", true},
+		{"5,5", "5 5", true},
+		{" 1.0px, 2em 3 ", "1px 2em 3", true},
+		{"", "", false},
+		{"4 -2", "", false},
+		{"1 2; } </style>", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			pattern, err := ParseDashArray(tt.input)
+			if (err == nil) != tt.valid {
+				t.Fatalf("ParseDashArray(%q) error = %v, expected valid=%v", tt.input, err, tt.valid)
+			}
+			if pattern != tt.expected {
+				t.Errorf("ParseDashArray(%q) = %q, expected %q", tt.input, pattern, tt.expected)
+			}
+		})
+	}
+}
+
+// TestTypedAttributes tests the typed accessors on parsed attributes
+func TestTypedAttributes(t *testing.T) {
+	input := `(diagram
+		(nodes
+			(id "A" :stroke-width 2 :font-size 12px :weight "1.5" :visible true :tags ("db" "critical") :fill "#fff")))`
+
+	node := ParseTestInput(t, input).Nodes[0]
+
+	value, ok := node.Attr("stroke-width")
+	if !ok || value.Kind != ValueInt {
+		t.Fatalf("Expected typed integer stroke-width, got %+v", value)
+	}
+	if n, err := value.AsInt(); err != nil || n != 2 {
+		t.Errorf("AsInt() = %d, %v", n, err)
+	}
+
+	value, _ = node.Attr("font-size")
+	if length, err := value.AsLength(); err != nil || length != (Length{Value: 12, Unit: "px"}) {
+		t.Errorf("AsLength() = %+v, %v", length, err)
+	}
+
+	value, _ = node.Attr("weight")
+	if f, err := value.AsFloat(); err != nil || f != 1.5 {
+		t.Errorf("Expected string holding a number to read as 1.5, got %v, %v", f, err)
+	}
+
+	value, _ = node.Attr("visible")
+	if b, err := value.AsBool(); err != nil || !b {
+		t.Errorf("AsBool() = %v, %v", b, err)
+	}
+
+	value, _ = node.Attr("tags")
+	if tags, err := value.AsList(); err != nil || strings.Join(tags, ",") != "db,critical" {
+		t.Errorf("AsList() = %v, %v", tags, err)
+	}
+	if node.Attributes["tags"] != "db critical" {
+		t.Errorf("Expected list text to be space-separated, got %q", node.Attributes["tags"])
+	}
+
+	value, _ = node.Attr("fill")
+	if _, err := value.AsLength(); err == nil || err.Error() != `expected length, got "#fff"` {
+		t.Errorf("Expected type error, got %v", err)
+	}
+
+	if _, ok := node.Attr("missing"); ok {
+		t.Errorf("Expected missing attribute to be absent")
+	}
+
+	// Nodes built without typed values fall back to the attribute text
+	plain := Node{ID: "B", Attributes: map[string]string{"stroke-width": "3"}}
+	value, _ = plain.Attr("stroke-width")
+	if length, err := value.AsLength(); err != nil || length.Value != 3 {
+		t.Errorf("Expected fallback length 3, got %+v, %v", length, err)
+	}
+}
+
+// TestAttributeRegistry tests looking up attributes and checking names
+func TestAttributeRegistry(t *testing.T) {
+	spec, ok := LookupAttribute("shape")
+	if !ok || spec.AppliesTo != TargetNode || spec.Type != TypeString {
+		t.Fatalf("Unexpected shape attribute: %+v", spec)
+	}
+	if !spec.Allows("diamond") || spec.Allows("triangle") {
+		t.Errorf("Expected shape to allow diamond and not triangle")
+	}
+	if spec, _ := LookupAttribute("weight"); !spec.Allows("anything") {
+		t.Errorf("Expected attributes without values to allow anything")
+	}
+
+	tests := []struct {
+		name     string
+		target   AttributeTarget
+		expected string
+	}{
+		{"fill", TargetNode, ""},
+		{"colour", TargetNode, "unknown attribute :colour (did you mean :color?)"},
+		{"strokewidth", TargetEdge, "unknown attribute :strokewidth (did you mean :stroke-width?)"},
+		{"shap", TargetEdge, "unknown attribute :shap"},
+		{"xyz", TargetNode, "unknown attribute :xyz"},
+		{"shape", TargetEdge, ":shape does not apply to edges, only to nodes"},
+		{"style", TargetNode | TargetEdge, ""},
+		{"directed", TargetNode, ":directed does not apply to nodes, only to diagrams"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAttributeName(tt.name, tt.target)
+			if tt.expected == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("Expected %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+// TestWriteAttributeReference tests the reference printed by lisvg attrs
+func TestWriteAttributeReference(t *testing.T) {
+	var sb strings.Builder
+	if err := WriteAttributeReference(&sb, []string{":shape"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `:shape
+    Outline of the node
+    applies to: node
+    type:       string
+    values:     rect, rectangle, box, ellipse, circle, oval, diamond, rhombus
+    default:    rect
+`
+	if sb.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, sb.String())
+	}
+
+	sb.Reset()
+	if err := WriteAttributeReference(&sb, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n := strings.Count(sb.String(), "\n:"); n != len(attributeRegistry)-1 {
+		t.Errorf("Expected every attribute to be listed, got %d", n+1)
+	}
+
+	err := WriteAttributeReference(&sb, []string{"colour"})
+	if err == nil || err.Error() != "unknown attribute :colour (did you mean :color?)" {
+		t.Errorf("Expected unknown attribute error, got %v", err)
+	}
+}
@@ -0,0 +1,500 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Color is an sRGB color with an alpha from 0 (transparent) to 1 (opaque)
+type Color struct {
+	R, G, B uint8
+	A       float64
+}
+
+// String writes the color as #rrggbb, or as rgba(...) if it is not
+// opaque, since older SVG renderers do not read 8-digit hex colors
+func (c Color) String() string {
+	if c.A >= 1 {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	alpha := strconv.FormatFloat(math.Round(c.A*1000)/1000, 'f', -1, 64)
+	return fmt.Sprintf("rgba(%d, %d, %d, %s)", c.R, c.G, c.B, alpha)
+}
+
+// Lighten returns the color with its HSL lightness raised by amount, from
+// 0 to 1, as in lighten(#336699, 20%)
+func (c Color) Lighten(amount float64) Color {
+	h, s, l := c.hsl()
+	return hslColor(h, s, clamp(l+amount, 0, 1), c.A)
+}
+
+// Darken returns the color with its HSL lightness lowered by amount
+func (c Color) Darken(amount float64) Color {
+	return c.Lighten(-amount)
+}
+
+// WithAlpha returns the color with the given alpha
+func (c Color) WithAlpha(alpha float64) Color {
+	c.A = clamp(alpha, 0, 1)
+	return c
+}
+
+// hsl returns the hue in degrees and the saturation and lightness from 0
+// to 1
+func (c Color) hsl() (float64, float64, float64) {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	hi, lo := max(r, g, b), min(r, g, b)
+	l := (hi + lo) / 2
+	if hi == lo {
+		return 0, 0, l
+	}
+
+	d := hi - lo
+	s := d / (1 - math.Abs(2*l-1))
+	var h float64
+	switch hi {
+	case r:
+		h = math.Mod((g-b)/d, 6)
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	return math.Mod(h*60+360, 360), s, l
+}
+
+// hslColor converts a hue in degrees and a saturation and lightness from
+// 0 to 1 to a color
+func hslColor(h, s, l, alpha float64) Color {
+	h = math.Mod(math.Mod(h, 360)+360, 360)
+	chroma := (1 - math.Abs(2*l-1)) * s
+	x := chroma * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - chroma/2
+
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = chroma, x, 0
+	case h < 120:
+		r, g, b = x, chroma, 0
+	case h < 180:
+		r, g, b = 0, chroma, x
+	case h < 240:
+		r, g, b = 0, x, chroma
+	case h < 300:
+		r, g, b = x, 0, chroma
+	default:
+		r, g, b = chroma, 0, x
+	}
+	channel := func(v float64) uint8 {
+		return uint8(math.Round(clamp(v+m, 0, 1) * 255))
+	}
+	return Color{R: channel(r), G: channel(g), B: channel(b), A: alpha}
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, v))
+}
+
+// ParseColor parses a CSS color: a hex color of 3, 4, 6 or 8 digits, a
+// CSS color name, rgb(), rgba(), hsl() or hsla() in the comma or space
+// separated syntax, or one of the helpers
+//
+//	lighten(color, 20%)
+//	darken(color, 0.2)
+//	alpha(color, 50%)
+//
+// which adjust the HSL lightness or set the alpha of another color.
+// Names and function names are not case sensitive.
+func ParseColor(text string) (Color, error) {
+	text = strings.TrimSpace(text)
+	if hex, ok := strings.CutPrefix(text, "#"); ok {
+		return parseHexColor(hex)
+	}
+	if open := strings.IndexByte(text, '('); open >= 0 {
+		if !strings.HasSuffix(text, ")") {
+			return Color{}, fmt.Errorf("missing ')'")
+		}
+		name := strings.ToLower(strings.TrimSpace(text[:open]))
+		return parseColorFunction(name, text[open+1:len(text)-1])
+	}
+
+	name := strings.ToLower(text)
+	if name == "transparent" {
+		return Color{}, nil
+	}
+	if rgb, ok := colorNames[name]; ok {
+		return Color{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 1}, nil
+	}
+	if suggestion := suggestColorName(name); suggestion != "" {
+		return Color{}, fmt.Errorf("unknown color name (did you mean %s?)", suggestion)
+	}
+	return Color{}, fmt.Errorf("unknown color name")
+}
+
+// ParsePaint parses the value of a fill or stroke: a color as accepted
+// by ParseColor, none or currentColor. It returns the paint normalised
+// for the stylesheet, with colors written as by Color.String.
+func ParsePaint(text string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(text)) {
+	case "none":
+		return "none", nil
+	case "currentcolor":
+		return "currentColor", nil
+	}
+	color, err := ParseColor(text)
+	if err != nil {
+		return "", err
+	}
+	return color.String(), nil
+}
+
+func parseHexColor(hex string) (Color, error) {
+	switch len(hex) {
+	case 3, 4:
+		// Each digit is doubled: #f80 is #ff8800
+		expanded := make([]byte, 0, 2*len(hex))
+		for i := 0; i < len(hex); i++ {
+			expanded = append(expanded, hex[i], hex[i])
+		}
+		hex = string(expanded)
+	case 6, 8:
+	default:
+		return Color{}, fmt.Errorf("hex colors have 3, 4, 6 or 8 digits")
+	}
+
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return Color{}, fmt.Errorf("invalid hex digit")
+	}
+	if len(hex) == 6 {
+		value = value<<8 | 0xff
+	}
+	return Color{
+		R: uint8(value >> 24),
+		G: uint8(value >> 16),
+		B: uint8(value >> 8),
+		A: float64(uint8(value)) / 255,
+	}, nil
+}
+
+// parseColorFunction parses the arguments of a color function, given
+// without the parentheses
+func parseColorFunction(name, body string) (Color, error) {
+	args := splitColorArguments(body)
+	switch name {
+	case "rgb", "rgba", "hsl", "hsla":
+		if len(args) != 3 && len(args) != 4 {
+			return Color{}, fmt.Errorf("%s() takes 3 or 4 arguments, got %d", name, len(args))
+		}
+		alpha := 1.0
+		if len(args) == 4 {
+			var err error
+			if alpha, err = parseColorFraction(args[3], "alpha"); err != nil {
+				return Color{}, err
+			}
+		}
+		if strings.HasPrefix(name, "rgb") {
+			return parseRGB(args[:3], alpha)
+		}
+		return parseHSL(args[:3], alpha)
+
+	case "lighten", "darken", "alpha":
+		if len(args) != 2 {
+			return Color{}, fmt.Errorf("%s() takes a color and an amount, got %d arguments", name, len(args))
+		}
+		color, err := ParseColor(args[0])
+		if err != nil {
+			return Color{}, fmt.Errorf("%s(): %v", name, err)
+		}
+		amount, err := parseColorFraction(args[1], "amount")
+		if err != nil {
+			return Color{}, fmt.Errorf("%s(): %v", name, err)
+		}
+		switch name {
+		case "lighten":
+			return color.Lighten(amount), nil
+		case "darken":
+			return color.Darken(amount), nil
+		default:
+			return color.WithAlpha(amount), nil
+		}
+	}
+	return Color{}, fmt.Errorf("unknown color function %s()", name)
+}
+
+// splitColorArguments splits the arguments of a color function on the
+// commas outside nested parentheses, or for the space separated syntax
+// rgb(255 0 0 / 50%) on spaces and the slash before the alpha
+func splitColorArguments(body string) []string {
+	var args []string
+	depth, start := 0, 0
+	for i, r := range body {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(body[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	args = append(args, strings.TrimSpace(body[start:]))
+	if len(args) > 1 || strings.ContainsRune(body, '(') {
+		return args
+	}
+
+	components, alpha, found := strings.Cut(body, "/")
+	args = strings.Fields(components)
+	if found {
+		args = append(args, strings.TrimSpace(alpha))
+	}
+	return args
+}
+
+// parseColorFraction parses a number from 0 to 1 or a percentage
+func parseColorFraction(text, what string) (float64, error) {
+	value, percent, err := parseColorNumber(text)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s '%s'", what, text)
+	}
+	if percent {
+		value /= 100
+	}
+	if value < 0 || value > 1 {
+		return 0, fmt.Errorf("%s '%s' out of range", what, text)
+	}
+	return value, nil
+}
+
+// parseColorNumber parses a number, reporting whether it was followed by %
+func parseColorNumber(text string) (float64, bool, error) {
+	number, percent := strings.CutSuffix(text, "%")
+	value, err := parseFiniteFloat(number)
+	return value, percent, err
+}
+
+func parseRGB(args []string, alpha float64) (Color, error) {
+	var channels [3]uint8
+	for i, arg := range args {
+		value, percent, err := parseColorNumber(arg)
+		if err != nil {
+			return Color{}, fmt.Errorf("invalid %s component '%s'", []string{"red", "green", "blue"}[i], arg)
+		}
+		if percent {
+			value = value * 255 / 100
+		}
+		if value < 0 || value > 255 {
+			return Color{}, fmt.Errorf("%s component '%s' out of range", []string{"red", "green", "blue"}[i], arg)
+		}
+		channels[i] = uint8(math.Round(value))
+	}
+	return Color{R: channels[0], G: channels[1], B: channels[2], A: alpha}, nil
+}
+
+// hueUnits converts the units of a hue angle to degrees; grad comes
+// before rad, which it ends with
+var hueUnits = []struct {
+	unit   string
+	factor float64
+}{
+	{"deg", 1},
+	{"grad", 0.9},
+	{"rad", 180 / math.Pi},
+	{"turn", 360},
+}
+
+func parseHSL(args []string, alpha float64) (Color, error) {
+	hue := args[0]
+	scale := 1.0
+	for _, u := range hueUnits {
+		if number, ok := strings.CutSuffix(strings.ToLower(hue), u.unit); ok {
+			hue, scale = number, u.factor
+			break
+		}
+	}
+	h, err := parseFiniteFloat(hue)
+	if err != nil {
+		return Color{}, fmt.Errorf("invalid hue '%s'", args[0])
+	}
+
+	s, err := parseColorFraction(args[1], "saturation")
+	if err != nil {
+		return Color{}, err
+	}
+	l, err := parseColorFraction(args[2], "lightness")
+	if err != nil {
+		return Color{}, err
+	}
+	return hslColor(h*scale, s, l, alpha), nil
+}
+
+// suggestColorName returns the color name closest to name, if one is
+// close enough to be a likely typo
+func suggestColorName(name string) string {
+	best, bestDistance := "", len(name)/3+1
+	for candidate := range colorNames {
+		d := editDistance(name, candidate)
+		if d < bestDistance || (d == bestDistance && (best == "" || candidate < best)) {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// colorNames holds the CSS color names as 0xrrggbb
+var colorNames = map[string]uint32{
+	"aliceblue":            0xf0f8ff,
+	"antiquewhite":         0xfaebd7,
+	"aqua":                 0x00ffff,
+	"aquamarine":           0x7fffd4,
+	"azure":                0xf0ffff,
+	"beige":                0xf5f5dc,
+	"bisque":               0xffe4c4,
+	"black":                0x000000,
+	"blanchedalmond":       0xffebcd,
+	"blue":                 0x0000ff,
+	"blueviolet":           0x8a2be2,
+	"brown":                0xa52a2a,
+	"burlywood":            0xdeb887,
+	"cadetblue":            0x5f9ea0,
+	"chartreuse":           0x7fff00,
+	"chocolate":            0xd2691e,
+	"coral":                0xff7f50,
+	"cornflowerblue":       0x6495ed,
+	"cornsilk":             0xfff8dc,
+	"crimson":              0xdc143c,
+	"cyan":                 0x00ffff,
+	"darkblue":             0x00008b,
+	"darkcyan":             0x008b8b,
+	"darkgoldenrod":        0xb8860b,
+	"darkgray":             0xa9a9a9,
+	"darkgreen":            0x006400,
+	"darkgrey":             0xa9a9a9,
+	"darkkhaki":            0xbdb76b,
+	"darkmagenta":          0x8b008b,
+	"darkolivegreen":       0x556b2f,
+	"darkorange":           0xff8c00,
+	"darkorchid":           0x9932cc,
+	"darkred":              0x8b0000,
+	"darksalmon":           0xe9967a,
+	"darkseagreen":         0x8fbc8f,
+	"darkslateblue":        0x483d8b,
+	"darkslategray":        0x2f4f4f,
+	"darkslategrey":        0x2f4f4f,
+	"darkturquoise":        0x00ced1,
+	"darkviolet":           0x9400d3,
+	"deeppink":             0xff1493,
+	"deepskyblue":          0x00bfff,
+	"dimgray":              0x696969,
+	"dimgrey":              0x696969,
+	"dodgerblue":           0x1e90ff,
+	"firebrick":            0xb22222,
+	"floralwhite":          0xfffaf0,
+	"forestgreen":          0x228b22,
+	"fuchsia":              0xff00ff,
+	"gainsboro":            0xdcdcdc,
+	"ghostwhite":           0xf8f8ff,
+	"gold":                 0xffd700,
+	"goldenrod":            0xdaa520,
+	"gray":                 0x808080,
+	"green":                0x008000,
+	"greenyellow":          0xadff2f,
+	"grey":                 0x808080,
+	"honeydew":             0xf0fff0,
+	"hotpink":              0xff69b4,
+	"indianred":            0xcd5c5c,
+	"indigo":               0x4b0082,
+	"ivory":                0xfffff0,
+	"khaki":                0xf0e68c,
+	"lavender":             0xe6e6fa,
+	"lavenderblush":        0xfff0f5,
+	"lawngreen":            0x7cfc00,
+	"lemonchiffon":         0xfffacd,
+	"lightblue":            0xadd8e6,
+	"lightcoral":           0xf08080,
+	"lightcyan":            0xe0ffff,
+	"lightgoldenrodyellow": 0xfafad2,
+	"lightgray":            0xd3d3d3,
+	"lightgreen":           0x90ee90,
+	"lightgrey":            0xd3d3d3,
+	"lightpink":            0xffb6c1,
+	"lightsalmon":          0xffa07a,
+	"lightseagreen":        0x20b2aa,
+	"lightskyblue":         0x87cefa,
+	"lightslategray":       0x778899,
+	"lightslategrey":       0x778899,
+	"lightsteelblue":       0xb0c4de,
+	"lightyellow":          0xffffe0,
+	"lime":                 0x00ff00,
+	"limegreen":            0x32cd32,
+	"linen":                0xfaf0e6,
+	"magenta":              0xff00ff,
+	"maroon":               0x800000,
+	"mediumaquamarine":     0x66cdaa,
+	"mediumblue":           0x0000cd,
+	"mediumorchid":         0xba55d3,
+	"mediumpurple":         0x9370db,
+	"mediumseagreen":       0x3cb371,
+	"mediumslateblue":      0x7b68ee,
+	"mediumspringgreen":    0x00fa9a,
+	"mediumturquoise":      0x48d1cc,
+	"mediumvioletred":      0xc71585,
+	"midnightblue":         0x191970,
+	"mintcream":            0xf5fffa,
+	"mistyrose":            0xffe4e1,
+	"moccasin":             0xffe4b5,
+	"navajowhite":          0xffdead,
+	"navy":                 0x000080,
+	"oldlace":              0xfdf5e6,
+	"olive":                0x808000,
+	"olivedrab":            0x6b8e23,
+	"orange":               0xffa500,
+	"orangered":            0xff4500,
+	"orchid":               0xda70d6,
+	"palegoldenrod":        0xeee8aa,
+	"palegreen":            0x98fb98,
+	"paleturquoise":        0xafeeee,
+	"palevioletred":        0xdb7093,
+	"papayawhip":           0xffefd5,
+	"peachpuff":            0xffdab9,
+	"peru":                 0xcd853f,
+	"pink":                 0xffc0cb,
+	"plum":                 0xdda0dd,
+	"powderblue":           0xb0e0e6,
+	"purple":               0x800080,
+	"rebeccapurple":        0x663399,
+	"red":                  0xff0000,
+	"rosybrown":            0xbc8f8f,
+	"royalblue":            0x4169e1,
+	"saddlebrown":          0x8b4513,
+	"salmon":               0xfa8072,
+	"sandybrown":           0xf4a460,
+	"seagreen":             0x2e8b57,
+	"seashell":             0xfff5ee,
+	"sienna":               0xa0522d,
+	"silver":               0xc0c0c0,
+	"skyblue":              0x87ceeb,
+	"slateblue":            0x6a5acd,
+	"slategray":            0x708090,
+	"slategrey":            0x708090,
+	"snow":                 0xfffafa,
+	"springgreen":          0x00ff7f,
+	"steelblue":            0x4682b4,
+	"tan":                  0xd2b48c,
+	"teal":                 0x008080,
+	"thistle":              0xd8bfd8,
+	"tomato":               0xff6347,
+	"turquoise":            0x40e0d0,
+	"violet":               0xee82ee,
+	"wheat":                0xf5deb3,
+	"white":                0xffffff,
+	"whitesmoke":           0xf5f5f5,
+	"yellow":               0xffff00,
+	"yellowgreen":          0x9acd32,
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParseColor tests the color syntaxes and their normalised form
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"#fff", "#ffffff"},
+		{"#F80", "#ff8800"},
+		{"#ffff", "#ffffff"},
+		{"#f808", "rgba(255, 136, 0, 0.533)"},
+		{"#ff6b6b", "#ff6b6b"},
+		{"#ff6b6b80", "rgba(255, 107, 107, 0.502)"},
+		{"red", "#ff0000"},
+		{"RebeccaPurple", "#663399"},
+		{"lightgoldenrodyellow", "#fafad2"},
+		{"transparent", "rgba(0, 0, 0, 0)"},
+		{"rgb(1, 2, 3)", "#010203"},
+		{"RGB(100%, 50%, 0%)", "#ff8000"},
+		{"rgba(255, 0, 0, 0.5)", "rgba(255, 0, 0, 0.5)"},
+		{"rgb(255 0 0 / 25%)", "rgba(255, 0, 0, 0.25)"},
+		{"hsl(120, 100%, 25%)", "#008000"},
+		{"hsl(0.5turn 100% 50%)", "#00ffff"},
+		{"hsla(120, 50%, 50%, 0.5)", "rgba(64, 191, 64, 0.5)"},
+		{"hsl(200grad, 100%, 50%)", "#00ffff"},
+		{"lighten(#336699, 20%)", "#6699cc"},
+		{"darken(#6699cc, 0.2)", "#336699"},
+		{"darken(white, 100%)", "#000000"},
+		{"alpha(navy, 50%)", "rgba(0, 0, 128, 0.5)"},
+		{"alpha(lighten(rgb(0, 0, 0), 50%), 0.25)", "rgba(128, 128, 128, 0.25)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			color, err := ParseColor(tt.input)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if color.String() != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, color)
+			}
+		})
+	}
+}
+
+// TestParseColorErrors tests rejection of malformed colors
+func TestParseColorErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", "unknown color name"},
+		{"#ff", "hex colors have 3, 4, 6 or 8 digits"},
+		{"#ggg", "invalid hex digit"},
+		{"#gggggg", "invalid hex digit"},
+		{"12", "unknown color name"},
+		{"red;", "unknown color name (did you mean red?)"},
+		{"bleu", "unknown color name (did you mean blue?)"},
+		{"rgb(1, 2", "missing ')'"},
+		{"rgb(1, 2)", "rgb() takes 3 or 4 arguments, got 2"},
+		{"rgb(256, 0, 0)", "red component '256' out of range"},
+		{"rgba(0, 0, 0, 2)", "alpha '2' out of range"},
+		{"hsl(red, 50%, 50%)", "invalid hue 'red'"},
+		{"lighten(#12, 10%)", "lighten(): hex colors have 3, 4, 6 or 8 digits"},
+		{"darken(red)", "darken() takes a color and an amount, got 1 arguments"},
+		{"url(#gradient)", "unknown color function url()"},
+		{"none", "unknown color name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := ParseColor(tt.input)
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("Expected error %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+// TestParsePaint tests the keywords accepted for fills and strokes
+func TestParsePaint(t *testing.T) {
+	for input, expected := range map[string]string{"none": "none", "currentColor": "currentColor", "Red": "#ff0000"} {
+		if paint, err := ParsePaint(input); err != nil || paint != expected {
+			t.Errorf("Expected %s for %s, got %s, %v", expected, input, paint, err)
+		}
+	}
+	if _, err := ParsePaint("inherit"); err == nil {
+		t.Errorf("Expected an error for inherit")
+	}
+}
+
+// TestValidatorPaints tests that invalid paints are reported with a
+// suggestion and valid ones are normalised in the stylesheet
+func TestValidatorPaints(t *testing.T) {
+	input := `(diagram
+  (node-style :fill "bleu")
+  (defclass "hot" :fill "lighten(red, 20%)" :stroke "#gggggg")
+  (nodes (id "A" :class "hot" :color "none")))`
+
+	diagram := ParseTestInput(t, input)
+	err := NewValidator().Validate(diagram)
+	expected := []string{
+		`<input>:2:15: node-style: invalid :fill: expected color, got "bleu": unknown color name (did you mean blue?)`,
+		`<input>:3:45: class 'hot': invalid :stroke: expected color, got "#gggggg": invalid hex digit`,
+	}
+	if err == nil {
+		t.Fatalf("Expected validation to fail")
+	}
+	for _, message := range expected {
+		if !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected error containing %q, got: %v", message, err)
+		}
+	}
+
+	svg := CompletePipeline(t, `(diagram (defclass "hot" :fill "lighten(red, 20%)" :stroke "Navy") (nodes (id "A" :class "hot")))`)
+	AssertSVGContains(t, svg, "fill: #ff6666;", "stroke: #000080;")
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Severity is how serious a diagnostic is. The zero value is an error.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+	SeverityInfo
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityInfo:
+		return "info"
+	default:
+		return "error"
+	}
+}
+
+// DiagnosticCode identifies a kind of problem. IDs and names are stable
+// so tools can filter on them; new codes are only ever added.
+type DiagnosticCode struct {
+	ID   string
+	Name string
+}
+
+func (c DiagnosticCode) String() string {
+	if c.ID == "" {
+		return ""
+	}
+	return c.ID + " " + c.Name
+}
+
+// Codes of the problems the parser and validator report. E0xx codes come
+// from the validator and E1xx codes from reading and interpreting files.
+var (
+	CodeDuplicateNodeID    = DiagnosticCode{"E001", "duplicate-node-id"}
+	CodeEmptyID            = DiagnosticCode{"E002", "empty-id"}
+	CodeDuplicateGroupID   = DiagnosticCode{"E003", "duplicate-group-id"}
+	CodeGroupIDConflict    = DiagnosticCode{"E004", "group-id-conflict"}
+	CodeUnknownEndpoint    = DiagnosticCode{"E005", "unknown-edge-endpoint"}
+	CodeInvalidClassName   = DiagnosticCode{"E006", "invalid-class-name"}
+	CodeReservedClass      = DiagnosticCode{"E007", "reserved-class"}
+	CodeDuplicateClass     = DiagnosticCode{"E008", "duplicate-class"}
+	CodeUnknownClass       = DiagnosticCode{"E009", "unknown-class"}
+	CodeUnknownAttribute   = DiagnosticCode{"E010", "unknown-attribute"}
+	CodeMisplacedAttribute = DiagnosticCode{"E011", "misplaced-attribute"}
+	CodeInvalidValue       = DiagnosticCode{"E012", "invalid-attribute-value"}
+	CodeDuplicateProfile   = DiagnosticCode{"E013", "duplicate-profile"}
+	CodeInvalidPort        = DiagnosticCode{"E014", "invalid-port"}
+	CodeUnknownPort        = DiagnosticCode{"E015", "unknown-port"}
+	CodeInvalidMarkup      = DiagnosticCode{"E016", "invalid-label-markup"}
+	CodeAssertionFailed    = DiagnosticCode{"E017", "assertion-failed"}
+	CodeInvalidAssertion   = DiagnosticCode{"E018", "invalid-assertion"}
+
+	CodeSyntax           = DiagnosticCode{"E100", "syntax-error"}
+	CodeInvalidForm      = DiagnosticCode{"E101", "invalid-form"}
+	CodeInvalidCondition = DiagnosticCode{"E102", "invalid-condition"}
+)
+
+// RelatedLocation points at another place in the source that explains a
+// diagnostic, such as the first definition of a duplicate ID
+type RelatedLocation struct {
+	Span    Span
+	Message string
+}
+
+// Diagnostic is a problem found in a diagram, with its location and the
+// locations related to it
+type Diagnostic struct {
+	Severity Severity
+	Code     DiagnosticCode
+	Message  string
+	Span     Span
+	Related  []RelatedLocation
+}
+
+// Error renders the diagnostic for the terminal: the location, severity
+// and code, the offending line with a caret, and a note for each related
+// location
+func (d Diagnostic) Error() string {
+	header := d.Severity.String()
+	if d.Code.ID != "" {
+		header += "[" + d.Code.ID + "]"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(formatSourceMessage(d.Span, header+": "+d.Message))
+	for _, related := range d.Related {
+		sb.WriteString("\n")
+		sb.WriteString(formatSourceMessage(related.Span, "note: "+related.Message))
+	}
+	return sb.String()
+}
+
+// Diagnostic returns the error as a diagnostic. Errors recorded without a
+// code are problems with the forms of the file.
+func (e *SourceError) Diagnostic() Diagnostic {
+	code := e.Code
+	if code.ID == "" && e.Span.IsValid() {
+		code = CodeInvalidForm
+	}
+	return Diagnostic{Code: code, Message: e.Message, Span: e.Span}
+}
+
+// DiagnosticsOf returns the diagnostics held by err, which may wrap an
+// ErrorList, ValidationErrors or a single error. Other errors become a
+// single diagnostic without a code or location.
+func DiagnosticsOf(err error) []Diagnostic {
+	if err == nil {
+		return nil
+	}
+
+	var list ErrorList
+	if errors.As(err, &list) {
+		diagnostics := make([]Diagnostic, len(list))
+		for i, e := range list {
+			diagnostics[i] = e.Diagnostic()
+		}
+		return diagnostics
+	}
+	var validation ValidationErrors
+	if errors.As(err, &validation) {
+		diagnostics := make([]Diagnostic, len(validation))
+		for i, e := range validation {
+			diagnostics[i] = e.Diagnostic()
+		}
+		return diagnostics
+	}
+	var sourceErr *SourceError
+	if errors.As(err, &sourceErr) {
+		return []Diagnostic{sourceErr.Diagnostic()}
+	}
+	return []Diagnostic{{Message: err.Error()}}
+}
+
+// WriteDiagnostics writes diagnostics for the terminal, followed by a
+// count of each severity
+func WriteDiagnostics(w io.Writer, diagnostics []Diagnostic) {
+	counts := make(map[Severity]int)
+	for _, d := range diagnostics {
+		fmt.Fprintln(w, d.Error())
+		counts[d.Severity]++
+	}
+
+	var parts []string
+	for _, severity := range []Severity{SeverityError, SeverityWarning, SeverityInfo} {
+		switch n := counts[severity]; n {
+		case 0:
+		case 1:
+			parts = append(parts, fmt.Sprintf("1 %s", severity))
+		default:
+			parts = append(parts, fmt.Sprintf("%d %ss", n, severity))
+		}
+	}
+	if len(parts) > 0 {
+		fmt.Fprintln(w, strings.Join(parts, ", "))
+	}
+}
+
+// jsonDiagnostic is the JSON form of a Diagnostic. Lines and columns are
+// 1-based, columns counting characters; offsets are 0-based byte offsets.
+type jsonDiagnostic struct {
+	Severity string        `json:"severity"`
+	Code     string        `json:"code,omitempty"`
+	Name     string        `json:"name,omitempty"`
+	Message  string        `json:"message"`
+	File     string        `json:"file,omitempty"`
+	Range    *jsonRange    `json:"range,omitempty"`
+	Related  []jsonRelated `json:"related,omitempty"`
+}
+
+type jsonRelated struct {
+	Message string     `json:"message"`
+	File    string     `json:"file,omitempty"`
+	Range   *jsonRange `json:"range,omitempty"`
+}
+
+type jsonRange struct {
+	Start jsonPos `json:"start"`
+	End   jsonPos `json:"end"`
+}
+
+type jsonPos struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Offset int `json:"offset"`
+}
+
+// jsonLocation returns the file and range of span, if it has one
+func jsonLocation(span Span) (string, *jsonRange) {
+	if !span.IsValid() {
+		return "", nil
+	}
+	end := span.End
+	if !end.IsValid() {
+		end = span.Start
+	}
+	return span.Start.Filename(), &jsonRange{
+		Start: jsonPos{Line: span.Start.Line, Column: span.Start.Column, Offset: span.Start.Offset},
+		End:   jsonPos{Line: end.Line, Column: end.Column, Offset: end.Offset},
+	}
+}
+
+// WriteDiagnosticsJSON writes diagnostics as a JSON array, for editors
+// and CI tools to annotate the source with
+func WriteDiagnosticsJSON(w io.Writer, diagnostics []Diagnostic) error {
+	out := make([]jsonDiagnostic, len(diagnostics))
+	for i, d := range diagnostics {
+		out[i] = jsonDiagnostic{
+			Severity: d.Severity.String(),
+			Code:     d.Code.ID,
+			Name:     d.Code.Name,
+			Message:  d.Message,
+		}
+		out[i].File, out[i].Range = jsonLocation(d.Span)
+		for _, related := range d.Related {
+			r := jsonRelated{Message: related.Message}
+			r.File, r.Range = jsonLocation(related.Span)
+			out[i].Related = append(out[i].Related, r)
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
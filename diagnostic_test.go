@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// diagnosticsFor parses and validates input and returns the diagnostics
+// of the first stage that fails
+func diagnosticsFor(t *testing.T, input string) []Diagnostic {
+	t.Helper()
+	diagram, err := NewParser(NewFileLexer("test.sxd", input)).ParseDiagram()
+	if err != nil {
+		return DiagnosticsOf(err)
+	}
+	return DiagnosticsOf(NewValidator().Validate(diagram))
+}
+
+// TestDiagnosticCodes tests that the parser and validator classify their
+// problems
+func TestDiagnosticCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []DiagnosticCode
+	}{
+		{"syntax", `(diagram (nodes (id "A"`, []DiagnosticCode{CodeSyntax, CodeSyntax, CodeSyntax}},
+		{"invalid form", `(diagram (size "wide" 2))`, []DiagnosticCode{CodeInvalidForm}},
+		{"duplicate node", `(diagram (nodes (id "A") (id "A")))`, []DiagnosticCode{CodeDuplicateNodeID}},
+		{
+			"edges",
+			`(diagram (nodes (id "A" :ports ("n"))) (edges ("A" "B") ("A" "A" :from-port "x" :class "c")))`,
+			[]DiagnosticCode{CodeUnknownEndpoint, CodeUnknownClass, CodeInvalidPort, CodeUnknownPort},
+		},
+		{
+			"attributes",
+			`(diagram (nodes (id "A" :colour "red" :dir "back" :opacity "half" :shape "star" :label "[x]{y=1}")))`,
+			[]DiagnosticCode{CodeUnknownAttribute, CodeMisplacedAttribute, CodeInvalidValue, CodeInvalidValue, CodeInvalidMarkup},
+		},
+		{
+			"definitions",
+			`(diagram (defclass "node") (defclass "1x") (defclass "c") (defclass "c") (profile "p") (profile "p")
+			   (nodes (id "g")) (group "g") (group "h") (group "h"))`,
+			[]DiagnosticCode{CodeGroupIDConflict, CodeDuplicateGroupID, CodeReservedClass, CodeInvalidClassName, CodeDuplicateClass, CodeDuplicateProfile},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagnostics := diagnosticsFor(t, tt.input)
+			var codes []DiagnosticCode
+			for _, d := range diagnostics {
+				codes = append(codes, d.Code)
+				if d.Severity != SeverityError {
+					t.Errorf("Expected error severity, got %s", d.Severity)
+				}
+			}
+			if fmt.Sprint(codes) != fmt.Sprint(tt.expected) {
+				t.Errorf("Expected codes %v, got %v: %v", tt.expected, codes, diagnostics)
+			}
+		})
+	}
+}
+
+// TestDiagnosticRelated tests the related locations of duplicates
+func TestDiagnosticRelated(t *testing.T) {
+	diagnostics := diagnosticsFor(t, "(diagram\n  (nodes\n    (id \"A\")\n    (id \"A\")))")
+	if len(diagnostics) != 1 {
+		t.Fatalf("Expected 1 diagnostic, got %v", diagnostics)
+	}
+
+	expected := `test.sxd:4:5: error[E001]: duplicate node ID: A
+        (id "A")))
+        ^
+test.sxd:3:5: note: first defined here
+        (id "A")
+        ^`
+	if diagnostics[0].Error() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, diagnostics[0].Error())
+	}
+}
+
+// TestDiagnosticsOf tests extracting diagnostics from wrapped errors
+func TestDiagnosticsOf(t *testing.T) {
+	if DiagnosticsOf(nil) != nil {
+		t.Errorf("Expected no diagnostics for nil")
+	}
+
+	plain := DiagnosticsOf(errors.New("failed to read input file"))
+	if len(plain) != 1 || plain[0].Message != "failed to read input file" || plain[0].Code.ID != "" || plain[0].Span.IsValid() {
+		t.Errorf("Unexpected diagnostics for a plain error: %+v", plain)
+	}
+
+	_, err := NewParser(NewLexer(`(diagram (nodes (id "A" :label)))`)).ParseDiagram()
+	wrapped := DiagnosticsOf(fmt.Errorf("parsing failed: %w", err))
+	if len(wrapped) != 1 || wrapped[0].Code != CodeInvalidForm || !wrapped[0].Span.IsValid() {
+		t.Errorf("Unexpected diagnostics for a wrapped parse error: %+v", wrapped)
+	}
+}
+
+// TestWriteDiagnostics tests the terminal rendering and its summary
+func TestWriteDiagnostics(t *testing.T) {
+	var sb strings.Builder
+	WriteDiagnostics(&sb, []Diagnostic{
+		{Message: "broken"},
+		{Severity: SeverityWarning, Code: DiagnosticCode{"W001", "odd"}, Message: "odd"},
+		{Severity: SeverityWarning, Message: "odder"},
+	})
+	expected := "error: broken\nwarning[W001]: odd\nwarning: odder\n1 error, 2 warnings\n"
+	if sb.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, sb.String())
+	}
+}
+
+// TestWriteDiagnosticsJSON tests the JSON output read by editors
+func TestWriteDiagnosticsJSON(t *testing.T) {
+	diagnostics := diagnosticsFor(t, "(diagram\n  (nodes (id \"A\") (id \"A\")))")
+
+	var sb strings.Builder
+	if err := WriteDiagnosticsJSON(&sb, diagnostics); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var decoded []map[string]any
+	if err := json.Unmarshal([]byte(sb.String()), &decoded); err != nil {
+		t.Fatalf("Invalid JSON: %v\n%s", err, sb.String())
+	}
+	if len(decoded) != 1 {
+		t.Fatalf("Expected 1 diagnostic, got %s", sb.String())
+	}
+	d := decoded[0]
+	if d["severity"] != "error" || d["code"] != "E001" || d["name"] != "duplicate-node-id" || d["file"] != "test.sxd" {
+		t.Errorf("Unexpected diagnostic: %s", sb.String())
+	}
+	start := d["range"].(map[string]any)["start"].(map[string]any)
+	if start["line"] != 2.0 || start["column"] != 19.0 {
+		t.Errorf("Expected range to start at 2:19, got %v", start)
+	}
+	related := d["related"].([]any)[0].(map[string]any)
+	if related["message"] != "first defined here" {
+		t.Errorf("Unexpected related location: %v", related)
+	}
+
+	sb.Reset()
+	if err := WriteDiagnosticsJSON(&sb, nil); err != nil || sb.String() != "[]\n" {
+		t.Errorf("Expected an empty list, got %q, %v", sb.String(), err)
+	}
+}
@@ -0,0 +1,866 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Evaluator runs the optional evaluation stage that expands a program
+// into plain diagram forms before interpretation. Lists headed by a
+// special form, a builtin or a defined procedure are evaluated; any other
+// list is data and is rebuilt from its evaluated elements, so
+//
+//	(nodes (map (lambda (i) (id (str "shard" i))) (range 3)))
+//
+// becomes (nodes (id "shard0") (id "shard1") (id "shard2")). Lists
+// produced by list, map and range are spliced into a surrounding form
+// headed by a symbol, except directly after a keyword. Elsewhere, as in
+// the endpoints of an edge form, they stay a single list value.
+//
+// Evaluation has no access to files or the environment, and MaxSteps and
+// MaxDepth bound the work a program can do.
+type Evaluator struct {
+	MaxSteps int
+	MaxDepth int
+
+	steps   int
+	depth   int
+	aborted bool
+	errors  ErrorList
+}
+
+// Default evaluation limits
+const (
+	DefaultMaxSteps = 100000
+	DefaultMaxDepth = 200
+
+	// maxStringLength caps the strings str can build
+	maxStringLength = 1 << 16
+)
+
+func NewEvaluator() *Evaluator {
+	return &Evaluator{
+		MaxSteps: DefaultMaxSteps,
+		MaxDepth: DefaultMaxDepth,
+	}
+}
+
+// object is a value during evaluation: a Value, a sequence or a *procedure
+type object interface{}
+
+// sequence is a list built by evaluation, spliced into data forms
+type sequence []object
+
+// procedure is a function defined with lambda or define, or a builtin
+type procedure struct {
+	name    string
+	params  []string
+	body    []Value
+	env     *environment
+	builtin func(ev *Evaluator, args []object, span Span) (object, error)
+}
+
+func (p *procedure) describe() string {
+	if p.name == "" {
+		return "procedure"
+	}
+	return "procedure " + p.name
+}
+
+// environment is a lexical scope of variable bindings
+type environment struct {
+	vars   map[string]object
+	parent *environment
+}
+
+func newEnvironment(parent *environment) *environment {
+	return &environment{vars: make(map[string]object), parent: parent}
+}
+
+func (e *environment) lookup(name string) (object, bool) {
+	for env := e; env != nil; env = env.parent {
+		if obj, ok := env.vars[name]; ok {
+			return obj, true
+		}
+	}
+	return nil, false
+}
+
+// builtins holds the procedures available to every program. It is filled
+// in by init because map applies procedures, which refers back to it.
+var builtins map[string]*procedure
+
+func init() {
+	builtins = map[string]*procedure{
+		"+":     {builtin: arithmetic("+")},
+		"-":     {builtin: arithmetic("-")},
+		"*":     {builtin: arithmetic("*")},
+		"/":     {builtin: arithmetic("/")},
+		"mod":   {builtin: builtinMod},
+		"=":     {builtin: builtinEqual},
+		"<":     {builtin: comparison("<")},
+		">":     {builtin: comparison(">")},
+		"<=":    {builtin: comparison("<=")},
+		">=":    {builtin: comparison(">=")},
+		"not":   {builtin: builtinNot},
+		"str":   {builtin: builtinStr},
+		"list":  {builtin: builtinList},
+		"range": {builtin: builtinRange},
+		"map":   {builtin: builtinMap},
+	}
+	for name, proc := range builtins {
+		proc.name = name
+	}
+}
+
+// specialForms are evaluated without evaluating their arguments first
+var specialForms = map[string]bool{
+	"define": true,
+	"let":    true,
+	"lambda": true,
+	"if":     true,
+}
+
+// Eval evaluates forms in a fresh environment shared between them and
+// returns the resulting data. Errors inside one element of a top-level
+// form are reported and the element dropped; exceeding a limit stops
+// evaluation.
+func (ev *Evaluator) Eval(forms ...Value) ([]Value, error) {
+	ev.steps = 0
+	ev.depth = 0
+	ev.aborted = false
+	ev.errors = nil
+
+	env := newEnvironment(nil)
+	var values []Value
+	for _, form := range forms {
+		if ev.aborted {
+			break
+		}
+		obj, err := ev.evalTop(form, env)
+		if err != nil {
+			ev.errors.Add(err)
+			continue
+		}
+		values, err = ev.appendData(values, obj, false, form.Span)
+		ev.errors.Add(err)
+	}
+	return values, ev.errors.Err()
+}
+
+// evalTop evaluates a top-level form, recovering from errors in each of
+// its elements when it is data
+func (ev *Evaluator) evalTop(form Value, env *environment) (object, error) {
+	if form.Kind != ValueList || len(form.List) == 0 || form.List[0].Kind != ValueSymbol || ev.isOperator(form.List[0].Text, env) {
+		return ev.eval(form, env)
+	}
+
+	data := Value{Kind: ValueList, List: []Value{}, Span: form.Span}
+	for i, elem := range form.List {
+		if ev.aborted {
+			break
+		}
+		obj, err := ev.eval(elem, env)
+		if err == nil {
+			data.List, err = ev.appendData(data.List, obj, afterKeyword(form, i), elem.Span)
+		}
+		ev.errors.Add(err)
+	}
+	return data, nil
+}
+
+// isOperator reports whether name calls a procedure or special form
+func (ev *Evaluator) isOperator(name string, env *environment) bool {
+	if _, ok := env.lookup(name); ok {
+		return true
+	}
+	return specialForms[name] || builtins[name] != nil
+}
+
+// step counts one unit of work against the step limit
+func (ev *Evaluator) step(span Span) error {
+	ev.steps++
+	if ev.steps > ev.MaxSteps {
+		ev.aborted = true
+		return newSourceError(span, "evaluation exceeded the limit of %d steps", ev.MaxSteps)
+	}
+	return nil
+}
+
+// eval evaluates an expression. Symbols bound by define, let or lambda
+// evaluate to their value; other symbols are data and evaluate to
+// themselves.
+func (ev *Evaluator) eval(v Value, env *environment) (object, error) {
+	if err := ev.step(v.Span); err != nil {
+		return nil, err
+	}
+
+	switch v.Kind {
+	case ValueSymbol:
+		if obj, ok := env.lookup(v.Text); ok {
+			if value, ok := obj.(Value); ok && value.Kind != ValueList {
+				// Point errors about the value at its use
+				value.Span = v.Span
+				return value, nil
+			}
+			return obj, nil
+		}
+		return v, nil
+	case ValueList:
+		return ev.evalList(v, env)
+	default:
+		return v, nil
+	}
+}
+
+// evalArgument evaluates an argument of a procedure call, where builtin
+// names also refer to the builtin procedures
+func (ev *Evaluator) evalArgument(v Value, env *environment) (object, error) {
+	if v.Kind == ValueSymbol {
+		if _, ok := env.lookup(v.Text); !ok {
+			if proc, ok := builtins[v.Text]; ok {
+				return proc, ev.step(v.Span)
+			}
+		}
+	}
+	return ev.eval(v, env)
+}
+
+func (ev *Evaluator) evalList(v Value, env *environment) (object, error) {
+	if len(v.List) == 0 {
+		return v, nil
+	}
+
+	head := v.List[0]
+	if head.Kind == ValueSymbol {
+		if obj, ok := env.lookup(head.Text); ok {
+			proc, ok := obj.(*procedure)
+			if !ok {
+				return nil, newSourceError(head.Span, "%s is not a procedure", head.Text)
+			}
+			return ev.call(proc, v, env)
+		}
+		switch head.Text {
+		case "define":
+			return ev.evalDefine(v, env)
+		case "let":
+			return ev.evalLet(v, env)
+		case "lambda":
+			return ev.evalLambda(v, env)
+		case "if":
+			return ev.evalIf(v, env)
+		}
+		if proc, ok := builtins[head.Text]; ok {
+			return ev.call(proc, v, env)
+		}
+	}
+
+	// Anything else is data: evaluate the head too, which may yield a
+	// procedure for ((lambda (x) ...) 1)
+	var first object = head
+	if head.Kind == ValueList {
+		obj, err := ev.eval(head, env)
+		if err != nil {
+			return nil, err
+		}
+		if proc, ok := obj.(*procedure); ok {
+			return ev.call(proc, v, env)
+		}
+		first = obj
+	}
+
+	// Computed lists are spliced into directive-like forms such as
+	// (nodes ...), but stay whole inside edge forms, where a list is a
+	// fan-out or fan-in
+	splice := head.Kind == ValueSymbol
+	data := Value{Kind: ValueList, Span: v.Span}
+	var err error
+	data.List, err = ev.appendData([]Value{}, first, !splice, head.Span)
+	if err != nil {
+		return nil, err
+	}
+	for i, elem := range v.List[1:] {
+		obj, err := ev.eval(elem, env)
+		if err != nil {
+			return nil, err
+		}
+		data.List, err = ev.appendData(data.List, obj, !splice || afterKeyword(v, i+1), elem.Span)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// afterKeyword reports whether element i of form follows a keyword
+func afterKeyword(form Value, i int) bool {
+	return i > 0 && form.List[i-1].Kind == ValueKeyword
+}
+
+// appendData appends an evaluation result to a data form. Sequences are
+// spliced unless keep is set, in which case they become a single list.
+func (ev *Evaluator) appendData(list []Value, obj object, keep bool, span Span) ([]Value, error) {
+	if seq, ok := obj.(sequence); ok && !keep {
+		for _, elem := range seq {
+			if err := ev.step(span); err != nil {
+				return list, err
+			}
+			value, err := ev.toData(elem, span)
+			if err != nil {
+				return list, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	}
+
+	value, err := ev.toData(obj, span)
+	if err != nil {
+		return list, err
+	}
+	return append(list, value), nil
+}
+
+// toData converts an evaluation result to a Value. Lists may share their
+// elements, so that a few steps can build one far larger than the steps
+// taken; each element written out counts as a step.
+func (ev *Evaluator) toData(obj object, span Span) (Value, error) {
+	switch o := obj.(type) {
+	case Value:
+		return o, nil
+	case sequence:
+		list := Value{Kind: ValueList, List: make([]Value, len(o)), Span: span}
+		for i, elem := range o {
+			if err := ev.step(span); err != nil {
+				return Value{}, err
+			}
+			value, err := ev.toData(elem, span)
+			if err != nil {
+				return Value{}, err
+			}
+			list.List[i] = value
+		}
+		return list, nil
+	case *procedure:
+		return Value{}, newSourceError(span, "cannot use %s as data", o.describe())
+	default:
+		return Value{}, newSourceError(span, "cannot use %v as data", obj)
+	}
+}
+
+// call evaluates the arguments of form and applies proc to them
+func (ev *Evaluator) call(proc *procedure, form Value, env *environment) (object, error) {
+	args := make([]object, 0, len(form.List)-1)
+	for _, arg := range form.List[1:] {
+		obj, err := ev.evalArgument(arg, env)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, obj)
+	}
+	return ev.apply(proc, args, form.Span)
+}
+
+func (ev *Evaluator) apply(proc *procedure, args []object, span Span) (object, error) {
+	if proc.builtin != nil {
+		return proc.builtin(ev, args, span)
+	}
+	if len(args) != len(proc.params) {
+		return nil, newSourceError(span, "%s expects %d arguments, got %d", proc.describe(), len(proc.params), len(args))
+	}
+
+	ev.depth++
+	defer func() { ev.depth-- }()
+	if ev.depth > ev.MaxDepth {
+		ev.aborted = true
+		return nil, newSourceError(span, "evaluation exceeded the maximum call depth of %d", ev.MaxDepth)
+	}
+
+	env := newEnvironment(proc.env)
+	for i, param := range proc.params {
+		env.vars[param] = args[i]
+	}
+	return ev.evalBody(proc.body, env)
+}
+
+// evalBody evaluates expressions in order and returns the last result
+func (ev *Evaluator) evalBody(body []Value, env *environment) (object, error) {
+	var result object = sequence{}
+	for _, expr := range body {
+		obj, err := ev.eval(expr, env)
+		if err != nil {
+			return nil, err
+		}
+		result = obj
+	}
+	return result, nil
+}
+
+// evalDefine handles (define name value) and (define (name params...) body...).
+// It binds in the current scope and evaluates to nothing.
+func (ev *Evaluator) evalDefine(form Value, env *environment) (object, error) {
+	if len(form.List) < 3 {
+		return nil, newSourceError(elementSpan(form, len(form.List)), "expected name and value after define, got %s", describeElement(form, len(form.List)))
+	}
+
+	target := form.List[1]
+	switch target.Kind {
+	case ValueSymbol:
+		if len(form.List) > 3 {
+			return nil, newSourceError(form.List[3].Span, "expected ')', got %s", form.List[3].describe())
+		}
+		obj, err := ev.evalArgument(form.List[2], env)
+		if err != nil {
+			return nil, err
+		}
+		if proc, ok := obj.(*procedure); ok && proc.name == "" {
+			proc.name = target.Text
+		}
+		env.vars[target.Text] = obj
+	case ValueList:
+		if len(target.List) == 0 || target.List[0].Kind != ValueSymbol {
+			return nil, newSourceError(elementSpan(target, 0), "expected procedure name, got %s", describeElement(target, 0))
+		}
+		params, err := parameterNames(target.List[1:])
+		if err != nil {
+			return nil, err
+		}
+		name := target.List[0].Text
+		env.vars[name] = &procedure{name: name, params: params, body: form.List[2:], env: env}
+	default:
+		return nil, newSourceError(target.Span, "expected name after define, got %s", target.describe())
+	}
+	return sequence{}, nil
+}
+
+// evalLet handles (let ((name value) ...) body...). Bindings are evaluated
+// in order and may refer to earlier ones.
+func (ev *Evaluator) evalLet(form Value, env *environment) (object, error) {
+	if len(form.List) < 2 || form.List[1].Kind != ValueList {
+		return nil, newSourceError(elementSpan(form, 1), "expected binding list, got %s", describeElement(form, 1))
+	}
+
+	scope := newEnvironment(env)
+	for _, binding := range form.List[1].List {
+		if binding.Kind != ValueList || len(binding.List) != 2 || binding.List[0].Kind != ValueSymbol {
+			return nil, newSourceError(binding.Span, "expected (name value) binding, got %s", binding.describe())
+		}
+		obj, err := ev.evalArgument(binding.List[1], scope)
+		if err != nil {
+			return nil, err
+		}
+		scope.vars[binding.List[0].Text] = obj
+	}
+	return ev.evalBody(form.List[2:], scope)
+}
+
+// evalLambda handles (lambda (params...) body...)
+func (ev *Evaluator) evalLambda(form Value, env *environment) (object, error) {
+	if len(form.List) < 2 || form.List[1].Kind != ValueList {
+		return nil, newSourceError(elementSpan(form, 1), "expected parameter list, got %s", describeElement(form, 1))
+	}
+	params, err := parameterNames(form.List[1].List)
+	if err != nil {
+		return nil, err
+	}
+	return &procedure{params: params, body: form.List[2:], env: env}, nil
+}
+
+func parameterNames(values []Value) ([]string, error) {
+	params := make([]string, len(values))
+	for i, param := range values {
+		if param.Kind != ValueSymbol {
+			return nil, newSourceError(param.Span, "expected parameter name, got %s", param.describe())
+		}
+		params[i] = param.Text
+	}
+	return params, nil
+}
+
+// evalIf handles (if test then [else]). Only false is false; without an
+// else branch a false test evaluates to nothing.
+func (ev *Evaluator) evalIf(form Value, env *environment) (object, error) {
+	if len(form.List) < 3 || len(form.List) > 4 {
+		return nil, newSourceError(form.Span, "if expects 2 or 3 arguments, got %d", len(form.List)-1)
+	}
+
+	test, err := ev.evalArgument(form.List[1], env)
+	if err != nil {
+		return nil, err
+	}
+	if truthy(test) {
+		return ev.eval(form.List[2], env)
+	}
+	if len(form.List) == 4 {
+		return ev.eval(form.List[3], env)
+	}
+	return sequence{}, nil
+}
+
+func truthy(obj object) bool {
+	value, ok := obj.(Value)
+	return !ok || value.Kind != ValueBool || value.Bool
+}
+
+func intValue(n int64, span Span) Value {
+	return Value{Kind: ValueInt, Int: n, Text: strconv.FormatInt(n, 10), Span: span}
+}
+
+func floatValue(f float64, span Span) Value {
+	return Value{Kind: ValueFloat, Float: f, Text: strconv.FormatFloat(f, 'g', -1, 64), Span: span}
+}
+
+func boolValue(b bool, span Span) Value {
+	return Value{Kind: ValueBool, Bool: b, Text: strconv.FormatBool(b), Span: span}
+}
+
+// describeSteps bounds the elements of a list written out by
+// describeObject
+const describeSteps = 1000
+
+// describeObject renders an evaluation result for error messages
+func describeObject(obj object) string {
+	switch o := obj.(type) {
+	case Value:
+		return o.describe()
+	case *procedure:
+		return o.describe()
+	case sequence:
+		// Bounded separately, so describing a huge list cannot exhaust
+		// the steps or the memory
+		value, err := (&Evaluator{MaxSteps: describeSteps}).toData(o, Span{})
+		if err != nil {
+			return "list"
+		}
+		return value.describe()
+	default:
+		return fmt.Sprint(obj)
+	}
+}
+
+// number returns a numeric argument as a float, and whether it is an integer
+func number(name string, obj object, span Span) (float64, bool, error) {
+	if value, ok := obj.(Value); ok {
+		switch value.Kind {
+		case ValueInt:
+			return float64(value.Int), true, nil
+		case ValueFloat:
+			return value.Float, false, nil
+		}
+	}
+	return 0, false, newSourceError(span, "%s expects numbers, got %s", name, describeObject(obj))
+}
+
+// arithmetic creates a builtin for + - * /. The result is an integer when
+// all arguments are integers and, for division, the quotient is exact.
+func arithmetic(op string) func(ev *Evaluator, args []object, span Span) (object, error) {
+	return func(ev *Evaluator, args []object, span Span) (object, error) {
+		if len(args) == 0 && (op == "-" || op == "/") {
+			return nil, newSourceError(span, "%s expects at least 1 argument", op)
+		}
+
+		var ints []int64
+		var floats []float64
+		exact := true
+		for _, arg := range args {
+			f, isInt, err := number(op, arg, span)
+			if err != nil {
+				return nil, err
+			}
+			if isInt {
+				ints = append(ints, arg.(Value).Int)
+			}
+			exact = exact && isInt
+			floats = append(floats, f)
+		}
+
+		if op == "/" {
+			if len(floats) == 1 {
+				ints = append([]int64{1}, ints...)
+				floats = append([]float64{1}, floats...)
+			}
+			for _, divisor := range floats[1:] {
+				if divisor == 0 {
+					return nil, newSourceError(span, "division by zero")
+				}
+			}
+			if exact {
+				quotient := ints[0]
+				for _, divisor := range ints[1:] {
+					if quotient%divisor != 0 {
+						exact = false
+						break
+					}
+					quotient /= divisor
+				}
+				if exact {
+					return intValue(quotient, span), nil
+				}
+			}
+		}
+
+		if exact {
+			return intValue(foldInts(op, ints), span), nil
+		}
+		result := foldFloats(op, floats)
+		if math.IsInf(result, 0) || math.IsNaN(result) {
+			return nil, newSourceError(span, "%s: result is not a finite number", op)
+		}
+		return floatValue(result, span), nil
+	}
+}
+
+func foldInts(op string, ns []int64) int64 {
+	switch op {
+	case "+":
+		var sum int64
+		for _, n := range ns {
+			sum += n
+		}
+		return sum
+	case "*":
+		var product int64 = 1
+		for _, n := range ns {
+			product *= n
+		}
+		return product
+	default: // "-"
+		if len(ns) == 1 {
+			return -ns[0]
+		}
+		result := ns[0]
+		for _, n := range ns[1:] {
+			result -= n
+		}
+		return result
+	}
+}
+
+func foldFloats(op string, fs []float64) float64 {
+	switch op {
+	case "+":
+		var sum float64
+		for _, f := range fs {
+			sum += f
+		}
+		return sum
+	case "*":
+		product := 1.0
+		for _, f := range fs {
+			product *= f
+		}
+		return product
+	case "-":
+		if len(fs) == 1 {
+			return -fs[0]
+		}
+		result := fs[0]
+		for _, f := range fs[1:] {
+			result -= f
+		}
+		return result
+	default: // "/"
+		result := fs[0]
+		for _, f := range fs[1:] {
+			result /= f
+		}
+		return result
+	}
+}
+
+func builtinMod(ev *Evaluator, args []object, span Span) (object, error) {
+	if len(args) != 2 {
+		return nil, newSourceError(span, "mod expects 2 arguments, got %d", len(args))
+	}
+	a, b, err := intArguments("mod", args, span)
+	if err != nil {
+		return nil, err
+	}
+	if b == 0 {
+		return nil, newSourceError(span, "division by zero")
+	}
+	return intValue(a%b, span), nil
+}
+
+// intArguments returns the two integer arguments of a builtin
+func intArguments(name string, args []object, span Span) (int64, int64, error) {
+	var ns [2]int64
+	for i, arg := range args[:2] {
+		value, ok := arg.(Value)
+		if !ok || value.Kind != ValueInt {
+			return 0, 0, newSourceError(span, "%s expects integers, got %s", name, describeObject(arg))
+		}
+		ns[i] = value.Int
+	}
+	return ns[0], ns[1], nil
+}
+
+func builtinEqual(ev *Evaluator, args []object, span Span) (object, error) {
+	if len(args) < 2 {
+		return nil, newSourceError(span, "= expects at least 2 arguments, got %d", len(args))
+	}
+	for _, arg := range args[1:] {
+		equal, err := ev.objectsEqual(args[0], arg, span)
+		if err != nil {
+			return nil, err
+		}
+		if !equal {
+			return boolValue(false, span), nil
+		}
+	}
+	return boolValue(true, span), nil
+}
+
+// objectsEqual compares numbers by value and other data by its rendering
+func (ev *Evaluator) objectsEqual(a, b object, span Span) (bool, error) {
+	fa, _, errA := number("=", a, Span{})
+	fb, _, errB := number("=", b, Span{})
+	if errA == nil && errB == nil {
+		return fa == fb, nil
+	}
+	va, errA := ev.toData(a, span)
+	vb, errB := ev.toData(b, span)
+	if ev.aborted {
+		// Running out of steps is an error; procedures just differ
+		if errA != nil {
+			return false, errA
+		}
+		return false, errB
+	}
+	return errA == nil && errB == nil && va.Kind == vb.Kind && va.String() == vb.String(), nil
+}
+
+// comparison creates a builtin comparing numbers pairwise
+func comparison(op string) func(ev *Evaluator, args []object, span Span) (object, error) {
+	return func(ev *Evaluator, args []object, span Span) (object, error) {
+		if len(args) < 2 {
+			return nil, newSourceError(span, "%s expects at least 2 arguments, got %d", op, len(args))
+		}
+		result := true
+		prev, _, err := number(op, args[0], span)
+		if err != nil {
+			return nil, err
+		}
+		for _, arg := range args[1:] {
+			next, _, err := number(op, arg, span)
+			if err != nil {
+				return nil, err
+			}
+			switch op {
+			case "<":
+				result = result && prev < next
+			case ">":
+				result = result && prev > next
+			case "<=":
+				result = result && prev <= next
+			case ">=":
+				result = result && prev >= next
+			}
+			prev = next
+		}
+		return boolValue(result, span), nil
+	}
+}
+
+func builtinNot(ev *Evaluator, args []object, span Span) (object, error) {
+	if len(args) != 1 {
+		return nil, newSourceError(span, "not expects 1 argument, got %d", len(args))
+	}
+	return boolValue(!truthy(args[0]), span), nil
+}
+
+// builtinStr concatenates its arguments; strings contribute their
+// contents and other values their source form
+func builtinStr(ev *Evaluator, args []object, span Span) (object, error) {
+	var sb strings.Builder
+	for _, arg := range args {
+		value, err := ev.toData(arg, span)
+		if err != nil {
+			return nil, err
+		}
+		if value.Kind == ValueString || value.Kind == ValueSymbol {
+			sb.WriteString(value.Text)
+		} else {
+			sb.WriteString(value.String())
+		}
+		if sb.Len() > maxStringLength {
+			return nil, newSourceError(span, "str: result is longer than %d bytes", maxStringLength)
+		}
+	}
+	return Value{Kind: ValueString, Text: sb.String(), Span: span}, nil
+}
+
+func builtinList(ev *Evaluator, args []object, span Span) (object, error) {
+	return sequence(args), nil
+}
+
+// builtinRange handles (range end), (range start end) and
+// (range start end step)
+func builtinRange(ev *Evaluator, args []object, span Span) (object, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return nil, newSourceError(span, "range expects 1 to 3 arguments, got %d", len(args))
+	}
+
+	bounds := []int64{0, 0, 1}
+	for i, arg := range args {
+		value, ok := arg.(Value)
+		if !ok || value.Kind != ValueInt {
+			return nil, newSourceError(span, "range expects integers, got %s", describeObject(arg))
+		}
+		bounds[i] = value.Int
+	}
+	if len(args) == 1 {
+		bounds[0], bounds[1] = 0, bounds[0]
+	}
+	start, end, step := bounds[0], bounds[1], bounds[2]
+	if step == 0 {
+		return nil, newSourceError(span, "range step cannot be zero")
+	}
+
+	seq := sequence{}
+	for n := start; (step > 0 && n < end) || (step < 0 && n > end); n += step {
+		if err := ev.step(span); err != nil {
+			return nil, err
+		}
+		seq = append(seq, intValue(n, span))
+	}
+	return seq, nil
+}
+
+// builtinMap handles (map procedure list)
+func builtinMap(ev *Evaluator, args []object, span Span) (object, error) {
+	if len(args) != 2 {
+		return nil, newSourceError(span, "map expects 2 arguments, got %d", len(args))
+	}
+	proc, ok := args[0].(*procedure)
+	if !ok {
+		return nil, newSourceError(span, "map expects a procedure, got %s", describeObject(args[0]))
+	}
+
+	var items []object
+	switch list := args[1].(type) {
+	case sequence:
+		items = list
+	case Value:
+		if list.Kind != ValueList {
+			return nil, newSourceError(span, "map expects a list, got %s", list.describe())
+		}
+		for _, elem := range list.List {
+			items = append(items, elem)
+		}
+	default:
+		return nil, newSourceError(span, "map expects a list, got %s", describeObject(args[1]))
+	}
+
+	result := make(sequence, 0, len(items))
+	for _, item := range items {
+		obj, err := ev.apply(proc, []object{item}, span)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, obj)
+	}
+	return result, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// evalString evaluates input and renders the results as source
+func evalString(t *testing.T, input string) (string, error) {
+	t.Helper()
+
+	forms, err := NewReader(NewLexer(input)).ReadAll()
+	if err != nil {
+		t.Fatalf("Unexpected read error: %v", err)
+	}
+	values, err := NewEvaluator().Eval(forms...)
+
+	rendered := make([]string, len(values))
+	for i, value := range values {
+		rendered[i] = value.String()
+	}
+	return strings.Join(rendered, " "), err
+}
+
+// TestEvaluator tests expressions and their expansion into data
+func TestEvaluator(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"data unchanged", `(nodes (id "A" :label "x") (id B))`, `(nodes (id "A" :label "x") (id B))`},
+		{"arithmetic", `(size (* 100 8) (- 500 100))`, `(size 800 400)`},
+		{"exact division", `(x (/ 10 2) (/ 7 2) (/ 1.5))`, `(x 5 3.5 0.6666666666666666)`},
+		{"mod and negation", `(x (mod 7 3) (- 4))`, `(x 1 -4)`},
+		{"comparison", `(x (< 1 2 3) (>= 1 2) (= "a" "a") (= 1 1.0) (not false))`, `(x true false true true true)`},
+		{"str", `(id (str "shard" 1 "-" 2.5 :x sym))`, `(id "shard1-2.5:xsym")`},
+		{"define value", `(define n 3) (x n)`, `(x 3)`},
+		{"define procedure", `(define (double x) (* 2 x)) (x (double 21))`, `(x 42)`},
+		{"let", `(x (let ((a 1) (b (+ a 1))) (* a b)))`, `(x 2)`},
+		{"lambda call", `(x ((lambda (a b) (+ a b)) 1 2))`, `(x 3)`},
+		{"closure", `(define (adder n) (lambda (x) (+ x n))) (x ((adder 10) 5))`, `(x 15)`},
+		{"if", `(x (if (< 1 2) "yes" "no") (if false "no"))`, `(x "yes")`},
+		{"range", `(x (range 3) (range 2 4) (range 5 0 -2))`, `(x 0 1 2 2 3 5 3 1)`},
+		{"map splices into directive", `(nodes (map (lambda (i) (id (str "shard" i))) (range 3)))`,
+			`(nodes (id "shard0") (id "shard1") (id "shard2"))`},
+		{"map with builtin", `(x (map str (list 1 2)))`, `(x "1" "2")`},
+		{"list kept after keyword", `(id "A" :tags (list "db" "critical"))`, `(id "A" :tags ("db" "critical"))`},
+		{"fan-out kept whole", `(edges ("lb" (map (lambda (i) (str "s" i)) (range 2))))`, `(edges ("lb" ("s0" "s1")))`},
+		{"builtin names are data", `(id map)`, `(id map)`},
+		{"recursion", `(define (fact n) (if (<= n 1) 1 (* n (fact (- n 1))))) (x (fact 10))`, `(x 3628800)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := evalString(t, tt.input)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestEvaluatorErrors tests error messages and recovery
+func TestEvaluatorErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"not a number", `(x (+ 1 "a"))`, `1:4: + expects numbers, got "a"`},
+		{"division by zero", `(x (/ 1 0))`, "1:4: division by zero"},
+		{"arity", `(define (f a) a) (x (f 1 2))`, "1:21: procedure f expects 1 arguments, got 2"},
+		{"not a procedure", `(define n 1) (x (n 2))`, "1:18: n is not a procedure"},
+		{"procedure as data", `(x (lambda (a) a))`, "1:4: cannot use procedure as data"},
+		{"bad parameter", `(x (lambda ("a") 1))`, `1:13: expected parameter name, got "a"`},
+		{"bad binding", `(x (let ((a)) a))`, "1:10: expected (name value) binding, got (a)"},
+		{"bad if", `(x (if true))`, "1:4: if expects 2 or 3 arguments, got 1"},
+		{"range step", `(x (range 0 5 0))`, "1:4: range step cannot be zero"},
+		{"map list", `(x (map str 1))`, "1:4: map expects a list, got 1"},
+		{"step limit", `(x (range 1000000))`, "1:4: evaluation exceeded the limit of 100000 steps"},
+		{"doubling lists", `(define (d x) (list x x)) (x (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d 1)))))))))))))))))))))))))))))`,
+			"1:30: evaluation exceeded the limit of 100000 steps"},
+		{"doubling equality", `(define (d x) (list x x)) (x (= (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d (d 1)))))))))))))))))))))))))))) 1))`,
+			"evaluation exceeded the limit of 100000 steps"},
+		{"depth limit", `(define (loop n) (loop n)) (x (loop 1))`, "evaluation exceeded the maximum call depth of 200"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := evalString(t, tt.input)
+			if err == nil {
+				t.Fatalf("Expected error containing %q", tt.expected)
+			}
+			if !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error containing %q, got %q", tt.expected, err.Error())
+			}
+		})
+	}
+}
+
+// TestEvaluatorRecovery tests that a failing directive is dropped and the
+// rest of the diagram kept
+func TestEvaluatorRecovery(t *testing.T) {
+	result, err := evalString(t, `(diagram (size (+ 1 "x") 2) (nodes (id (str "a" 1))) (edges ("a1" (/ 1 0))))`)
+	if err == nil {
+		t.Fatalf("Expected errors")
+	}
+	if list, ok := err.(ErrorList); !ok || len(list) != 2 {
+		t.Errorf("Expected 2 errors, got %v", err)
+	}
+	if result != `(diagram (nodes (id "a1")))` {
+		t.Errorf("Unexpected result %s", result)
+	}
+}
+
+// TestParserEvaluation tests the evaluation stage through the parser
+func TestParserEvaluation(t *testing.T) {
+	input := `(diagram
+		(define replicas 3)
+		(define (replica i) (str "db" i))
+		(nodes
+			(id "primary")
+			(map (lambda (i) (id (replica i) :label (str "Replica " (+ i 1)))) (range replicas)))
+		(edges
+			("primary" (map replica (range replicas)))))`
+
+	parser := NewParser(NewLexer(input))
+	parser.SetEvaluator(NewEvaluator())
+	diagram, err := parser.ParseDiagram()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(diagram.Nodes) != 4 || diagram.Nodes[3].ID != "db2" || diagram.Nodes[3].Label != "Replica 3" {
+		t.Errorf("Unexpected nodes %+v", diagram.Nodes)
+	}
+	if len(diagram.Edges) != 3 || diagram.Edges[2].To != "db2" {
+		t.Errorf("Unexpected edges %+v", diagram.Edges)
+	}
+
+	// Without evaluation the same input is rejected
+	AssertParseError(t, input, "unknown directive: define (evaluation is not enabled)")
+}
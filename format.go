@@ -0,0 +1,528 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// SyntaxKind identifies the type of a Syntax node
+type SyntaxKind int
+
+const (
+	SyntaxList SyntaxKind = iota
+	SyntaxAtom
+	SyntaxComment
+)
+
+// Syntax is a node of the concrete syntax tree used by the formatter.
+// Unlike Value it keeps comments, blank lines and the spelling of atoms,
+// so source can be rewritten without losing anything but layout.
+type Syntax struct {
+	Kind SyntaxKind
+
+	// Text is the spelling of an atom or the text of a comment, starting
+	// with ';', '#|' or '#;'. Strings are kept as written; Value holds
+	// their contents.
+	Text     string
+	Value    Value
+	Children []*Syntax
+
+	// Blank is set when a blank line separates the node from the previous
+	// one; Comment holds a comment following it on the same line
+	Blank   bool
+	Comment string
+
+	Span Span
+}
+
+// FormatOptions controls Format
+type FormatOptions struct {
+	// Width is the line length lists are broken to fit in
+	Width int
+
+	// Sort orders the entries of nodes and edges forms by ID. Entries
+	// separated by blank lines are sorted separately.
+	Sort bool
+}
+
+// DefaultFormatWidth is the line length used when FormatOptions.Width is 0
+const DefaultFormatWidth = 80
+
+// blockForms are always written one element per line when they contain
+// lists, so diagrams read the same whatever their size
+var blockForms = map[string]bool{
+	"diagram": true,
+	"nodes":   true,
+	"edges":   true,
+	"group":   true,
+}
+
+// sortedForms are the forms whose entries FormatOptions.Sort orders
+var sortedForms = map[string]bool{
+	"nodes": true,
+	"edges": true,
+}
+
+// Format rewrites S-expression source in the canonical layout: lists
+// that do not fit on a line are broken with two-space indentation,
+// :key value pairs are aligned, strings are quoted consistently and
+// comments and blank lines are kept. Source with syntax errors is not
+// formatted; the errors are returned instead.
+func Format(name string, src []byte, opts FormatOptions) ([]byte, error) {
+	if _, err := NewReader(NewFileLexer(name, string(src))).ReadAll(); err != nil {
+		return nil, err
+	}
+
+	forms := ReadSyntax(NewFileLexer(name, string(src)))
+	if opts.Width <= 0 {
+		opts.Width = DefaultFormatWidth
+	}
+	if opts.Sort {
+		sortSyntax(forms)
+	}
+
+	f := &formatter{width: opts.Width}
+	var lines []line
+	for i, form := range forms {
+		if form.Blank && i > 0 {
+			lines = append(lines, line{})
+		}
+		lines = append(lines, f.element(form, 0)...)
+	}
+	return []byte(renderLines(lines)), nil
+}
+
+// ReadSyntax reads the concrete syntax tree of the lexer's input. It
+// expects well-formed input: unbalanced parentheses end the tree early and
+// lexical errors are dropped, so callers should check the source with a
+// Reader first.
+func ReadSyntax(lexer *Lexer) []*Syntax {
+	lexer.KeepComments = true
+	r := &syntaxReader{lexer: lexer, input: lexer.input}
+	r.next()
+	return r.readChildren(false)
+}
+
+type syntaxReader struct {
+	lexer *Lexer
+	input string
+	cur   Token
+
+	// last is the node that ended most recently and end the offset where
+	// it ended, used to attach trailing comments and detect blank lines
+	last *Syntax
+	end  int
+}
+
+func (r *syntaxReader) next() {
+	r.cur = r.lexer.NextToken()
+}
+
+// newlinesBefore counts the line breaks between the previous token and
+// the current one
+func (r *syntaxReader) newlinesBefore() int {
+	start := r.cur.Span.Start.Offset
+	if start < r.end || start > len(r.input) {
+		return 0
+	}
+	return strings.Count(r.input[r.end:start], "\n")
+}
+
+func (r *syntaxReader) readChildren(inList bool) []*Syntax {
+	children := []*Syntax{}
+	for {
+		switch r.cur.Type {
+		case TokenEOF:
+			return children
+		case TokenRParen:
+			if inList {
+				return children
+			}
+			r.next()
+			continue
+		case TokenError:
+			r.next()
+			continue
+		}
+
+		newlines := r.newlinesBefore()
+		if r.cur.Type == TokenComment && newlines == 0 && r.last != nil {
+			r.last.Comment = r.cur.Value
+			r.end = r.cur.Span.End.Offset
+			r.next()
+			continue
+		}
+
+		node := r.readNode()
+		node.Blank = newlines > 1
+		children = append(children, node)
+	}
+}
+
+func (r *syntaxReader) readNode() *Syntax {
+	tok := r.cur
+	switch tok.Type {
+	case TokenComment:
+		node := &Syntax{Kind: SyntaxComment, Text: tok.Value, Span: tok.Span}
+		r.end = tok.Span.End.Offset
+		r.last = nil
+		r.next()
+		return node
+	case TokenLParen:
+		r.end = tok.Span.End.Offset
+		r.last = nil
+		r.next()
+		node := &Syntax{Kind: SyntaxList}
+		node.Children = r.readChildren(true)
+		node.Span = Span{Start: tok.Span.Start, End: r.cur.Span.End}
+		r.end = r.cur.Span.End.Offset
+		r.last = node
+		r.next() // consume ')'
+		return node
+	default:
+		node := &Syntax{
+			Kind: SyntaxAtom,
+			Text: r.input[tok.Span.Start.Offset:tok.Span.End.Offset],
+			Span: tok.Span,
+		}
+		switch tok.Type {
+		case TokenString:
+			node.Value = Value{Kind: ValueString, Text: tok.Value, Span: tok.Span}
+		case TokenKeyword:
+			node.Value = Value{Kind: ValueKeyword, Text: tok.Value, Span: tok.Span}
+		default:
+			node.Value = atomValue(tok)
+		}
+		r.end = tok.Span.End.Offset
+		r.last = node
+		r.next()
+		return node
+	}
+}
+
+// line is an output line: its text, including indentation, and an
+// optional trailing comment aligned with those of neighbouring lines
+type line struct {
+	text    string
+	comment string
+}
+
+// renderLines joins lines, aligning the trailing comments of consecutive
+// lines
+func renderLines(lines []line) string {
+	var sb strings.Builder
+	for start := 0; start < len(lines); {
+		end := start + 1
+		if lines[start].comment != "" {
+			for end < len(lines) && lines[end].comment != "" {
+				end++
+			}
+		}
+
+		column := 0
+		for _, l := range lines[start:end] {
+			if width := utf8.RuneCountInString(l.text); width > column {
+				column = width
+			}
+		}
+
+		for _, l := range lines[start:end] {
+			text := l.text
+			if l.comment != "" {
+				if text != "" {
+					text += strings.Repeat(" ", column-utf8.RuneCountInString(text)+1)
+				}
+				text += l.comment
+			}
+			sb.WriteString(strings.TrimRight(text, " "))
+			sb.WriteByte('\n')
+		}
+		start = end
+	}
+	return sb.String()
+}
+
+type formatter struct {
+	width int
+}
+
+// element formats a node whose first line starts at column indent. The
+// first returned line carries no indentation; the others are indented.
+func (f *formatter) element(node *Syntax, indent int) []line {
+	var lines []line
+	switch node.Kind {
+	case SyntaxComment:
+		return []line{{text: node.Text}}
+	case SyntaxAtom:
+		lines = f.atom(node, indent)
+	default:
+		if text, ok := f.flat(node); ok && indent+utf8.RuneCountInString(text) <= f.width && !f.isBlock(node) {
+			lines = []line{{text: text}}
+		} else {
+			lines = f.list(node, indent)
+		}
+	}
+	if node.Comment != "" {
+		lines[len(lines)-1].comment = node.Comment
+	}
+	return lines
+}
+
+// atom formats an atom, normalising the quoting of strings. Strings that
+// span several lines are written raw, unless the raw string would not read
+// back as the same text, as with shared leading indentation, trailing
+// spaces or carriage returns.
+func (f *formatter) atom(node *Syntax, indent int) []line {
+	if node.Value.Kind != ValueString {
+		return []line{{text: node.Text}}
+	}
+	value := node.Value.Text
+	if !strings.Contains(value, "\n") || strings.Contains(value, `"""`) {
+		return []line{{text: quoteString(value)}}
+	}
+
+	pad := strings.Repeat(" ", indent)
+	lines := []line{{text: `"""`}}
+	var body strings.Builder
+	for _, text := range strings.Split(value, "\n") {
+		if text != "" {
+			text = pad + text
+		}
+		lines = append(lines, line{text: text})
+		body.WriteString("\n" + strings.TrimRight(text, " "))
+	}
+	body.WriteString("\n" + pad)
+	if dedentRawString(body.String()) != value {
+		return []line{{text: quoteString(value)}}
+	}
+	return append(lines, line{text: pad + `"""`})
+}
+
+// flat formats a node on a single line, which is impossible if it holds
+// comments or multi-line strings. A comment following the node itself
+// can still share its line.
+func (f *formatter) flat(node *Syntax) (string, bool) {
+	switch node.Kind {
+	case SyntaxComment:
+		return "", false
+	case SyntaxAtom:
+		lines := f.atom(node, 0)
+		return lines[0].text, len(lines) == 1
+	}
+
+	parts := make([]string, len(node.Children))
+	for i, child := range node.Children {
+		text, ok := f.flat(child)
+		if !ok || child.Comment != "" {
+			return "", false
+		}
+		parts[i] = text
+	}
+	return "(" + strings.Join(parts, " ") + ")", true
+}
+
+// isBlock reports whether a list is a block form holding lists
+func (f *formatter) isBlock(node *Syntax) bool {
+	if len(node.Children) == 0 || !blockForms[node.Children[0].Value.Text] || node.Children[0].Value.Kind != ValueSymbol {
+		return false
+	}
+	for _, child := range node.Children[1:] {
+		if child.Kind == SyntaxList {
+			return true
+		}
+	}
+	return false
+}
+
+// list formats a list over several lines. The head and the plain atoms
+// after it stay on the first line; each :key value pair and each other
+// element goes on a line of its own, indented by two spaces.
+func (f *formatter) list(node *Syntax, indent int) []line {
+	children := node.Children
+	pad := strings.Repeat(" ", indent+2)
+
+	// Header: the head and the atoms following it
+	header := line{text: "("}
+	i := 0
+	for ; i < len(children); i++ {
+		child := children[i]
+		if child.Kind == SyntaxComment || (i > 0 && (child.Kind != SyntaxAtom || child.Value.Kind == ValueKeyword || child.Blank)) {
+			break
+		}
+		text, ok := f.flat(child)
+		if !ok {
+			break
+		}
+		if i > 0 {
+			header.text += " "
+		}
+		header.text += text
+		if child.Comment != "" {
+			header.comment = child.Comment
+			i++
+			break
+		}
+	}
+	// Block forms also keep their attributes on the first line, as in
+	// (group "db" :label "Data"
+	if f.isBlock(node) {
+		for header.comment == "" && isPair(children[i:]) && children[i+1].Kind == SyntaxAtom && !children[i].Blank {
+			key, _ := f.flat(children[i])
+			value, ok := f.flat(children[i+1])
+			text := header.text + " " + key + " " + value
+			if !ok || indent+utf8.RuneCountInString(text) > f.width {
+				break
+			}
+			header.text = text
+			header.comment = children[i+1].Comment
+			i += 2
+		}
+	}
+	lines := []line{header}
+
+	// Remaining elements, with runs of :key value pairs aligned
+	keyWidth := 0
+	endsWithComment := false
+	for ; i < len(children); i++ {
+		child := children[i]
+		if child.Blank {
+			lines = append(lines, line{})
+			keyWidth = 0
+		}
+		endsWithComment = child.Kind == SyntaxComment
+
+		if isPair(children[i:]) {
+			if keyWidth == 0 {
+				keyWidth = pairKeyWidth(children[i:])
+			}
+			key := child.Text + strings.Repeat(" ", keyWidth-utf8.RuneCountInString(child.Text)+1)
+			value := f.element(children[i+1], indent+2+utf8.RuneCountInString(key))
+			value[0].text = pad + key + value[0].text
+			lines = append(lines, value...)
+			i++
+			continue
+		}
+
+		keyWidth = 0
+		element := f.element(child, indent+2)
+		element[0].text = pad + element[0].text
+		lines = append(lines, element...)
+	}
+
+	// Close on the last line unless it holds only a comment
+	if endsWithComment {
+		lines = append(lines, line{text: strings.Repeat(" ", indent) + ")"})
+	} else {
+		lines[len(lines)-1].text += ")"
+	}
+	return lines
+}
+
+// isPair reports whether children starts with a :key value pair that can
+// share a line
+func isPair(children []*Syntax) bool {
+	if len(children) < 2 {
+		return false
+	}
+	key, value := children[0], children[1]
+	return key.Kind == SyntaxAtom && key.Value.Kind == ValueKeyword && key.Comment == "" &&
+		value.Kind != SyntaxComment && value.Value.Kind != ValueKeyword && !value.Blank
+}
+
+// pairKeyWidth returns the width of the longest key in the run of
+// :key value pairs at the start of children
+func pairKeyWidth(children []*Syntax) int {
+	width := 0
+	for i := 0; isPair(children[i:]); i += 2 {
+		if i > 0 && children[i].Blank {
+			break
+		}
+		if n := utf8.RuneCountInString(children[i].Text); n > width {
+			width = n
+		}
+	}
+	return width
+}
+
+// sortSyntax orders the entries of nodes and edges forms anywhere in the
+// tree
+func sortSyntax(nodes []*Syntax) {
+	for _, node := range nodes {
+		if node.Kind != SyntaxList {
+			continue
+		}
+		sortSyntax(node.Children)
+		if len(node.Children) > 0 && sortedForms[node.Children[0].Value.Text] {
+			sortEntries(node.Children[1:])
+		}
+	}
+}
+
+// sortEntries sorts each run of entries separated by blank lines. Comments
+// before an entry move with it, except those opening the run.
+func sortEntries(children []*Syntax) {
+	type entry struct {
+		nodes []*Syntax
+		key   string
+	}
+
+	start := 0
+	for start < len(children) {
+		end := start + 1
+		for end < len(children) && !children[end].Blank {
+			end++
+		}
+
+		run := children[start:end]
+		header := 0
+		for header < len(run) && run[header].Kind == SyntaxComment {
+			header++
+		}
+
+		var entries []entry
+		var pending []*Syntax
+		for _, node := range run[header:] {
+			pending = append(pending, node)
+			if node.Kind != SyntaxComment {
+				entries = append(entries, entry{nodes: pending, key: entryKey(node)})
+				pending = nil
+			}
+		}
+		if pending == nil {
+			blank := run[0].Blank
+			sort.SliceStable(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+			sorted := append([]*Syntax{}, run[:header]...)
+			for _, e := range entries {
+				sorted = append(sorted, e.nodes...)
+			}
+			for i := range sorted {
+				sorted[i].Blank = i == 0 && blank
+			}
+			copy(run, sorted)
+		}
+		start = end
+	}
+}
+
+// entryKey returns the sort key of a nodes or edges entry: the node ID of
+// (id "x" ...), or the endpoints of an edge
+func entryKey(node *Syntax) string {
+	var parts []string
+	for i, child := range node.Children {
+		if child.Kind == SyntaxAtom && child.Value.Kind == ValueKeyword {
+			break
+		}
+		if i == 0 && child.Value.Kind == ValueSymbol && child.Value.Text == "id" {
+			continue
+		}
+		if child.Kind == SyntaxAtom {
+			parts = append(parts, child.Value.Text)
+		} else {
+			text, _ := (&formatter{}).flat(child)
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, "\x00")
+}
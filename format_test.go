@@ -0,0 +1,208 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readForms renders every form of src canonically, for comparing the
+// meaning of two sources
+func readForms(t *testing.T, src string) string {
+	t.Helper()
+	forms, err := NewReader(NewLexer(src)).ReadAll()
+	if err != nil {
+		t.Fatalf("Unexpected read error: %v", err)
+	}
+	parts := make([]string, len(forms))
+	for i, form := range forms {
+		parts[i] = form.String()
+	}
+	return strings.Join(parts, "\n")
+}
+
+// TestFormat tests the canonical layout
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"reindent",
+			"(diagram\n(size 800 400)\n      (nodes (id \"A\")\n (id \"B\")))",
+			"(diagram\n  (size 800 400)\n  (nodes\n    (id \"A\")\n    (id \"B\")))\n",
+		},
+		{
+			"comments and blank lines",
+			"; header\n\n\n(diagram\n  ; sizes\n  (size 1 2)   ; canvas\n  (layout-direction \"left-to-right\") ; flow\n\n  (nodes ; all nodes\n    (id \"A\")))\n",
+			"; header\n\n(diagram\n  ; sizes\n  (size 1 2)                         ; canvas\n  (layout-direction \"left-to-right\") ; flow\n\n  (nodes ; all nodes\n    (id \"A\")))\n",
+		},
+		{
+			"aligned pairs",
+			`(diagram (nodes (id "custom1" :label "Custom Colors" :shape "rect" :fill "#00ced1" :color "#ffffff" :stroke-width 2)))`,
+			"(diagram\n  (nodes\n    (id \"custom1\"\n      :label        \"Custom Colors\"\n      :shape        \"rect\"\n      :fill         \"#00ced1\"\n      :color        \"#ffffff\"\n      :stroke-width 2)))\n",
+		},
+		{
+			"quoting",
+			"(defclass \"a\\u{41}\" :label \"\"\"raw\"\"\" :note \"tab\\there\")",
+			"(defclass \"aA\" :label \"raw\" :note \"tab\\there\")\n",
+		},
+		{
+			"multi-line raw string",
+			"(diagram (nodes (id \"doc\" :label \"\"\"\n    first\n      second\n    \"\"\")))",
+			"(diagram\n  (nodes\n    (id \"doc\"\n      :label \"\"\"\n             first\n               second\n             \"\"\")))\n",
+		},
+		{
+			"block attributes",
+			`(diagram (group "data" :label "Data tier" :stroke "#333" (nodes (id "db"))))`,
+			"(diagram\n  (group \"data\" :label \"Data tier\" :stroke \"#333\"\n    (nodes\n      (id \"db\"))))\n",
+		},
+		{
+			"block and datum comments",
+			"(diagram\n#| disabled:\n   (group \"g\") |#\n  (nodes (id \"A\") #;(id \"B\"\n  :label \"b\"))\n  #;\n  (edges (\"A\" \"B\")))",
+			"(diagram\n  #| disabled:\n   (group \"g\") |#\n  (nodes\n    (id \"A\")) #;(id \"B\"\n  :label \"b\")\n  #;\n  (edges (\"A\" \"B\"))\n)\n",
+		},
+		{
+			"comment before closing paren",
+			"(diagram\n  (nodes (id \"A\")\n    ; more later\n  ))",
+			"(diagram\n  (nodes\n    (id \"A\")\n    ; more later\n  ))\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := Format("<input>", []byte(tt.input), FormatOptions{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(output) != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, output)
+			}
+			if readForms(t, string(output)) != readForms(t, tt.input) {
+				t.Errorf("Formatting changed the meaning of the input:\n%s", output)
+			}
+		})
+	}
+}
+
+// TestFormatStringRoundTrip tests that multi-line strings read back
+// unchanged, whether they are written raw or quoted
+func TestFormatStringRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		raw   bool
+	}{
+		{"indented lines", "first\n  second", true},
+		{"trailing newline", "first\nsecond\n", true},
+		{"shared indentation", "  Total:\n  42", false},
+		{"leading space", " 0\n", false},
+		{"carriage return", "x\ty\r\nz", false},
+		{"trailing spaces", "first  \nsecond", false},
+		{"blank line of spaces", "first\n   \nsecond", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "(diagram (nodes (id \"A\" :label " + quoteString(tt.value) + ")))"
+			output, err := Format("<input>", []byte(input), FormatOptions{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if raw := strings.Contains(string(output), `"""`); raw != tt.raw {
+				t.Errorf("Expected raw string %v, got:\n%s", tt.raw, output)
+			}
+			if readForms(t, string(output)) != readForms(t, input) {
+				t.Errorf("Formatting changed the label %q:\n%s", tt.value, output)
+			}
+			again, err := Format("<input>", output, FormatOptions{})
+			if err != nil || string(again) != string(output) {
+				t.Errorf("Formatting is not idempotent:\n%s\nthen:\n%s", output, again)
+			}
+		})
+	}
+}
+
+// TestFormatSort tests sorting nodes and edges within blank-line separated runs
+func TestFormatSort(t *testing.T) {
+	input := `(diagram
+  (nodes
+    ; services
+    (id "web")
+    ; the database
+    (id "db")
+    (id "api")
+
+    (id "b")
+    (id "a"))
+  (edges
+    ("web" "db")
+    ("api" "db" :label "read")
+    ("api" "cache")))
+`
+	expected := `(diagram
+  (nodes
+    ; services
+    (id "api")
+    ; the database
+    (id "db")
+    (id "web")
+
+    (id "a")
+    (id "b"))
+  (edges
+    ("api" "cache")
+    ("api" "db" :label "read")
+    ("web" "db")))
+`
+
+	output, err := Format("<input>", []byte(input), FormatOptions{Sort: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(output) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, output)
+	}
+}
+
+// TestFormatErrors tests that malformed input is reported, not formatted
+func TestFormatErrors(t *testing.T) {
+	_, err := Format("bad.sxd", []byte("(diagram\n  (nodes (id \"A\")"), FormatOptions{})
+	if err == nil || !strings.Contains(err.Error(), "bad.sxd:2:3: unclosed '('") {
+		t.Errorf("Expected unclosed paren error, got %v", err)
+	}
+}
+
+// TestFormatExamples tests that formatting the examples keeps their meaning
+// and is idempotent
+func TestFormatExamples(t *testing.T) {
+	files, _ := filepath.Glob("examples/*.sxd")
+	files = append(files, "sample.sxd")
+
+	for _, file := range files {
+		t.Run(file, func(t *testing.T) {
+			src, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", file, err)
+			}
+
+			once, err := Format(file, src, FormatOptions{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if readForms(t, string(once)) != readForms(t, string(src)) {
+				t.Errorf("Formatting changed the meaning of %s", file)
+			}
+
+			twice, err := Format(file, once, FormatOptions{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(twice) != string(once) {
+				t.Errorf("Formatting is not idempotent for %s:\n%s", file, twice)
+			}
+		})
+	}
+}
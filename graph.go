@@ -0,0 +1,478 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// graphEdge is an edge of a diagramGraph; index is the position of the
+// diagram edge it comes from. A two-way edge is one half of a pair
+// leading both ways between the same nodes.
+type graphEdge struct {
+	from, to string
+	index    int
+	twoWay   bool
+}
+
+// reverse returns the other half of a two-way edge
+func (e graphEdge) reverse() graphEdge {
+	return graphEdge{from: e.to, to: e.from, index: e.index, twoWay: e.twoWay}
+}
+
+// diagramGraph is the graph of the nodes of a diagram joined by its
+// edges, as used by lint rules. Edges lead the way they are drawn: a
+// :dir back edge from its target to its source, and edges without a
+// direction (:dir none or both, and every edge of an undirected diagram)
+// both ways. An edge to or from a group joins every node in the group,
+// and edges to undeclared IDs are left out.
+//
+// A path never follows a two-way edge back the way it came, so a single
+// edge without a direction is not a cycle.
+type diagramGraph struct {
+	nodes []string
+	out   map[string][]graphEdge
+	in    map[string][]graphEdge
+
+	// members holds the nodes each node or group ID stands for
+	members map[string][]string
+}
+
+func newDiagramGraph(d *Diagram) *diagramGraph {
+	members := make(map[string][]string)
+	g := &diagramGraph{
+		out:     make(map[string][]graphEdge),
+		in:      make(map[string][]graphEdge),
+		members: members,
+	}
+
+	for _, node := range d.Nodes {
+		if _, ok := members[node.ID]; !ok {
+			g.nodes = append(g.nodes, node.ID)
+		}
+		members[node.ID] = []string{node.ID}
+	}
+	for _, group := range d.AllGroups() {
+		if _, ok := members[group.ID]; !ok {
+			members[group.ID] = group.Members()
+		}
+	}
+
+	for i, edge := range d.Edges {
+		source, target := edge.From, edge.To
+		dir := d.EdgeDirection(edge)
+		if dir == DirBack {
+			source, target = target, source
+		}
+		twoWay := dir == DirNone || dir == DirBoth || d.Options.Undirected
+		for _, from := range members[source] {
+			for _, to := range members[target] {
+				e := graphEdge{from: from, to: to, index: i, twoWay: twoWay && from != to}
+				g.add(e)
+				if e.twoWay {
+					g.add(e.reverse())
+				}
+			}
+		}
+	}
+	return g
+}
+
+func (g *diagramGraph) add(e graphEdge) {
+	g.out[e.from] = append(g.out[e.from], e)
+	g.in[e.to] = append(g.in[e.to], e)
+}
+
+// roots returns the nodes without incoming edges other than self-loops
+func (g *diagramGraph) roots() []string {
+	var roots []string
+	for _, id := range g.nodes {
+		root := true
+		for _, e := range g.in[id] {
+			if e.from != id {
+				root = false
+				break
+			}
+		}
+		if root {
+			roots = append(roots, id)
+		}
+	}
+	return roots
+}
+
+// reachable returns the nodes reachable from start, including start
+func (g *diagramGraph) reachable(start []string) map[string]bool {
+	seen := make(map[string]bool)
+	queue := append([]string{}, start...)
+	for _, id := range start {
+		seen[id] = true
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, e := range g.out[id] {
+			if !seen[e.to] {
+				seen[e.to] = true
+				queue = append(queue, e.to)
+			}
+		}
+	}
+	return seen
+}
+
+// reaching returns the nodes with a path to any of targets, including
+// the targets
+func (g *diagramGraph) reaching(targets []string) map[string]bool {
+	seen := make(map[string]bool)
+	queue := append([]string{}, targets...)
+	for _, id := range targets {
+		seen[id] = true
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, e := range g.in[id] {
+			if !seen[e.from] {
+				seen[e.from] = true
+				queue = append(queue, e.from)
+			}
+		}
+	}
+	return seen
+}
+
+// connected returns the nodes joined to start by edges followed either
+// way round
+func (g *diagramGraph) connected(start string) map[string]bool {
+	seen := map[string]bool{start: true}
+	queue := []string{start}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		var neighbours []string
+		for _, e := range g.out[id] {
+			neighbours = append(neighbours, e.to)
+		}
+		for _, e := range g.in[id] {
+			neighbours = append(neighbours, e.from)
+		}
+		for _, next := range neighbours {
+			if !seen[next] {
+				seen[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return seen
+}
+
+// components returns the strongly connected components of the graph,
+// each with its nodes in graph order. A component comes after every
+// component it has edges to. Two-way edges that are the only link
+// between two parts of a component are no way back from one part to the
+// other, so those parts become components of their own.
+func (g *diagramGraph) components() [][]string {
+	bridges := make(map[graphEdge]bool)
+	for {
+		components := g.strongComponents(bridges)
+		split := false
+		for _, component := range components {
+			for _, e := range g.bridges(component, bridges) {
+				bridges[e], bridges[e.reverse()] = true, true
+				split = true
+			}
+		}
+		if !split {
+			return components
+		}
+	}
+}
+
+// strongComponents returns the strongly connected components of the
+// graph without the edges in skip, in the order of components
+func (g *diagramGraph) strongComponents(skip map[graphEdge]bool) [][]string {
+	// Tarjan's algorithm
+	index := make(map[string]int)
+	low := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var components [][]string
+
+	var connect func(id string)
+	connect = func(id string) {
+		index[id] = len(index)
+		low[id] = index[id]
+		stack = append(stack, id)
+		onStack[id] = true
+
+		for _, e := range g.out[id] {
+			if skip[e] {
+				continue
+			}
+			if _, visited := index[e.to]; !visited {
+				connect(e.to)
+				low[id] = min(low[id], low[e.to])
+			} else if onStack[e.to] {
+				low[id] = min(low[id], index[e.to])
+			}
+		}
+
+		if low[id] == index[id] {
+			var component []string
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				component = append(component, top)
+				if top == id {
+					break
+				}
+			}
+			components = append(components, component)
+		}
+	}
+	for _, id := range g.nodes {
+		if _, visited := index[id]; !visited {
+			connect(id)
+		}
+	}
+
+	order := g.order()
+	for _, component := range components {
+		sort.Slice(component, func(i, j int) bool { return order[component[i]] < order[component[j]] })
+	}
+	return components
+}
+
+// bridges returns the two-way edges inside component, other than those in
+// skip, whose removal would cut it in two with edge direction ignored
+func (g *diagramGraph) bridges(component []string, skip map[graphEdge]bool) []graphEdge {
+	if len(component) < 2 {
+		return nil
+	}
+	inside := make(map[string]bool)
+	for _, id := range component {
+		inside[id] = true
+	}
+
+	// Links between the nodes regardless of direction, with a two-way
+	// edge as a single link
+	type link struct {
+		edge graphEdge
+		to   string
+	}
+	links := make(map[string][]link)
+	for _, id := range component {
+		for _, e := range g.out[id] {
+			if skip[e] || !inside[e.to] || e.from == e.to || (e.twoWay && e.from > e.to) {
+				continue
+			}
+			links[e.from] = append(links[e.from], link{e, e.to})
+			links[e.to] = append(links[e.to], link{e, e.from})
+		}
+	}
+
+	// Tarjan's bridge-finding algorithm
+	index := make(map[string]int)
+	low := make(map[string]int)
+	var bridges []graphEdge
+	var visit func(id string, via graphEdge)
+	visit = func(id string, via graphEdge) {
+		index[id] = len(index)
+		low[id] = index[id]
+		for _, l := range links[id] {
+			if l.edge == via {
+				continue
+			}
+			if _, visited := index[l.to]; visited {
+				low[id] = min(low[id], index[l.to])
+				continue
+			}
+			visit(l.to, l.edge)
+			low[id] = min(low[id], low[l.to])
+			if low[l.to] > index[id] && l.edge.twoWay {
+				bridges = append(bridges, l.edge)
+			}
+		}
+	}
+	visit(component[0], graphEdge{})
+	return bridges
+}
+
+// order returns the position of each node in the graph
+func (g *diagramGraph) order() map[string]int {
+	order := make(map[string]int)
+	for i, id := range g.nodes {
+		order[id] = i
+	}
+	return order
+}
+
+// longestPath returns the longest path through the graph with each cycle
+// merged into a single node, as the edges followed between components,
+// so that its length does not depend on how cycles are walked. component
+// maps each node to the nodes of its component.
+func (g *diagramGraph) longestPath() (path []graphEdge, component map[string][]string) {
+	component = make(map[string][]string)
+	components := g.components()
+	for _, members := range components {
+		for _, id := range members {
+			component[id] = members
+		}
+	}
+
+	// The longest path onward from a component entered by an edge, which
+	// a two-way edge cannot be followed back along. Components are only
+	// joined both ways by such edges, so no path enters one twice.
+	type entry struct {
+		head string
+		via  graphEdge
+	}
+	longest := make(map[entry][]graphEdge)
+	var onward func(head string, via graphEdge) []graphEdge
+	onward = func(head string, via graphEdge) []graphEdge {
+		key := entry{head, via}
+		if path, ok := longest[key]; ok {
+			return path
+		}
+		var path []graphEdge
+		for _, id := range component[head] {
+			for _, e := range g.out[id] {
+				if component[e.to][0] == head || (e.twoWay && e == via.reverse()) {
+					continue
+				}
+				if next := onward(component[e.to][0], e); len(next)+1 > len(path) {
+					path = append([]graphEdge{e}, next...)
+				}
+			}
+		}
+		longest[key] = path
+		return path
+	}
+
+	var best []graphEdge
+	for _, members := range components {
+		if path := onward(members[0], graphEdge{}); len(path) > len(best) {
+			best = path
+		}
+	}
+	return best, component
+}
+
+// cycles returns a cycle, as the edges followed, through each strongly
+// connected component of more than one node, in the order of the
+// components' first nodes. Self-loops are not cycles here.
+func (g *diagramGraph) cycles() [][]graphEdge {
+	order := g.order()
+	var cycles [][]graphEdge
+	for _, component := range g.components() {
+		if len(component) < 2 {
+			continue
+		}
+		inside := make(map[string]bool)
+		for _, id := range component {
+			inside[id] = true
+		}
+		cycles = append(cycles, g.cycleThrough(component[0], inside))
+	}
+	sort.SliceStable(cycles, func(i, j int) bool {
+		return order[cycles[i][0].from] < order[cycles[j][0].from]
+	})
+	return cycles
+}
+
+// cycleThrough returns a cycle staying among the nodes in inside, found
+// from the shortest walk from start back to itself that never turns back
+// along a two-way edge. The walk may reach a cycle it then leaves the way
+// it came; the first cycle along it is returned.
+func (g *diagramGraph) cycleThrough(start string, inside map[string]bool) []graphEdge {
+	// Walks are searched by the edge they last followed
+	via := make(map[graphEdge]graphEdge)
+	var queue []graphEdge
+	follow := func(prev graphEdge, from string) []graphEdge {
+		for _, e := range g.out[from] {
+			if !inside[e.to] || e.to == e.from || (e.twoWay && e == prev.reverse()) {
+				continue
+			}
+			if _, seen := via[e]; seen {
+				continue
+			}
+			via[e] = prev
+			if e.to == start {
+				return []graphEdge{e}
+			}
+			queue = append(queue, e)
+		}
+		return nil
+	}
+
+	last := follow(graphEdge{}, start)
+	for last == nil && len(queue) > 0 {
+		e := queue[0]
+		queue = queue[1:]
+		last = follow(e, e.to)
+	}
+	if last == nil {
+		return nil
+	}
+	walk := last
+	for e := via[last[0]]; e != (graphEdge{}); e = via[e] {
+		walk = append([]graphEdge{e}, walk...)
+	}
+
+	// Cut the walk at the first node it comes back to
+	at := map[string]int{start: 0}
+	for i, e := range walk {
+		if first, ok := at[e.to]; ok {
+			return walk[first : i+1]
+		}
+		at[e.to] = i + 1
+	}
+	return walk
+}
+
+// allCycles returns the self-loops of the graph as cycles of one edge,
+// followed by the cycles found by cycles
+func (g *diagramGraph) allCycles() [][]graphEdge {
+	var loops [][]graphEdge
+	for _, id := range g.nodes {
+		for _, e := range g.out[id] {
+			if e.to == id {
+				loops = append(loops, []graphEdge{e})
+			}
+		}
+	}
+	sort.SliceStable(loops, func(i, j int) bool { return loops[i][0].index < loops[j][0].index })
+	return append(loops, g.cycles()...)
+}
+
+// pathString writes the nodes along a path of edges as "A -> B -> C"
+func pathString(path []graphEdge) string {
+	if len(path) == 0 {
+		return ""
+	}
+	ids := []string{path[0].from}
+	for _, e := range path {
+		ids = append(ids, e.to)
+	}
+	return strings.Join(ids, " -> ")
+}
+
+// componentPathString writes the components along a path returned by
+// longestPath, cycles as their nodes in braces: "A -> {B, C} -> D"
+func componentPathString(path []graphEdge, component map[string][]string) string {
+	if len(path) == 0 {
+		return ""
+	}
+	name := func(id string) string {
+		if members := component[id]; len(members) > 1 {
+			return "{" + strings.Join(members, ", ") + "}"
+		}
+		return id
+	}
+	ids := []string{name(path[0].from)}
+	for _, e := range path {
+		ids = append(ids, name(e.to))
+	}
+	return strings.Join(ids, " -> ")
+}
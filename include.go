@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// NamespaceSeparator joins an include namespace and the IDs declared in
+// the included file, as in "auth/login"
+const NamespaceSeparator = "/"
+
+// include is registered from init because it interprets the directives of
+// the included file, which refers back to the directive table
+func init() {
+	directives["include"] = interpretInclude
+}
+
+// interpretInclude handles (include "file.sxd" :as "namespace"). The file
+// is resolved relative to the including file and may hold either a
+// (diagram ...) form or bare directives. Its nodes, edges, groups, classes
+// and styles are merged into the diagram; size and layout direction stay
+// those of the including diagram.
+func interpretInclude(in *Interpreter, diagram *Diagram, form Value) error {
+	if len(form.List) < 2 || form.List[1].Kind != ValueString {
+		return newSourceError(elementSpan(form, 1), "expected file name, got %s", describeElement(form, 1))
+	}
+
+	attrs, err := readAttributes(form, 2)
+	in.report(err)
+
+	namespace := ""
+	for _, attr := range attrs {
+		switch attr.Key {
+		case "as":
+			namespace = attr.Text
+		default:
+			in.report(newSourceError(attr.Span, "unknown include option: :%s", attr.Key))
+		}
+	}
+
+	path := resolveIncludePath(form.Span.Start, form.List[1].Text)
+	included, err := in.includeFile(form, path)
+	if err != nil {
+		return err
+	}
+
+	if namespace != "" {
+		applyNamespace(included, namespace)
+	}
+	mergeDiagram(diagram, included)
+	return nil
+}
+
+// resolveIncludePath resolves name relative to the directory of the file
+// containing pos
+func resolveIncludePath(pos Pos, name string) string {
+	if filepath.IsAbs(name) || pos.Source == nil || pos.Source.Name == "" || pos.Source.Name == "<stdin>" {
+		return filepath.Clean(name)
+	}
+	return filepath.Join(filepath.Dir(pos.Source.Name), name)
+}
+
+// includeKey identifies a file for cycle detection
+func includeKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// includeFile reads and interprets an included file into a new diagram,
+// reporting include cycles with the chain of files involved
+func (in *Interpreter) includeFile(form Value, path string) (*Diagram, error) {
+	key := includeKey(path)
+	for i, entry := range in.includeStack {
+		if includeKey(entry) == key {
+			chain := append(append([]string{}, in.includeStack[i:]...), path)
+			return nil, newSourceError(form.Span, "include cycle: %s", strings.Join(chain, " -> "))
+		}
+	}
+
+	text, err := in.ReadFile(path)
+	if err != nil {
+		return nil, newSourceError(form.List[1].Span, "cannot include %s: %v", path, unwrapPathError(err))
+	}
+
+	forms, err := NewReader(NewFileLexer(path, string(text))).ReadAll()
+	in.report(err)
+	if in.Evaluator != nil {
+		forms, err = in.Evaluator.Eval(forms...)
+		in.report(err)
+	}
+
+	body := forms
+	if len(forms) == 1 && forms[0].Head() == "diagram" {
+		_, body = diagramBody(forms[0])
+	}
+
+	in.includeStack = append(in.includeStack, path)
+	defer func() { in.includeStack = in.includeStack[:len(in.includeStack)-1] }()
+
+	// The edges of the included file are numbered apart from those of
+	// the diagram including it
+	outer := in.endpoints
+	in.endpoints = make(map[int]edgeEndpoints)
+	defer func() { in.endpoints = outer }()
+
+	included := NewDiagram()
+	for _, directive := range body {
+		in.report(in.interpretDirective(included, directive))
+	}
+
+	// Endpoints naming nodes of the included file are resolved before
+	// they are namespaced
+	resolvePortEndpoints(included, in.endpoints)
+	return included, nil
+}
+
+// unwrapPathError drops the operation and path that os errors repeat
+func unwrapPathError(err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err
+	}
+	return err
+}
+
+// applyNamespace prefixes every node and group ID declared in the diagram
+// with namespace. Edge endpoints and the nodes named by assertions are
+// renamed only when they refer to a declared ID, so included files can
+// still link to the including diagram.
+func applyNamespace(diagram *Diagram, namespace string) {
+	declared := make(map[string]bool)
+	for _, node := range diagram.Nodes {
+		declared[node.ID] = true
+	}
+	for _, group := range diagram.AllGroups() {
+		declared[group.ID] = true
+	}
+
+	rename := func(id string) string {
+		if declared[id] {
+			return namespace + NamespaceSeparator + id
+		}
+		return id
+	}
+
+	for i := range diagram.Nodes {
+		diagram.Nodes[i].ID = rename(diagram.Nodes[i].ID)
+	}
+	for i := range diagram.Edges {
+		diagram.Edges[i].From = rename(diagram.Edges[i].From)
+		diagram.Edges[i].To = rename(diagram.Edges[i].To)
+	}
+	for i := range diagram.Assertions {
+		diagram.Assertions[i].Node = rename(diagram.Assertions[i].Node)
+	}
+
+	var renameGroups func([]Group)
+	renameGroups = func(groups []Group) {
+		for i := range groups {
+			groups[i].ID = rename(groups[i].ID)
+			for j := range groups[i].Nodes {
+				groups[i].Nodes[j] = rename(groups[i].Nodes[j])
+			}
+			renameGroups(groups[i].Groups)
+		}
+	}
+	renameGroups(diagram.Groups)
+}
+
+// mergeDiagram adds the nodes, edges, groups, classes, styles, lint
+// settings and assertions of src to dst. Classes are shared and never
+// namespaced.
+func mergeDiagram(dst, src *Diagram) {
+	dst.Nodes = append(dst.Nodes, src.Nodes...)
+	dst.Edges = append(dst.Edges, src.Edges...)
+	dst.Groups = append(dst.Groups, src.Groups...)
+	dst.Classes = append(dst.Classes, src.Classes...)
+	dst.Profiles = append(dst.Profiles, src.Profiles...)
+	dst.Assertions = append(dst.Assertions, src.Assertions...)
+	if !src.Lint.IsZero() {
+		dst.Lint = dst.Lint.Merge(src.Lint)
+	}
+
+	for key, value := range src.NodeStyle {
+		dst.NodeStyle[key] = value
+		dst.NodeStyleSpans[key] = src.NodeStyleSpans[key]
+	}
+	for key, value := range src.EdgeStyle {
+		dst.EdgeStyle[key] = value
+		dst.EdgeStyleSpans[key] = src.EdgeStyleSpans[key]
+	}
+}
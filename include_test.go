@@ -0,0 +1,205 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// interpretFiles interprets the named file from an in-memory file set
+func interpretFiles(t *testing.T, files map[string]string, name string) (*Diagram, error) {
+	t.Helper()
+
+	form, err := NewReader(NewFileLexer(name, files[name])).Read()
+	if err != nil {
+		t.Fatalf("Unexpected read error: %v", err)
+	}
+
+	in := NewInterpreter()
+	in.ReadFile = func(path string) ([]byte, error) {
+		text, ok := files[filepath.ToSlash(path)]
+		if !ok {
+			return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+		}
+		return []byte(text), nil
+	}
+	return in.Interpret(form)
+}
+
+// TestIncludeNamespace tests including a file under a namespace
+func TestIncludeNamespace(t *testing.T) {
+	files := map[string]string{
+		"main.sxd": `(diagram
+			(include "flows/auth.sxd" :as "auth")
+			(nodes (id "app"))
+			(edges ("app" "auth/login")))`,
+		"flows/auth.sxd": `(node-style :fill "#eef")
+			(nodes (id "login"))
+			(group "session" (nodes (id "token")))
+			(edges ("login" "token") ("token" "app"))
+			(assert :reaches "session")`,
+	}
+
+	diagram, err := interpretFiles(t, files, "main.sxd")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ids := []string{}
+	for _, node := range diagram.Nodes {
+		ids = append(ids, node.ID)
+	}
+	if strings.Join(ids, ",") != "auth/login,auth/token,app" {
+		t.Errorf("Unexpected node IDs %v", ids)
+	}
+	if diagram.Nodes[0].Label != "login" {
+		t.Errorf("Expected label to keep the unqualified ID, got %q", diagram.Nodes[0].Label)
+	}
+
+	edges := []string{}
+	for _, edge := range diagram.Edges {
+		edges = append(edges, edge.From+"->"+edge.To)
+	}
+	expected := "auth/login->auth/token,auth/token->app,app->auth/login"
+	if strings.Join(edges, ",") != expected {
+		t.Errorf("Expected edges %s, got %v", expected, edges)
+	}
+
+	if len(diagram.Groups) != 1 || diagram.Groups[0].ID != "auth/session" || diagram.Groups[0].Nodes[0] != "auth/token" {
+		t.Errorf("Unexpected groups %+v", diagram.Groups)
+	}
+	if len(diagram.Assertions) != 1 || diagram.Assertions[0].Node != "auth/session" {
+		t.Errorf("Expected the asserted node to be namespaced, got %+v", diagram.Assertions)
+	}
+	if diagram.NodeStyle["fill"] != "#eef" {
+		t.Errorf("Expected included node style, got %v", diagram.NodeStyle)
+	}
+
+	if err := NewValidator().Validate(diagram); err != nil {
+		t.Errorf("Unexpected validation error: %v", err)
+	}
+}
+
+// TestIncludeDiagramForm tests including a file that holds a full diagram
+func TestIncludeDiagramForm(t *testing.T) {
+	files := map[string]string{
+		"main.sxd": `(diagram (size 300 200) (include "part.sxd"))`,
+		"part.sxd": `(diagram (size 10 10) (nodes (id "A")))`,
+	}
+
+	diagram, err := interpretFiles(t, files, "main.sxd")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(diagram.Nodes) != 1 || diagram.Nodes[0].ID != "A" {
+		t.Errorf("Expected node A from included diagram, got %+v", diagram.Nodes)
+	}
+	if diagram.Width != 300 || diagram.Height != 200 {
+		t.Errorf("Expected size of the including diagram, got %dx%d", diagram.Width, diagram.Height)
+	}
+}
+
+// TestIncludePortNodeIDs tests that endpoints naming nodes with ":" in
+// their IDs are resolved in the file that declares them, however the
+// edges of the including and included files are numbered
+func TestIncludePortNodeIDs(t *testing.T) {
+	files := map[string]string{
+		"main.sxd": `(diagram
+			(nodes (id "web") (id "cache:hot"))
+			(edges ("web" "cache:hot") ("web:e" "cache:hot:w"))
+			(include "db.sxd" :as "sub")
+			(edges ("web" "sub/db:primary")))`,
+		"db.sxd": `(nodes (id "app") (id "db:primary"))
+			(edges ("app" "db:primary:n") ("db:primary" "app"))`,
+	}
+
+	diagram, err := interpretFiles(t, files, "main.sxd")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []Edge{
+		{From: "web", To: "cache:hot"},
+		{From: "web", FromPort: "e", To: "cache:hot", ToPort: "w"},
+		{From: "sub/app", To: "sub/db:primary", ToPort: "n"},
+		{From: "sub/db:primary", To: "sub/app"},
+		{From: "web", To: "sub/db:primary"},
+	}
+	if len(diagram.Edges) != len(expected) {
+		t.Fatalf("Expected %d edges, got %d", len(expected), len(diagram.Edges))
+	}
+	for i, edge := range diagram.Edges {
+		e := expected[i]
+		if edge.From != e.From || edge.FromPort != e.FromPort || edge.To != e.To || edge.ToPort != e.ToPort {
+			t.Errorf("Edge %d: expected %s:%s -> %s:%s, got %s:%s -> %s:%s", i,
+				e.From, e.FromPort, e.To, e.ToPort, edge.From, edge.FromPort, edge.To, edge.ToPort)
+		}
+	}
+
+	if err := NewValidator().Validate(diagram); err != nil {
+		t.Errorf("Unexpected validation error: %v", err)
+	}
+}
+
+// TestIncludeErrors tests cycles, missing files and locations inside included files
+func TestIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected string
+	}{
+		{
+			"cycle",
+			map[string]string{
+				"main.sxd":  `(diagram (include "a.sxd"))`,
+				"a.sxd":     `(include "sub/b.sxd")`,
+				"sub/b.sxd": `(include "../a.sxd")`,
+			},
+			"sub/b.sxd:1:1: include cycle: a.sxd -> sub/b.sxd -> a.sxd",
+		},
+		{
+			"self include",
+			map[string]string{"main.sxd": `(diagram (include "main.sxd"))`},
+			"main.sxd:1:10: include cycle: main.sxd -> main.sxd",
+		},
+		{
+			"missing file",
+			map[string]string{"main.sxd": `(diagram (include "nope.sxd"))`},
+			"main.sxd:1:19: cannot include nope.sxd: file does not exist",
+		},
+		{
+			"error in included file",
+			map[string]string{
+				"main.sxd": `(diagram (include "part.sxd"))`,
+				"part.sxd": "(nodes\n  (id \"A\")\n  (colour red))",
+			},
+			"part.sxd:3:4: expected 'id', got colour",
+		},
+		{
+			"missing file name",
+			map[string]string{"main.sxd": `(diagram (include part))`},
+			"main.sxd:1:19: expected file name, got part",
+		},
+		{
+			"unknown option",
+			map[string]string{
+				"main.sxd": `(diagram (include "part.sxd" :prefix "p"))`,
+				"part.sxd": `(nodes (id "A"))`,
+			},
+			"main.sxd:1:30: unknown include option: :prefix",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := interpretFiles(t, tt.files, "main.sxd")
+			if err == nil {
+				t.Fatalf("Expected error containing %q", tt.expected)
+			}
+			if !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error containing %q, got %q", tt.expected, err.Error())
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -408,6 +409,39 @@ func TestIntegrationUnicodeHandling(t *testing.T) {
 	}
 }
 
+// TestIntegrationMultiLineLabels tests escaped and raw multi-line labels end to end
+func TestIntegrationMultiLineLabels(t *testing.T) {
+	input := `(diagram
+		(nodes
+			(id "A" :label "Say \"hi\"\nagain")
+			(id "B" :label """
+				Long label
+				over two lines
+				"""))
+		(edges
+			("A" "B" :label "tab\there")))`
+
+	diagram := ParseTestInput(t, input)
+
+	if diagram.Nodes[0].Label != "Say \"hi\"\nagain" {
+		t.Errorf("Unexpected escaped label: %q", diagram.Nodes[0].Label)
+	}
+	if diagram.Nodes[1].Label != "Long label\nover two lines" {
+		t.Errorf("Unexpected raw label: %q", diagram.Nodes[1].Label)
+	}
+	if diagram.Edges[0].Label != "tab\there" {
+		t.Errorf("Unexpected edge label: %q", diagram.Edges[0].Label)
+	}
+
+	svg := CompletePipeline(t, input)
+	AssertSVGContains(t, svg,
+		">Say &quot;hi&quot;</tspan>",
+		">again</tspan>",
+		">Long label</tspan>",
+		">over two lines</tspan>",
+	)
+}
+
 // TestIntegrationStyleInheritance tests style inheritance and overrides
 func TestIntegrationStyleInheritance(t *testing.T) {
 	input := `(diagram
@@ -515,3 +549,98 @@ func BenchmarkIntegrationFullPipeline(b *testing.B) {
 		_ = svgGenerator.GenerateWithCustomStyles(layout, diagram)
 	}
 }
+
+// TestIntegrationClasses tests that classes reach the layout and the SVG
+func TestIntegrationClasses(t *testing.T) {
+	input := `(diagram
+		(defclass "decision" :shape "diamond" :fill "#ffd700")
+		(defclass "failure" :stroke "#c00" :stroke-dasharray "4 2")
+		(nodes
+			(id "A" :class "decision")
+			(id "B"))
+		(edges
+			("A" "B" :class "failure")))`
+
+	diagram := ParseTestInput(t, input)
+	ValidateTestDiagram(t, diagram)
+	layout := LayoutTestDiagram(t, diagram)
+
+	AssertNodeShape(t, layout, "A", "diamond")
+
+	svg := GenerateTestSVG(t, layout, diagram)
+	AssertSVGContains(t, svg,
+		`class="node diamond decision"`,
+		`class="edge failure"`,
+		".node.decision {\n      fill: #ffd700;\n    }",
+		".edge.failure {\n      stroke: #cc0000;\n      stroke-dasharray: 4 2;\n    }",
+	)
+	AssertSVGNotContains(t, svg, ".edge.decision")
+}
+
+// TestIntegrationMultipleDiagrams tests compiling a file holding several
+// diagrams into one SVG each, and selecting one by name
+func TestIntegrationMultipleDiagrams(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "system.sxd")
+	src := `(node-style :fill "#eee")
+(diagram "overview" (nodes (id "app")))
+(diagram "detail" (nodes (id "api") (id "db")) (edges ("api" "db")))`
+	if err := os.WriteFile(input, []byte(src), 0644); err != nil {
+		t.Fatalf("Failed to write input: %v", err)
+	}
+
+	if err := compileDiagram(input, "", compileOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, name := range []string{"system.overview.svg", "system.detail.svg"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected %s to be written: %v", name, err)
+		}
+	}
+
+	output := filepath.Join(dir, "detail.svg")
+	if err := compileDiagram(input, output, compileOptions{Diagram: "detail"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	svg, err := os.ReadFile(output)
+	if err != nil || !strings.Contains(string(svg), ">db<") {
+		t.Errorf("Expected the detail diagram in %s, got %v", output, err)
+	}
+
+	err = compileDiagram(input, output, compileOptions{})
+	if err == nil || !strings.Contains(err.Error(), "select one with --diagram") {
+		t.Errorf("Expected an error asking for --diagram, got %v", err)
+	}
+	err = compileDiagram(input, "", compileOptions{Diagram: "missing"})
+	if err == nil || !strings.Contains(err.Error(), "no diagram named 'missing' (available: overview, detail)") {
+		t.Errorf("Expected an unknown diagram error, got %v", err)
+	}
+
+	// A single selected diagram is written as system.svg
+	if err := compileDiagram(input, "", compileOptions{Diagram: "overview"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "system.svg")); err != nil {
+		t.Errorf("Expected system.svg to be written: %v", err)
+	}
+}
+
+// TestIntegrationMultipleDiagramsFailure tests that no SVG is written when
+// any diagram of a file fails
+func TestIntegrationMultipleDiagramsFailure(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "system.sxd")
+	src := `(diagram "overview" (nodes (id "app")))
+(diagram "detail" (nodes (id "api")) (edges ("api" "db")))`
+	if err := os.WriteFile(input, []byte(src), 0644); err != nil {
+		t.Fatalf("Failed to write input: %v", err)
+	}
+
+	err := compileDiagram(input, "", compileOptions{})
+	if err == nil || !strings.Contains(err.Error(), "validation failed") {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.svg")); len(files) != 0 {
+		t.Errorf("Expected no SVG to be written, got %v", files)
+	}
+}
@@ -0,0 +1,743 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// Interpreter maps a value tree produced by Reader onto a Diagram. A
+// malformed form is reported and skipped so that every mistake in the
+// input is found in a single run.
+type Interpreter struct {
+	// ReadFile loads files named by include directives
+	ReadFile func(name string) ([]byte, error)
+
+	// Evaluator, if set, evaluates forms before they are interpreted
+	Evaluator *Evaluator
+
+	errors       ErrorList
+	includeStack []string
+
+	// endpoints holds the endpoints of the edges of the diagram being
+	// built as they were written, by edge index, for resolvePortEndpoints
+	endpoints map[int]edgeEndpoints
+}
+
+func NewInterpreter() *Interpreter {
+	return &Interpreter{ReadFile: os.ReadFile}
+}
+
+// directiveHandler applies one directive form to the diagram being built
+type directiveHandler func(in *Interpreter, diagram *Diagram, form Value) error
+
+// directives lists the forms accepted inside (diagram ...). Adding a
+// directive only requires registering a handler here.
+var directives = map[string]directiveHandler{
+	"size":             interpretSize,
+	"layout-direction": interpretLayoutDirection,
+	"node-style":       styleDirective(func(d *Diagram) (map[string]string, map[string]Span) { return d.NodeStyle, d.NodeStyleSpans }),
+	"edge-style":       styleDirective(func(d *Diagram) (map[string]string, map[string]Span) { return d.EdgeStyle, d.EdgeStyleSpans }),
+	"nodes":            interpretNodes,
+	"edges":            interpretEdges,
+	"group":            interpretGroup,
+	"defclass":         interpretDefclass,
+	"options":          interpretOptions,
+	"title":            interpretTitle,
+	"description":      interpretDescription,
+	"meta":             interpretMeta,
+	"profile":          interpretProfile,
+	"lint":             interpretLint,
+	"assert":           interpretAssert,
+}
+
+// NewDiagram creates a diagram with default settings
+func NewDiagram() *Diagram {
+	return &Diagram{
+		Width:           800,
+		Height:          400,
+		LayoutDirection: "top-to-bottom",
+		NodeStyle:       make(map[string]string),
+		EdgeStyle:       make(map[string]string),
+		Nodes:           []Node{},
+		Edges:           []Edge{},
+		NodeStyleSpans:  make(map[string]Span),
+		EdgeStyleSpans:  make(map[string]Span),
+	}
+}
+
+// sharedDirectives may appear outside (diagram ...) forms. They apply to
+// every diagram of the file, before the diagram's own directives.
+var sharedDirectives = map[string]bool{
+	"size":             true,
+	"layout-direction": true,
+	"node-style":       true,
+	"edge-style":       true,
+	"defclass":         true,
+	"options":          true,
+	"meta":             true,
+	"profile":          true,
+	"lint":             true,
+	"assert":           true,
+}
+
+// Interpret builds a diagram from a (diagram ...) form. If some
+// directives are malformed, the diagram built from the remaining ones is
+// returned together with an ErrorList describing every problem.
+func (in *Interpreter) Interpret(form Value) (*Diagram, error) {
+	diagrams, err := in.InterpretFile([]Value{form})
+	if len(diagrams) == 0 {
+		return nil, err
+	}
+	return diagrams[0], err
+}
+
+// InterpretFile builds the diagrams of a file: its (diagram ...) forms,
+// which must be named as in (diagram "overview" ...) when there are
+// several, and shared directives such as node-style and defclass written
+// outside them. Like Interpret, it returns what could be built together
+// with every problem found.
+func (in *Interpreter) InterpretFile(forms []Value) ([]*Diagram, error) {
+	in.errors = nil
+
+	if in.Evaluator != nil && len(forms) > 0 {
+		last := forms[len(forms)-1]
+		evaluated, err := in.Evaluator.Eval(forms...)
+		in.report(err)
+		if len(evaluated) == 0 {
+			in.report(newSourceError(last.Span, "expected program to evaluate to a diagram"))
+			return nil, in.errors.Err()
+		}
+		forms = evaluated
+	}
+
+	shared := NewDiagram()
+	var diagramForms []Value
+	for _, form := range forms {
+		switch {
+		case form.Kind != ValueList:
+			in.report(newSourceError(form.Span, "expected '(', got %s", form.describe()))
+		case form.Head() == "diagram":
+			diagramForms = append(diagramForms, form)
+		case sharedDirectives[form.Head()]:
+			in.report(in.interpretDirective(shared, form))
+		default:
+			in.report(newSourceError(elementSpan(form, 0), "expected 'diagram', got %s", describeElement(form, 0)))
+		}
+	}
+
+	// Shared settings alone make no diagram
+	if len(diagramForms) == 0 && len(forms) > 0 && forms[0].Kind == ValueList && sharedDirectives[forms[0].Head()] {
+		in.report(newSourceError(elementSpan(forms[0], 0), "expected 'diagram', got %s", describeElement(forms[0], 0)))
+	}
+
+	var diagrams []*Diagram
+	names := make(map[string]bool)
+	for _, form := range diagramForms {
+		diagram := in.interpretDiagram(shared, form)
+		if len(diagramForms) > 1 {
+			switch {
+			case diagram.Name == "":
+				in.report(newSourceError(elementSpan(form, 0), "diagram needs a name when a file holds several diagrams"))
+			case names[diagram.Name]:
+				in.report(newSourceError(form.List[1].Span, "duplicate diagram name: %s", diagram.Name))
+			}
+		}
+		names[diagram.Name] = true
+		diagrams = append(diagrams, diagram)
+	}
+	return diagrams, in.errors.Err()
+}
+
+// interpretDiagram builds one (diagram ["name"] ...) form on top of the
+// settings of shared
+func (in *Interpreter) interpretDiagram(shared *Diagram, form Value) *Diagram {
+	in.includeStack = nil
+	if src := form.Span.Start.Source; src != nil && src.Name != "" && src.Name != "<stdin>" {
+		in.includeStack = []string{src.Name}
+	}
+
+	in.endpoints = make(map[int]edgeEndpoints)
+	defer func() { in.endpoints = nil }()
+
+	diagram := NewDiagram()
+	diagram.Width, diagram.Height = shared.Width, shared.Height
+	diagram.LayoutDirection = shared.LayoutDirection
+	diagram.Options = shared.Options
+	for key, value := range shared.Meta {
+		diagram.SetMeta(key, value)
+	}
+	mergeDiagram(diagram, shared)
+
+	name, body := diagramBody(form)
+	diagram.Name = name
+	if strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+		// The name becomes part of the output file name
+		in.report(newSourceError(form.List[1].Span, `invalid diagram name: %s (names cannot contain '/', '\' or '..')`, name))
+	}
+	for _, directive := range body {
+		in.report(in.interpretDirective(diagram, directive))
+	}
+	resolvePortEndpoints(diagram, in.endpoints)
+	return diagram
+}
+
+// diagramBody splits a (diagram ...) form into its optional name and its
+// directives
+func diagramBody(form Value) (string, []Value) {
+	if len(form.List) > 1 && form.List[1].Kind == ValueString {
+		return form.List[1].Text, form.List[2:]
+	}
+	return "", form.List[1:]
+}
+
+// report records err, if any, and lets interpretation continue
+func (in *Interpreter) report(err error) {
+	in.errors.Add(err)
+}
+
+func (in *Interpreter) interpretDirective(diagram *Diagram, form Value) error {
+	if form.Kind != ValueList {
+		return newSourceError(form.Span, "expected '(', got %s", form.describe())
+	}
+
+	name := form.Head()
+	handler, ok := directives[name]
+	if !ok {
+		if specialForms[name] && in.Evaluator == nil {
+			return newSourceError(elementSpan(form, 0), "unknown directive: %s (evaluation is not enabled)", name)
+		}
+		return newSourceError(elementSpan(form, 0), "unknown directive: %s", describeElement(form, 0))
+	}
+	return handler(in, diagram, form)
+}
+
+func interpretSize(in *Interpreter, diagram *Diagram, form Value) error {
+	width, err := intArgument(form, 1, "width")
+	if err != nil {
+		return err
+	}
+	height, err := intArgument(form, 2, "height")
+	if err != nil {
+		return err
+	}
+	if err := expectEnd(form, 3); err != nil {
+		return err
+	}
+
+	diagram.Width = width
+	diagram.Height = height
+	return nil
+}
+
+func interpretLayoutDirection(in *Interpreter, diagram *Diagram, form Value) error {
+	if len(form.List) < 2 || (form.List[1].Kind != ValueString && form.List[1].Kind != ValueSymbol) {
+		return newSourceError(elementSpan(form, 1), "expected layout direction, got %s", describeElement(form, 1))
+	}
+
+	direction := form.List[1].Text
+	switch direction {
+	case "top-to-bottom", "bottom-to-top", "left-to-right", "right-to-left":
+		diagram.LayoutDirection = direction
+	default:
+		return newSourceError(form.List[1].Span, "invalid layout direction: %s", direction)
+	}
+	return expectEnd(form, 2)
+}
+
+// styleDirective creates a handler that stores :key value pairs in the
+// style map selected by target
+func styleDirective(target func(*Diagram) (map[string]string, map[string]Span)) directiveHandler {
+	return func(in *Interpreter, diagram *Diagram, form Value) error {
+		attrs, err := readAttributes(form, 1)
+		in.report(err)
+
+		style, spans := target(diagram)
+		for _, attr := range attrs {
+			style[attr.Key] = attr.Text
+			spans[attr.Key] = attr.Span
+		}
+		return nil
+	}
+}
+
+// interpretOptions handles (options :key value ...)
+func interpretOptions(in *Interpreter, diagram *Diagram, form Value) error {
+	attrs, err := readAttributes(form, 1)
+	in.report(err)
+
+	for _, attr := range attrs {
+		spec, ok := LookupAttribute(attr.Key)
+		if !ok || spec.AppliesTo&TargetDiagram == 0 {
+			if suggestion := suggestAttribute(attr.Key, TargetDiagram); suggestion != "" {
+				in.report(newSourceError(attr.Span, "unknown option: :%s (did you mean :%s?)", attr.Key, suggestion))
+			} else {
+				in.report(newSourceError(attr.Span, "unknown option: :%s", attr.Key))
+			}
+			continue
+		}
+		if err := attr.Value.CheckType(spec.Type); err != nil {
+			in.report(newSourceError(attr.Span, "invalid :%s: %v", attr.Key, err))
+			continue
+		}
+
+		switch attr.Key {
+		case "implicit-nodes":
+			diagram.Options.ImplicitNodes, _ = attr.Value.AsBool()
+		case "directed":
+			directed, _ := attr.Value.AsBool()
+			diagram.Options.Undirected = !directed
+		}
+	}
+	return nil
+}
+
+// interpretTitle handles (title "text" [:position top|bottom])
+func interpretTitle(in *Interpreter, diagram *Diagram, form Value) error {
+	if len(form.List) < 2 || (form.List[1].Kind != ValueString && form.List[1].Kind != ValueSymbol) {
+		return newSourceError(elementSpan(form, 1), "expected title, got %s", describeElement(form, 1))
+	}
+	diagram.Title = form.List[1].Text
+
+	attrs, err := readAttributes(form, 2)
+	in.report(err)
+	for _, attr := range attrs {
+		if attr.Key != "position" {
+			in.report(newSourceError(attr.Span, "unknown title option: :%s", attr.Key))
+			continue
+		}
+		switch attr.Text {
+		case "top", "bottom":
+			diagram.TitlePosition = attr.Text
+		default:
+			in.report(newSourceError(attr.Span, "invalid title position: %s (expected top or bottom)", attr.Text))
+		}
+	}
+	return nil
+}
+
+// interpretDescription handles (description "text")
+func interpretDescription(in *Interpreter, diagram *Diagram, form Value) error {
+	if len(form.List) < 2 || (form.List[1].Kind != ValueString && form.List[1].Kind != ValueSymbol) {
+		return newSourceError(elementSpan(form, 1), "expected description, got %s", describeElement(form, 1))
+	}
+	diagram.Description = form.List[1].Text
+	return expectEnd(form, 2)
+}
+
+// interpretMeta handles (meta :author "..." :version "..." ...). The keys
+// are those that have a Dublin Core counterpart, see metaElements.
+func interpretMeta(in *Interpreter, diagram *Diagram, form Value) error {
+	attrs, err := readAttributes(form, 1)
+	in.report(err)
+
+	for _, attr := range attrs {
+		if _, ok := metaElements[attr.Key]; !ok {
+			in.report(newSourceError(attr.Span, "unknown meta key: :%s", attr.Key))
+			continue
+		}
+		diagram.SetMeta(attr.Key, attr.Text)
+	}
+	return nil
+}
+
+// interpretDefclass handles (defclass "name" :key value ...)
+func interpretDefclass(in *Interpreter, diagram *Diagram, form Value) error {
+	if len(form.List) < 2 || (form.List[1].Kind != ValueString && form.List[1].Kind != ValueSymbol) {
+		return newSourceError(elementSpan(form, 1), "expected class name, got %s", describeElement(form, 1))
+	}
+
+	attrs, err := readAttributes(form, 2)
+	in.report(err)
+
+	class := Class{
+		Name:       form.List[1].Text,
+		Attributes: make(map[string]string),
+		Values:     make(map[string]Value),
+		Span:       form.Span,
+		AttrSpans:  make(map[string]Span),
+	}
+	for _, attr := range attrs {
+		class.Attributes[attr.Key] = attr.Text
+		class.Values[attr.Key] = attr.Value
+		class.AttrSpans[attr.Key] = attr.Span
+	}
+	diagram.Classes = append(diagram.Classes, class)
+	return nil
+}
+
+func interpretNodes(in *Interpreter, diagram *Diagram, form Value) error {
+	for _, nodeForm := range form.List[1:] {
+		node, err := in.interpretNode(nodeForm)
+		if err != nil {
+			in.report(err)
+			continue
+		}
+		diagram.Nodes = append(diagram.Nodes, node)
+	}
+	return nil
+}
+
+// interpretNode builds a node from (id "X" :key value ...). Malformed
+// attributes are reported and skipped; an error is returned only when the
+// form cannot be a node at all.
+func (in *Interpreter) interpretNode(form Value) (Node, error) {
+	if form.Kind != ValueList {
+		return Node{}, newSourceError(form.Span, "expected '(', got %s", form.describe())
+	}
+	if form.Head() != "id" {
+		return Node{}, newSourceError(elementSpan(form, 0), "expected 'id', got %s", describeElement(form, 0))
+	}
+	if len(form.List) < 2 || !form.List[1].IsAtom() {
+		return Node{}, newSourceError(elementSpan(form, 1), "expected node id, got %s", describeElement(form, 1))
+	}
+
+	attrs, err := readAttributes(form, 2)
+	in.report(err)
+
+	nodeID := form.List[1].Text
+	node := Node{
+		ID:         nodeID,
+		Label:      nodeID,
+		Attributes: make(map[string]string),
+		Values:     make(map[string]Value),
+		Span:       form.Span,
+		AttrSpans:  make(map[string]Span),
+	}
+	for _, attr := range attrs {
+		node.AttrSpans[attr.Key] = attr.Span
+		switch attr.Key {
+		case "label":
+			node.Label = attr.Text
+		case "class":
+			node.Classes = strings.Fields(attr.Text)
+		default:
+			node.Attributes[attr.Key] = attr.Text
+			node.Values[attr.Key] = attr.Value
+		}
+	}
+	return node, nil
+}
+
+func interpretEdges(in *Interpreter, diagram *Diagram, form Value) error {
+	for _, edgeForm := range form.List[1:] {
+		edges, written, err := in.interpretEdge(edgeForm)
+		if err != nil {
+			in.report(err)
+			continue
+		}
+		for i, ends := range written {
+			in.endpoints[len(diagram.Edges)+i] = ends
+		}
+		diagram.Edges = append(diagram.Edges, edges...)
+	}
+	return nil
+}
+
+// interpretEdge expands an edge form into edges. The form lists two or
+// more endpoints followed by :key value attributes:
+//
+//	("a" "b")                   a single edge
+//	("a" "b" "c")               a chain a->b, b->c
+//	("a" ("b" "c"))             fan-out a->b, a->c
+//	(("a" "b") "c")             fan-in a->c, b->c
+//	("a:e" "b:table")           ports: the east side of a, port table of b
+//
+// Every generated edge receives the attributes. Malformed attributes follow
+// the same recovery rules as interpretNode. The endpoints of each edge as
+// written are returned alongside it.
+func (in *Interpreter) interpretEdge(form Value) ([]Edge, []edgeEndpoints, error) {
+	if form.Kind != ValueList {
+		return nil, nil, newSourceError(form.Span, "expected '(', got %s", form.describe())
+	}
+
+	var steps [][]string
+	i := 0
+	for ; i < len(form.List) && form.List[i].Kind != ValueKeyword; i++ {
+		endpoints, err := readEndpoints(form.List[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		steps = append(steps, endpoints)
+	}
+	if len(steps) == 0 {
+		return nil, nil, newSourceError(elementSpan(form, 0), "expected from node, got %s", describeElement(form, 0))
+	}
+	if len(steps) == 1 {
+		return nil, nil, newSourceError(elementSpan(form, 1), "expected to node, got %s", describeElement(form, 1))
+	}
+
+	attrs, err := readAttributes(form, i)
+	in.report(err)
+
+	var edges []Edge
+	var written []edgeEndpoints
+	for step := 0; step+1 < len(steps); step++ {
+		for _, from := range steps[step] {
+			for _, to := range steps[step+1] {
+				edges = append(edges, newEdge(from, to, form.Span, attrs))
+				written = append(written, edgeEndpoints{from: from, to: to})
+			}
+		}
+	}
+	return edges, written, nil
+}
+
+// readEndpoints returns the node IDs named by one position of an edge
+// form: a single ID, or a list of IDs for fan-out and fan-in
+func readEndpoints(value Value) ([]string, error) {
+	if value.IsAtom() {
+		return []string{value.Text}, nil
+	}
+	if len(value.List) == 0 {
+		return nil, newSourceError(value.Span, "expected node IDs in endpoint list, got ()")
+	}
+
+	ids := make([]string, len(value.List))
+	for i, elem := range value.List {
+		if !elem.IsAtom() {
+			return nil, newSourceError(elem.Span, "expected node ID in endpoint list, got %s", elem.describe())
+		}
+		ids[i] = elem.Text
+	}
+	return ids, nil
+}
+
+// newEdge creates an edge carrying its own copy of the attributes. An
+// "id:port" endpoint is split here, and joined again by
+// resolvePortEndpoints if it turns out to name a declared node.
+func newEdge(from, to string, span Span, attrs []attribute) Edge {
+	fromID, fromPort := splitPort(from)
+	toID, toPort := splitPort(to)
+	edge := Edge{
+		From:       fromID,
+		To:         toID,
+		Label:      "",
+		FromPort:   fromPort,
+		ToPort:     toPort,
+		Attributes: make(map[string]string),
+		Values:     make(map[string]Value),
+		Span:       span,
+		AttrSpans:  make(map[string]Span),
+	}
+	for _, attr := range attrs {
+		edge.AttrSpans[attr.Key] = attr.Span
+		switch attr.Key {
+		case "label":
+			edge.Label = attr.Text
+		case "class":
+			edge.Classes = strings.Fields(attr.Text)
+		case "from-port":
+			edge.FromPort = attr.Text
+		case "to-port":
+			edge.ToPort = attr.Text
+		default:
+			edge.Attributes[attr.Key] = attr.Text
+			edge.Values[attr.Key] = attr.Value
+		}
+	}
+	return edge
+}
+
+func interpretGroup(in *Interpreter, diagram *Diagram, form Value) error {
+	group, err := in.interpretGroupForm(diagram, form)
+	if err != nil {
+		return err
+	}
+	diagram.Groups = append(diagram.Groups, group)
+	return nil
+}
+
+// interpretGroupForm builds a group from
+// (group "id" :key value ... (nodes ...) (edges ...) (group ...)).
+// Nodes and edges declared inside the group are added to the diagram.
+func (in *Interpreter) interpretGroupForm(diagram *Diagram, form Value) (Group, error) {
+	if len(form.List) < 2 || !form.List[1].IsAtom() {
+		return Group{}, newSourceError(elementSpan(form, 1), "expected group id, got %s", describeElement(form, 1))
+	}
+
+	groupID := form.List[1].Text
+	group := Group{
+		ID:         groupID,
+		Label:      groupID,
+		Attributes: make(map[string]string),
+		Values:     make(map[string]Value),
+		Span:       form.Span,
+		AttrSpans:  make(map[string]Span),
+	}
+
+	for i := 2; i < len(form.List); i++ {
+		elem := form.List[i]
+		switch elem.Kind {
+		case ValueKeyword:
+			// A list after a keyword is its value unless it is part of
+			// the group body
+			if i+1 >= len(form.List) || !isAttributeValue(elem.Text, form.List[i+1]) || isGroupBody(form.List[i+1]) {
+				in.report(newSourceError(elementSpan(form, i+1), "expected value, got %s", describeElement(form, i+1)))
+				continue
+			}
+			i++
+			attr, err := newAttribute(elem, form.List[i])
+			if err != nil {
+				in.report(err)
+				continue
+			}
+			group.AttrSpans[attr.Key] = attr.Span
+			if attr.Key == "label" {
+				group.Label = attr.Text
+			} else {
+				group.Attributes[attr.Key] = attr.Text
+				group.Values[attr.Key] = attr.Value
+			}
+		case ValueList:
+			switch elem.Head() {
+			case "nodes":
+				first := len(diagram.Nodes)
+				in.report(interpretNodes(in, diagram, elem))
+				for _, node := range diagram.Nodes[first:] {
+					group.Nodes = append(group.Nodes, node.ID)
+				}
+			case "edges":
+				in.report(interpretEdges(in, diagram, elem))
+			case "group":
+				child, err := in.interpretGroupForm(diagram, elem)
+				if err != nil {
+					in.report(err)
+					continue
+				}
+				group.Groups = append(group.Groups, child)
+			default:
+				in.report(newSourceError(elementSpan(elem, 0), "expected nodes, edges or group, got %s", describeElement(elem, 0)))
+			}
+		default:
+			in.report(newSourceError(elem.Span, "expected keyword or '(', got %s", elem.describe()))
+		}
+	}
+	return group, nil
+}
+
+// isGroupBody reports whether value is a form nested in a group
+func isGroupBody(value Value) bool {
+	switch value.Head() {
+	case "nodes", "edges", "group":
+		return true
+	}
+	return false
+}
+
+// attribute is a :key value pair read from a form
+type attribute struct {
+	Key   string
+	Text  string
+	Value Value
+	Span  Span
+}
+
+// readAttributes reads the :key value pairs of form starting at element
+// index start. Malformed pairs are skipped and reported in the returned
+// ErrorList alongside the well-formed attributes.
+func readAttributes(form Value, start int) ([]attribute, error) {
+	var attrs []attribute
+	var errors ErrorList
+	for i := start; i < len(form.List); i += 2 {
+		key := form.List[i]
+		if key.Kind != ValueKeyword {
+			errors.Add(newSourceError(key.Span, "expected keyword, got %s", key.describe()))
+			// Resume at the next keyword rather than reporting every
+			// element of a misplaced run
+			for i+1 < len(form.List) && form.List[i+1].Kind != ValueKeyword {
+				i++
+			}
+			i--
+			continue
+		}
+		if i+1 >= len(form.List) || !isAttributeValue(key.Text, form.List[i+1]) {
+			errors.Add(newSourceError(elementSpan(form, i+1), "expected value, got %s", describeElement(form, i+1)))
+			if i+1 < len(form.List) && form.List[i+1].Kind == ValueKeyword {
+				i-- // the keyword starts the next pair
+			}
+			continue
+		}
+
+		attr, err := newAttribute(key, form.List[i+1])
+		if err != nil {
+			errors.Add(err)
+			continue
+		}
+		attrs = append(attrs, attr)
+	}
+	return attrs, errors.Err()
+}
+
+// isAttributeValue reports whether value can follow :key. Lists are
+// accepted for every attribute but the label.
+func isAttributeValue(key string, value Value) bool {
+	return value.IsAtom() || (value.Kind == ValueList && key != "label")
+}
+
+// newAttribute builds the attribute for a :key value pair. The text of a
+// list value is its elements separated by spaces.
+func newAttribute(key, value Value) (attribute, error) {
+	text := value.Text
+	if value.Kind == ValueList {
+		names, err := listNames(value)
+		if err != nil {
+			return attribute{}, err
+		}
+		text = strings.Join(names, " ")
+	}
+	return attribute{
+		Key:   key.Text,
+		Text:  text,
+		Value: value,
+		Span:  Span{Start: key.Span.Start, End: value.Span.End},
+	}, nil
+}
+
+// listNames returns the atoms of a list attribute value
+func listNames(value Value) ([]string, error) {
+	names := make([]string, len(value.List))
+	for i, elem := range value.List {
+		if !elem.IsAtom() {
+			return nil, newSourceError(elem.Span, "expected name in list, got %s", elem.describe())
+		}
+		names[i] = elem.Text
+	}
+	return names, nil
+}
+
+// intArgument reads the integer at element index i of form
+func intArgument(form Value, i int, name string) (int, error) {
+	if i >= len(form.List) || !form.List[i].IsAtom() {
+		return 0, newSourceError(elementSpan(form, i), "expected %s, got %s", name, describeElement(form, i))
+	}
+	arg := form.List[i]
+	if arg.Kind != ValueInt {
+		return 0, newSourceError(arg.Span, "invalid %s: %s", name, arg.Text)
+	}
+	return int(arg.Int), nil
+}
+
+// expectEnd reports an error if form has elements from index i onwards
+func expectEnd(form Value, i int) error {
+	if i < len(form.List) {
+		return newSourceError(form.List[i].Span, "expected ')', got %s", form.List[i].describe())
+	}
+	return nil
+}
+
+// elementSpan returns the location of element i of a list, or of its
+// closing parenthesis when the list is shorter
+func elementSpan(form Value, i int) Span {
+	if i < len(form.List) {
+		return form.List[i].Span
+	}
+	return form.CloseSpan()
+}
+
+// describeElement renders element i of a list for error messages
+func describeElement(form Value, i int) string {
+	if i < len(form.List) {
+		return form.List[i].describe()
+	}
+	return ")"
+}
@@ -0,0 +1,578 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestInterpreterDirectives tests interpreting a value tree into a diagram
+func TestInterpreterDirectives(t *testing.T) {
+	input := `(diagram
+		(size 640 480)
+		(layout-direction left-to-right)
+		(node-style :shape "rect" :stroke-width 2)
+		(edge-style :stroke "#555")
+		(nodes
+			(id "A" :label "Start" :fill "#fff")
+			(id 42))
+		(edges
+			("A" 42 :label "go" :weight 1.5)))`
+
+	form, err := NewReader(NewLexer(input)).Read()
+	if err != nil {
+		t.Fatalf("Unexpected read error: %v", err)
+	}
+
+	diagram, err := NewInterpreter().Interpret(form)
+	if err != nil {
+		t.Fatalf("Unexpected interpret error: %v", err)
+	}
+
+	if diagram.Width != 640 || diagram.Height != 480 {
+		t.Errorf("Expected size 640x480, got %dx%d", diagram.Width, diagram.Height)
+	}
+	if diagram.LayoutDirection != "left-to-right" {
+		t.Errorf("Expected left-to-right, got %s", diagram.LayoutDirection)
+	}
+	if diagram.NodeStyle["stroke-width"] != "2" {
+		t.Errorf("Expected numeric style value kept as text, got '%s'", diagram.NodeStyle["stroke-width"])
+	}
+	if diagram.Nodes[1].ID != "42" || diagram.Nodes[1].Label != "42" {
+		t.Errorf("Expected numeric node id '42', got %+v", diagram.Nodes[1])
+	}
+	if diagram.Edges[0].To != "42" || diagram.Edges[0].Attributes["weight"] != "1.5" {
+		t.Errorf("Unexpected edge %+v", diagram.Edges[0])
+	}
+}
+
+// TestInterpreterErrors tests error messages and locations from the interpreter
+func TestInterpreterErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"not a list", "diagram", "1:1: expected '(', got diagram"},
+		{"empty form", "()", "1:2: expected 'diagram', got )"},
+		{"unknown directive", "(diagram\n  (colour red))", "2:4: unknown directive: colour"},
+		{"extra size argument", "(diagram (size 1 2 3))", "1:20: expected ')', got 3"},
+		{"float size", "(diagram (size 1.5 2))", "1:16: invalid width: 1.5"},
+		{"bad direction", "(diagram (layout-direction sideways))", "1:28: invalid layout direction: sideways"},
+		{"list as value", "(diagram (nodes (id \"A\" :label (x))))", "1:32: expected value, got (x)"},
+		{"keyword as value", "(diagram (edge-style :stroke :fill))", "1:30: expected value, got :fill"},
+		{"missing value", "(diagram (node-style :shape))", "1:28: expected value, got )"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form, err := NewReader(NewLexer(tt.input)).Read()
+			if err != nil {
+				t.Fatalf("Unexpected read error: %v", err)
+			}
+
+			_, err = NewInterpreter().Interpret(form)
+			if err == nil {
+				t.Fatalf("Expected error")
+			}
+			if !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error containing '%s', got: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+// TestInterpreterGroups tests nested group forms
+func TestInterpreterGroups(t *testing.T) {
+	input := `(diagram
+		(group "region" :label "us-east-1" :fill "#eef"
+			(group "vpc" :label "VPC"
+				(nodes
+					(id "api")
+					(id "worker"))
+				(edges
+					("api" "worker")))
+			(nodes
+				(id "dns")))
+		(edges
+			("dns" "vpc")))`
+
+	diagram := ParseTestInput(t, input)
+
+	if len(diagram.Groups) != 1 {
+		t.Fatalf("Expected 1 top-level group, got %d", len(diagram.Groups))
+	}
+	region := diagram.Groups[0]
+	if region.Label != "us-east-1" || region.Attributes["fill"] != "#eef" {
+		t.Errorf("Unexpected region attributes: %+v", region)
+	}
+	if len(region.Nodes) != 1 || region.Nodes[0] != "dns" {
+		t.Errorf("Expected region to contain dns directly, got %v", region.Nodes)
+	}
+	if len(region.Groups) != 1 || region.Groups[0].ID != "vpc" {
+		t.Fatalf("Expected nested vpc group, got %+v", region.Groups)
+	}
+
+	members := region.Members()
+	if strings.Join(members, ",") != "dns,api,worker" {
+		t.Errorf("Unexpected region members: %v", members)
+	}
+
+	if len(diagram.Nodes) != 3 || len(diagram.Edges) != 2 {
+		t.Errorf("Expected group contents in the flat node and edge lists, got %d nodes and %d edges",
+			len(diagram.Nodes), len(diagram.Edges))
+	}
+
+	all := diagram.AllGroups()
+	if len(all) != 2 || all[0].ID != "region" || all[1].ID != "vpc" {
+		t.Errorf("Expected groups in parent-first order, got %+v", all)
+	}
+	if _, ok := diagram.FindGroup("vpc"); !ok {
+		t.Errorf("Expected to find nested group")
+	}
+	if region.AttrSpan("fill").Start.Line != 2 {
+		t.Errorf("Expected fill attribute on line 2, got %s", region.AttrSpan("fill"))
+	}
+}
+
+// TestInterpreterGroupErrors tests malformed group forms
+func TestInterpreterGroupErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"missing id", "(diagram (group))", "expected group id, got )"},
+		{"unknown content", "(diagram (group \"g\" (shapes)))", "expected nodes, edges or group, got shapes"},
+		{"stray atom", "(diagram (group \"g\" oops))", "expected keyword or '(', got oops"},
+		{"missing value", "(diagram (group \"g\" :label))", "expected value, got )"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			AssertParseError(t, tt.input, tt.expected)
+		})
+	}
+}
+
+// TestInterpreterEdgeShorthand tests chain, fan-out and fan-in edge forms
+func TestInterpreterEdgeShorthand(t *testing.T) {
+	tests := []struct {
+		name     string
+		form     string
+		expected []string
+	}{
+		{"single edge", `("a" "b")`, []string{"a->b"}},
+		{"chain", `("a" "b" "c" "d")`, []string{"a->b", "b->c", "c->d"}},
+		{"fan-out", `("a" ("b" "c" "e"))`, []string{"a->b", "a->c", "a->e"}},
+		{"fan-in", `(("b" "c") "d")`, []string{"b->d", "c->d"}},
+		{"fan-out then fan-in", `("a" ("b" "c") "d")`, []string{"a->b", "a->c", "b->d", "c->d"}},
+		{"atoms", `(start (left right) end)`, []string{"start->left", "start->right", "left->end", "right->end"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagram := ParseTestInput(t, "(diagram (edges "+tt.form+"))")
+
+			var got []string
+			for _, edge := range diagram.Edges {
+				got = append(got, edge.From+"->"+edge.To)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.expected, " ") {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestInterpreterEdgeShorthandAttributes tests that attributes apply to
+// every generated edge independently
+func TestInterpreterEdgeShorthandAttributes(t *testing.T) {
+	diagram := ParseTestInput(t, `(diagram (edges ("a" ("b" "c") "d" :label "flow" :style "dashed")))`)
+
+	if len(diagram.Edges) != 4 {
+		t.Fatalf("Expected 4 edges, got %d", len(diagram.Edges))
+	}
+	for _, edge := range diagram.Edges {
+		if edge.Label != "flow" || edge.Attributes["style"] != "dashed" {
+			t.Errorf("Edge %s->%s did not receive attributes: %+v", edge.From, edge.To, edge)
+		}
+		if edge.AttrSpan("style").Start.Column != 50 {
+			t.Errorf("Expected style attribute span at column 50, got %s", edge.AttrSpan("style"))
+		}
+	}
+
+	diagram.Edges[0].Attributes["style"] = "dotted"
+	if diagram.Edges[1].Attributes["style"] != "dashed" {
+		t.Errorf("Generated edges should not share attribute maps")
+	}
+}
+
+// TestInterpreterEdgeShorthandErrors tests malformed edge shorthand
+func TestInterpreterEdgeShorthandErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"single endpoint before attributes", `(diagram (edges ("a" :label "x")))`, "expected to node, got :label"},
+		{"empty endpoint list", `(diagram (edges ("a" ())))`, "expected node IDs in endpoint list, got ()"},
+		{"nested endpoint list", `(diagram (edges ("a" ("b" ("c")))))`, "expected node ID in endpoint list, got (\"c\")"},
+		{"empty edge", `(diagram (edges ()))`, "expected from node, got )"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			AssertParseError(t, tt.input, tt.expected)
+		})
+	}
+}
+
+// TestInterpreterClasses tests defclass and :class on nodes and edges
+func TestInterpreterClasses(t *testing.T) {
+	input := `(diagram
+		(defclass "error" :fill "#ff6b6b" :shape "rect")
+		(defclass critical :stroke "red")
+		(nodes
+			(id "A" :class "error")
+			(id "B" :class ("error" "critical") :fill "#fff"))
+		(edges
+			("A" "B" :class "error critical")))`
+
+	diagram := ParseTestInput(t, input)
+
+	if len(diagram.Classes) != 2 || diagram.Classes[0].Name != "error" || diagram.Classes[1].Name != "critical" {
+		t.Fatalf("Unexpected classes %+v", diagram.Classes)
+	}
+	if diagram.Classes[0].Attributes["fill"] != "#ff6b6b" {
+		t.Errorf("Unexpected class attributes %v", diagram.Classes[0].Attributes)
+	}
+
+	a, b := diagram.Nodes[0], diagram.Nodes[1]
+	if strings.Join(a.Classes, ",") != "error" || strings.Join(b.Classes, ",") != "error,critical" {
+		t.Errorf("Unexpected node classes %v and %v", a.Classes, b.Classes)
+	}
+	if _, ok := a.Attributes["class"]; ok {
+		t.Errorf("Expected :class not to be stored as an attribute")
+	}
+	if strings.Join(diagram.Edges[0].Classes, ",") != "error,critical" {
+		t.Errorf("Unexpected edge classes %v", diagram.Edges[0].Classes)
+	}
+
+	if fill, _ := diagram.NodeAttribute(a, "fill"); fill != "#ff6b6b" {
+		t.Errorf("Expected fill from class, got %q", fill)
+	}
+	if fill, _ := diagram.NodeAttribute(b, "fill"); fill != "#fff" {
+		t.Errorf("Expected node attribute to override class, got %q", fill)
+	}
+	if stroke, _ := diagram.EdgeAttribute(diagram.Edges[0], "stroke"); stroke != "red" {
+		t.Errorf("Expected stroke from second class, got %q", stroke)
+	}
+	if _, ok := diagram.NodeAttribute(a, "stroke"); ok {
+		t.Errorf("Expected no stroke for A")
+	}
+}
+
+// TestInterpreterClassErrors tests error reporting for defclass and :class
+func TestInterpreterClassErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"missing class name", "(diagram (defclass :fill \"red\"))", "1:20: expected class name, got :fill"},
+		{"nested class list", "(diagram (nodes (id \"A\" :class (\"a\" (\"b\")))))", "1:37: expected name in list, got (\"b\")"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			AssertParseError(t, tt.input, tt.expected)
+		})
+	}
+}
+
+// TestInterpreterListAttributes tests list values after keywords
+func TestInterpreterListAttributes(t *testing.T) {
+	input := `(diagram
+		(group "g" :tags ("internal" "beta") (nodes (id "A" :tags (db cache)))))`
+
+	diagram := ParseTestInput(t, input)
+
+	group := diagram.Groups[0]
+	if group.Attributes["tags"] != "internal beta" || len(group.Nodes) != 1 {
+		t.Errorf("Unexpected group %+v", group)
+	}
+	if value, ok := group.Attr("tags"); !ok || value.Kind != ValueList {
+		t.Errorf("Expected typed list value, got %+v", value)
+	}
+	if diagram.Nodes[0].Attributes["tags"] != "db cache" {
+		t.Errorf("Unexpected node tags %q", diagram.Nodes[0].Attributes["tags"])
+	}
+
+	// The group body is never taken as an attribute value
+	AssertParseError(t, `(diagram (group "g" :tags (nodes (id "A"))))`, "expected value, got (nodes")
+}
+
+// TestInterpreterOptions tests the options directive
+func TestInterpreterOptions(t *testing.T) {
+	diagram := ParseTestInput(t, `(diagram (options :implicit-nodes true))`)
+	if !diagram.Options.ImplicitNodes {
+		t.Errorf("Expected implicit nodes to be enabled")
+	}
+	if diagram := ParseTestInput(t, `(diagram)`); diagram.Options.ImplicitNodes {
+		t.Errorf("Expected strict mode by default")
+	}
+
+	AssertParseError(t, `(diagram (options :implicit-nodes "yes"))`, `1:19: invalid :implicit-nodes: expected boolean, got "yes"`)
+	AssertParseError(t, `(diagram (options :strict true))`, "1:19: unknown option: :strict")
+	AssertParseError(t, `(diagram (options :implicit-node true))`, "1:19: unknown option: :implicit-node (did you mean :implicit-nodes?)")
+	AssertParseError(t, `(diagram (options :fill "red"))`, "1:19: unknown option: :fill")
+
+	if diagram := ParseTestInput(t, `(diagram (options :directed false))`); !diagram.Options.Undirected {
+		t.Errorf("Expected :directed false to make the diagram undirected")
+	}
+	if diagram := ParseTestInput(t, `(diagram)`); diagram.Options.Undirected {
+		t.Errorf("Expected diagrams to be directed by default")
+	}
+	AssertParseError(t, `(diagram (options :directed no))`, "1:19: invalid :directed: expected boolean, got no")
+}
+
+// TestEdgeDirection tests how :dir, classes, edge-style and :directed
+// combine into the direction of an edge
+func TestEdgeDirection(t *testing.T) {
+	input := `(diagram
+  (options :directed false)
+  (defclass "flow" :dir "forward")
+  (nodes (id "A") (id "B"))
+  (edges
+    ("A" "B")
+    ("A" "B" :dir "back")
+    ("A" "B" :dir both)
+    ("A" "B" :class "flow")))`
+
+	diagram := ParseTestInput(t, input)
+	expected := []EdgeDir{DirNone, DirBack, DirBoth, DirForward}
+	for i, edge := range diagram.Edges {
+		if dir := diagram.EdgeDirection(edge); dir != expected[i] {
+			t.Errorf("Edge %d: expected %s, got %s", i, expected[i], dir)
+		}
+	}
+
+	diagram.Options.Undirected = false
+	if dir := diagram.EdgeDirection(diagram.Edges[0]); dir != DirForward {
+		t.Errorf("Expected directed diagrams to default to forward, got %s", dir)
+	}
+	diagram.EdgeStyle["dir"] = "both"
+	if dir := diagram.EdgeDirection(diagram.Edges[0]); dir != DirBoth {
+		t.Errorf("Expected edge-style :dir to apply, got %s", dir)
+	}
+}
+
+// TestInterpreterPortNodeIDs tests that endpoints naming a declared node
+// with a ':' in its ID are not split, wherever the node is declared
+func TestInterpreterPortNodeIDs(t *testing.T) {
+	input := `(diagram
+  (edges
+    ("app" "db:primary")
+    ("app" "db:replica")
+    ("app" "db:primary:n")
+    ("db:primary" "app" :from-port "e"))
+  (nodes (id "app") (id "db"))
+  (group "primary" (nodes (id "db:primary"))))`
+
+	diagram := ParseTestInput(t, input)
+	expected := []Edge{
+		{From: "app", To: "db:primary"},
+		{From: "app", To: "db", ToPort: "replica"},
+		{From: "app", To: "db:primary", ToPort: "n"},
+		{From: "db:primary", FromPort: "e", To: "app"},
+	}
+	for i, edge := range diagram.Edges {
+		e := expected[i]
+		if edge.From != e.From || edge.FromPort != e.FromPort || edge.To != e.To || edge.ToPort != e.ToPort {
+			t.Errorf("Edge %d: expected %s:%s -> %s:%s, got %s:%s -> %s:%s", i,
+				e.From, e.FromPort, e.To, e.ToPort, edge.From, edge.FromPort, edge.To, edge.ToPort)
+		}
+	}
+
+	files := map[string]string{
+		"main.sxd": `(diagram (include "db.sxd" :as "sub"))`,
+		"db.sxd":   `(nodes (id "app") (id "db:primary")) (edges ("app" "db:primary"))`,
+	}
+	included, err := interpretFiles(t, files, "main.sxd")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if edge := included.Edges[0]; edge.To != "sub/db:primary" || edge.ToPort != "" {
+		t.Errorf("Expected the namespaced node sub/db:primary, got %s:%s", edge.To, edge.ToPort)
+	}
+}
+
+// TestInterpreterPorts tests "id:port" endpoints and :from-port/:to-port
+func TestInterpreterPorts(t *testing.T) {
+	input := `(diagram
+  (nodes (id "table" :ports ("id" "name")) (id "db") (id "x"))
+  (edges
+    ("db:north" "table:name")
+    ("db" ("table" "x") :from-port "se" :to-port "w")))`
+
+	diagram := ParseTestInput(t, input)
+	expected := []Edge{
+		{From: "db", FromPort: "north", To: "table", ToPort: "name"},
+		{From: "db", FromPort: "se", To: "table", ToPort: "w"},
+		{From: "db", FromPort: "se", To: "x", ToPort: "w"},
+	}
+	if len(diagram.Edges) != len(expected) {
+		t.Fatalf("Expected %d edges, got %d", len(expected), len(diagram.Edges))
+	}
+	for i, edge := range diagram.Edges {
+		e := expected[i]
+		if edge.From != e.From || edge.FromPort != e.FromPort || edge.To != e.To || edge.ToPort != e.ToPort {
+			t.Errorf("Edge %d: expected %s:%s -> %s:%s, got %s:%s -> %s:%s", i,
+				e.From, e.FromPort, e.To, e.ToPort, edge.From, edge.FromPort, edge.To, edge.ToPort)
+		}
+		if _, ok := edge.Attributes["from-port"]; ok {
+			t.Errorf("Edge %d: ports should not be kept as attributes", i)
+		}
+	}
+
+	if ports := diagram.NodePorts(diagram.Nodes[0]); strings.Join(ports, ",") != "id,name" {
+		t.Errorf("Expected ports id,name, got %v", ports)
+	}
+}
+
+// TestInterpreterMultipleDiagrams tests files holding several named
+// diagrams with shared settings
+func TestInterpreterMultipleDiagrams(t *testing.T) {
+	input := `(node-style :shape "ellipse")
+(defclass "db" :fill "#eee")
+(layout-direction left-to-right)
+
+(diagram "overview"
+  (nodes (id "app") (id "store" :class "db")))
+
+(diagram "detail"
+  (size 400 300)
+  (nodes (id "api") (id "cache" :class "db"))
+  (edges ("api" "cache")))`
+
+	diagrams, err := NewParser(NewLexer(input)).ParseDiagrams()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(diagrams) != 2 {
+		t.Fatalf("Expected 2 diagrams, got %d", len(diagrams))
+	}
+
+	overview, detail := diagrams[0], diagrams[1]
+	if overview.Name != "overview" || detail.Name != "detail" {
+		t.Errorf("Expected diagrams overview and detail, got %s and %s", overview.Name, detail.Name)
+	}
+	if len(overview.Nodes) != 2 || len(detail.Edges) != 1 {
+		t.Errorf("Diagram contents mixed up: %+v, %+v", overview.Nodes, detail.Edges)
+	}
+	for _, diagram := range diagrams {
+		if diagram.NodeStyle["shape"] != "ellipse" || diagram.LayoutDirection != "left-to-right" {
+			t.Errorf("%s: shared settings not applied", diagram.Name)
+		}
+		if fill, _ := diagram.NodeAttribute(diagram.Nodes[1], "fill"); fill != "#eee" {
+			t.Errorf("%s: shared class not applied, fill '%s'", diagram.Name, fill)
+		}
+	}
+	if overview.Width != 800 || detail.Width != 400 {
+		t.Errorf("Expected widths 800 and 400, got %d and %d", overview.Width, detail.Width)
+	}
+
+	// A single diagram may be named and is returned by ParseDiagram
+	diagram := ParseTestInput(t, `(diagram "only" (nodes (id "A")))`)
+	if diagram.Name != "only" || len(diagram.Nodes) != 1 {
+		t.Errorf("Expected diagram 'only' with one node, got %+v", diagram)
+	}
+}
+
+// TestInterpreterMultipleDiagramErrors tests errors in files holding
+// several diagrams
+func TestInterpreterMultipleDiagramErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"unnamed", "(diagram \"a\")\n(diagram)", "2:2: diagram needs a name when a file holds several diagrams"},
+		{"duplicate name", "(diagram \"a\")\n(diagram \"a\")", "2:10: duplicate diagram name: a"},
+		{"name with a path", `(diagram "../escaped")`, `1:10: invalid diagram name: ../escaped (names cannot contain '/', '\' or '..')`},
+		{"name with a backslash", `(diagram "a\\b")`, `1:10: invalid diagram name: a\b`},
+		{"directive outside diagram", "(nodes (id \"A\"))\n(diagram)", "1:2: expected 'diagram', got nodes"},
+		{"no diagram", "(size 1 2)", "1:2: expected 'diagram', got size"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewParser(NewLexer(tt.input)).ParseDiagrams()
+			if err == nil {
+				t.Fatalf("Expected error")
+			}
+			if !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error containing '%s', got: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+// TestInterpreterMetadata tests the title, description and meta directives
+func TestInterpreterMetadata(t *testing.T) {
+	diagram := ParseTestInput(t, `(diagram
+  (title "Checkout" :position bottom)
+  (description "How an order is paid")
+  (meta :author "Jane Doe" :version 2))`)
+
+	if diagram.Title != "Checkout" || diagram.TitlePosition != "bottom" {
+		t.Errorf("Expected title 'Checkout' at the bottom, got '%s' at '%s'", diagram.Title, diagram.TitlePosition)
+	}
+	if diagram.Description != "How an order is paid" {
+		t.Errorf("Unexpected description '%s'", diagram.Description)
+	}
+	if diagram.Meta["author"] != "Jane Doe" || diagram.Meta["version"] != "2" {
+		t.Errorf("Unexpected meta %v", diagram.Meta)
+	}
+
+	// Meta entries outside the diagrams apply to all of them
+	diagrams, err := NewParser(NewLexer(`(meta :author "Ops")
+(diagram "a" (title "A"))
+(diagram "b" (meta :author "Dev"))`)).ParseDiagrams()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diagrams[0].Meta["author"] != "Ops" || diagrams[1].Meta["author"] != "Dev" {
+		t.Errorf("Expected authors Ops and Dev, got %v and %v", diagrams[0].Meta, diagrams[1].Meta)
+	}
+	if diagrams[1].Title != "" {
+		t.Errorf("Expected titles to stay with their diagram")
+	}
+}
+
+// TestInterpreterMetadataErrors tests errors in metadata directives
+func TestInterpreterMetadataErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"missing title", "(diagram (title))", "1:16: expected title, got )"},
+		{"bad position", "(diagram (title \"T\" :position left))", "1:21: invalid title position: left (expected top or bottom)"},
+		{"unknown title option", "(diagram (title \"T\" :size 3))", "1:21: unknown title option: :size"},
+		{"extra description", "(diagram (description \"a\" \"b\"))", "1:27: expected ')', got \"b\""},
+		{"unknown meta key", "(diagram (meta :owner \"me\"))", "1:16: unknown meta key: :owner"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewParser(NewLexer(tt.input)).ParseDiagram()
+			if err == nil {
+				t.Fatalf("Expected error")
+			}
+			if !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error containing '%s', got: %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"math"
+	"sort"
 )
 
 // LayoutNode represents a node with layout information
@@ -15,6 +16,12 @@ type LayoutNode struct {
 	Shape  string
 	Style  string
 	Color  string
+
+	// Classes applied with :class, emitted as CSS classes
+	Classes []string
+
+	// Attributes are the node's own attributes, drawn as inline styles
+	Attributes map[string]string
 }
 
 // LayoutEdge represents an edge with layout information
@@ -25,6 +32,30 @@ type LayoutEdge struct {
 	Label  string
 	X      float64
 	Y      float64
+
+	// Classes applied with :class, emitted as CSS classes
+	Classes []string
+
+	// Dir selects the arrowheads drawn; empty means forward
+	Dir EdgeDir
+
+	// Attributes are the edge's own attributes, drawn as inline styles
+	Attributes map[string]string
+}
+
+// LayoutGroup represents the bounding box drawn around a group. Depth is
+// the nesting level, with top-level groups at depth 0.
+type LayoutGroup struct {
+	ID     string
+	Label  string
+	X      float64
+	Y      float64
+	Width  float64
+	Height float64
+	Depth  int
+
+	// Attributes are the group's own attributes, drawn as inline styles
+	Attributes map[string]string
 }
 
 // Point represents a 2D coordinate
@@ -39,6 +70,7 @@ type Layout struct {
 	Height float64
 	Nodes  map[string]LayoutNode
 	Edges  []LayoutEdge
+	Groups []LayoutGroup
 }
 
 // LayoutDirection represents the direction of the layout
@@ -58,15 +90,27 @@ type SimpleLayouter struct {
 	HorizontalGap float64
 	VerticalGap   float64
 	Direction     LayoutDirection
+
+	// Space between a group's border and its contents, and extra room
+	// above the contents for the group label
+	GroupPadding     float64
+	GroupLabelHeight float64
+
+	// Space kept between a node's label and its outline. Nodes are
+	// NodeWidth x NodeHeight unless their label needs more room.
+	LabelPadding float64
 }
 
 func NewSimpleLayouter() *SimpleLayouter {
 	return &SimpleLayouter{
-		NodeWidth:     100.0,
-		NodeHeight:    50.0,
-		HorizontalGap: 80.0,
-		VerticalGap:   80.0,
-		Direction:     DirectionTopToBottom,
+		NodeWidth:        100.0,
+		NodeHeight:       50.0,
+		HorizontalGap:    80.0,
+		VerticalGap:      80.0,
+		Direction:        DirectionTopToBottom,
+		GroupPadding:     15.0,
+		GroupLabelHeight: 18.0,
+		LabelPadding:     8.0,
 	}
 }
 
@@ -92,9 +136,15 @@ func (l *SimpleLayouter) LayoutDiagram(diagram *Diagram) (*Layout, error) {
 	// Calculate layout levels
 	levels := l.calculateLevels(graph, diagram.Nodes)
 
+	// Keep members of the same group next to each other
+	l.orderLevelsByGroup(levels, diagram)
+
 	// Position nodes
 	layout := l.positionNodes(levels, diagram)
 
+	// Draw boxes around groups
+	l.addGroups(layout, diagram)
+
 	// Add edges
 	l.addEdges(layout, diagram)
 
@@ -113,18 +163,120 @@ func (l *SimpleLayouter) buildDependencyGraph(diagram *Diagram) map[string][]str
 		graph[node.ID] = []string{}
 	}
 
-	// Add edges (from -> to relationships)
+	// Edges to or from a group rank relative to all of its members
+	groupMembers := make(map[string][]string)
+	for _, group := range diagram.AllGroups() {
+		groupMembers[group.ID] = group.Members()
+	}
+	expand := func(id string) []string {
+		if members, ok := groupMembers[id]; ok {
+			return members
+		}
+		return []string{id}
+	}
+
+	// Undirected edges point away from whichever endpoint a breadth-first
+	// walk reaches first, so they rank like a tree and never form cycles
+	// among themselves
+	var order map[string]int
 	for _, edge := range diagram.Edges {
-		if children, exists := graph[edge.From]; exists {
-			graph[edge.From] = append(children, edge.To)
-		} else {
-			graph[edge.From] = []string{edge.To}
+		if diagram.EdgeDirection(edge) == DirNone {
+			order = l.discoveryOrder(diagram, expand)
+			break
+		}
+	}
+
+	// Add edges (from -> to relationships). Edges drawn backwards still
+	// rank in declaration order, as the arrowheads are only decoration.
+	for _, edge := range diagram.Edges {
+		undirected := diagram.EdgeDirection(edge) == DirNone
+		for _, from := range expand(edge.From) {
+			for _, to := range expand(edge.To) {
+				if undirected && order[to] < order[from] {
+					graph[to] = append(graph[to], from)
+				} else {
+					graph[from] = append(graph[from], to)
+				}
+			}
 		}
 	}
 
 	return graph
 }
 
+// discoveryOrder numbers nodes in breadth-first order over all edges,
+// ignoring their direction. Walks start at the roots of directed edges, in
+// declaration order, so undirected edges hang below them.
+func (l *SimpleLayouter) discoveryOrder(diagram *Diagram, expand func(string) []string) map[string]int {
+	neighbours := make(map[string][]string)
+	hasParent := make(map[string]bool)
+	hasChild := make(map[string]bool)
+	for _, edge := range diagram.Edges {
+		directed := diagram.EdgeDirection(edge) != DirNone
+		for _, from := range expand(edge.From) {
+			for _, to := range expand(edge.To) {
+				neighbours[from] = append(neighbours[from], to)
+				neighbours[to] = append(neighbours[to], from)
+				if directed && from != to {
+					hasParent[to] = true
+					hasChild[from] = true
+				}
+			}
+		}
+	}
+
+	order := make(map[string]int)
+	walk := func(start string) {
+		if _, seen := order[start]; seen {
+			return
+		}
+		order[start] = len(order)
+		queue := []string{start}
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = queue[1:]
+			for _, next := range neighbours[id] {
+				if _, seen := order[next]; !seen {
+					order[next] = len(order)
+					queue = append(queue, next)
+				}
+			}
+		}
+	}
+
+	for _, node := range diagram.Nodes {
+		if hasChild[node.ID] && !hasParent[node.ID] {
+			walk(node.ID)
+		}
+	}
+	for _, node := range diagram.Nodes {
+		walk(node.ID)
+	}
+	return order
+}
+
+// orderLevelsByGroup reorders each level so that nodes sharing a group are
+// adjacent. Groups are ordered depth-first, which keeps nested groups
+// inside their parents; ungrouped nodes come first.
+func (l *SimpleLayouter) orderLevelsByGroup(levels [][]string, diagram *Diagram) {
+	if len(diagram.Groups) == 0 {
+		return
+	}
+
+	groupIndex := make(map[string]int)
+	for i, group := range diagram.AllGroups() {
+		for _, id := range group.Nodes {
+			groupIndex[id] = i + 1
+		}
+	}
+
+	for _, level := range levels {
+		sort.SliceStable(level, func(i, j int) bool {
+			return groupIndex[level[i]] < groupIndex[level[j]]
+		})
+	}
+}
+
 // calculateLevels assigns nodes to levels based on dependencies
 func (l *SimpleLayouter) calculateLevels(graph map[string][]string, nodes []Node) [][]string {
 	levels := [][]string{}
@@ -205,83 +357,90 @@ func (l *SimpleLayouter) positionNodes(levels [][]string, diagram *Diagram) *Lay
 		nodeMap[node.ID] = node
 	}
 
-	// Note: We don't reverse levels here because positioning logic will handle direction
-
-	// Calculate total layout dimensions first
-	maxLevels := len(levels)
-	maxNodesInLevel := 0
+	// Size every node to fit its label
+	shapes := make(map[string]string)
+	sizes := make(map[string]Point)
 	for _, level := range levels {
-		if len(level) > maxNodesInLevel {
-			maxNodesInLevel = len(level)
+		for _, nodeID := range level {
+			shapes[nodeID] = l.getNodeShape(diagram, nodeMap[nodeID])
+			width, height := l.nodeSize(nodeMap[nodeID], shapes[nodeID], l.nodeFontSize(diagram, nodeMap[nodeID]))
+			sizes[nodeID] = Point{X: width, Y: height}
 		}
 	}
 
-	// Position nodes level by level
-	for levelIndex, level := range levels {
-		var x, y float64
-		var startPos float64
-
-		switch l.Direction {
-		case DirectionTopToBottom:
-			// Top-to-bottom: level 0 at bottom, higher levels go toward top
-			totalHeight := float64(maxLevels-1) * (l.NodeHeight + l.VerticalGap)
-			y = totalHeight - float64(levelIndex)*(l.NodeHeight+l.VerticalGap) + l.NodeHeight/2
-
-			// Center nodes horizontally in each level
-			totalWidth := float64(len(level))*l.NodeWidth + float64(len(level)-1)*l.HorizontalGap
-			startPos = -totalWidth/2 + l.NodeWidth/2
-
-		case DirectionBottomToTop:
-			// Bottom-to-top: level 0 at top, higher levels go toward bottom
-			y = float64(levelIndex)*(l.NodeHeight+l.VerticalGap) + l.NodeHeight/2
-
-			// Center nodes horizontally in each level
-			totalWidth := float64(len(level))*l.NodeWidth + float64(len(level)-1)*l.HorizontalGap
-			startPos = -totalWidth/2 + l.NodeWidth/2
-
-		case DirectionLeftToRight:
-			// Standard left-to-right: level 0 at left
-			x = float64(levelIndex)*(l.NodeWidth+l.HorizontalGap) + l.NodeWidth/2
+	// Size of a node along the rank axis and across it
+	vertical := l.Direction == DirectionTopToBottom || l.Direction == DirectionBottomToTop
+	rankGap, crossGap := l.HorizontalGap, l.VerticalGap
+	if vertical {
+		rankGap, crossGap = l.VerticalGap, l.HorizontalGap
+	}
+	along := func(id string) float64 {
+		if vertical {
+			return sizes[id].Y
+		}
+		return sizes[id].X
+	}
+	across := func(id string) float64 {
+		if vertical {
+			return sizes[id].X
+		}
+		return sizes[id].Y
+	}
 
-			// Center nodes vertically in each level
-			totalHeight := float64(len(level))*l.NodeHeight + float64(len(level)-1)*l.VerticalGap
-			startPos = -totalHeight/2 + l.NodeHeight/2
+	// Centre of every level along the rank axis, counted from level 0,
+	// with each level as thick as its largest node
+	centres := make([]float64, len(levels))
+	total := 0.0
+	for levelIndex, level := range levels {
+		thickness := 0.0
+		for _, nodeID := range level {
+			thickness = math.Max(thickness, along(nodeID))
+		}
+		if levelIndex > 0 {
+			total += rankGap
+		}
+		centres[levelIndex] = total + thickness/2
+		total += thickness
+	}
 
-		case DirectionRightToLeft:
-			// Right-to-left: level 0 at right, higher levels go left
-			totalWidth := float64(maxLevels-1) * (l.NodeWidth + l.HorizontalGap)
-			x = totalWidth - float64(levelIndex)*(l.NodeWidth+l.HorizontalGap) + l.NodeWidth/2
+	// Position across the rank axis, keeping each group in its own band
+	crosses := l.crossPositions(levels, diagram, across, crossGap)
 
-			// Center nodes vertically in each level
-			totalHeight := float64(len(level))*l.NodeHeight + float64(len(level)-1)*l.VerticalGap
-			startPos = -totalHeight/2 + l.NodeHeight/2
+	// Position nodes level by level
+	for levelIndex, level := range levels {
+		// Rank coordinate: level 0 at the top or left, or at the bottom
+		// or right for the reversed directions
+		rank := centres[levelIndex]
+		switch l.Direction {
+		case DirectionTopToBottom, DirectionRightToLeft:
+			rank = total - centres[levelIndex]
 		}
 
-		for nodeIndex, nodeID := range level {
-			switch l.Direction {
-			case DirectionTopToBottom, DirectionBottomToTop:
-				x = startPos + float64(nodeIndex)*(l.NodeWidth+l.HorizontalGap)
-			case DirectionLeftToRight, DirectionRightToLeft:
-				y = startPos + float64(nodeIndex)*(l.NodeHeight+l.VerticalGap)
+		for _, nodeID := range level {
+			cross := crosses[nodeID]
+
+			x, y := cross, rank
+			if !vertical {
+				x, y = rank, cross
 			}
 
 			// Get original node for attributes
 			originalNode := nodeMap[nodeID]
 
-			// Determine node shape
-			shape := l.getNodeShape(originalNode)
-
 			// Create layout node
 			layoutNode := LayoutNode{
 				ID:     nodeID,
 				X:      x,
 				Y:      y,
-				Width:  l.NodeWidth,
-				Height: l.NodeHeight,
+				Width:  sizes[nodeID].X,
+				Height: sizes[nodeID].Y,
 				Label:  originalNode.Label,
-				Shape:  shape,
+				Shape:  shapes[nodeID],
 				Style:  "solid",
 				Color:  "black",
+
+				Classes:    originalNode.Classes,
+				Attributes: originalNode.Attributes,
 			}
 
 			layout.Nodes[nodeID] = layoutNode
@@ -291,19 +450,253 @@ func (l *SimpleLayouter) positionNodes(levels [][]string, diagram *Diagram) *Lay
 	return layout
 }
 
-// getNodeShape determines the shape of a node
-func (l *SimpleLayouter) getNodeShape(node Node) string {
-	if shape, exists := node.Attributes["shape"]; exists {
+// groupBand is the strip across the rank axis taken by a group on every
+// level: a column holding the group's own members, followed by the bands
+// of its nested groups. Ungrouped nodes fill the band of the diagram
+// itself. Since no two bands share a strip, the boxes of sibling groups
+// never overlap and hold no nodes but their members.
+type groupBand struct {
+	group    bool
+	members  [][]string
+	children []*groupBand
+
+	column float64
+	width  float64
+}
+
+// crossPositions returns the centre of every node across the rank axis.
+// Without groups, each level is centred on the axis.
+func (l *SimpleLayouter) crossPositions(levels [][]string, diagram *Diagram, across func(string) float64, crossGap float64) map[string]float64 {
+	bands := make(map[string]*groupBand)
+	var build func(groups []Group) []*groupBand
+	build = func(groups []Group) []*groupBand {
+		var list []*groupBand
+		for _, group := range groups {
+			band := &groupBand{group: true, members: make([][]string, len(levels))}
+			for _, id := range group.Nodes {
+				bands[id] = band
+			}
+			band.children = build(group.Groups)
+			list = append(list, band)
+		}
+		return list
+	}
+	root := &groupBand{members: make([][]string, len(levels))}
+	root.children = build(diagram.Groups)
+
+	for levelIndex, level := range levels {
+		for _, nodeID := range level {
+			band, ok := bands[nodeID]
+			if !ok {
+				band = root
+			}
+			band.members[levelIndex] = append(band.members[levelIndex], nodeID)
+		}
+	}
+
+	// Width of a row of nodes, including the gaps between them
+	rowWidth := func(row []string) float64 {
+		if len(row) == 0 {
+			return 0
+		}
+		width := float64(len(row)-1) * crossGap
+		for _, nodeID := range row {
+			width += across(nodeID)
+		}
+		return width
+	}
+
+	// The group label lies across the rank axis in horizontal layouts
+	label := 0.0
+	if l.Direction == DirectionLeftToRight || l.Direction == DirectionRightToLeft {
+		label = l.GroupLabelHeight
+	}
+
+	var measure func(band *groupBand) float64
+	measure = func(band *groupBand) float64 {
+		for _, row := range band.members {
+			band.column = math.Max(band.column, rowWidth(row))
+		}
+		parts := 0
+		content := 0.0
+		if band.column > 0 {
+			parts++
+			content += band.column
+		}
+		for _, child := range band.children {
+			if width := measure(child); width > 0 {
+				parts++
+				content += width
+			}
+		}
+		if parts == 0 {
+			return 0
+		}
+		band.width = content + float64(parts-1)*crossGap
+		if band.group {
+			band.width += 2*l.GroupPadding + label
+		}
+		return band.width
+	}
+
+	positions := make(map[string]float64)
+	var place func(band *groupBand, pos float64)
+	place = func(band *groupBand, pos float64) {
+		if band.group {
+			pos += l.GroupPadding
+		}
+		if band.column > 0 {
+			centre := pos + band.column/2
+			for _, row := range band.members {
+				at := centre - rowWidth(row)/2
+				for _, nodeID := range row {
+					positions[nodeID] = at + across(nodeID)/2
+					at += across(nodeID) + crossGap
+				}
+			}
+			pos += band.column + crossGap
+		}
+		for _, child := range band.children {
+			if child.width > 0 {
+				place(child, pos)
+				pos += child.width + crossGap
+			}
+		}
+	}
+
+	place(root, -measure(root)/2)
+	return positions
+}
+
+// nodeSize returns the size of a node: the default size, grown to fit its
+// label with markup drawn at fontSize. Ellipses and diamonds need more
+// room than the box around their label.
+func (l *SimpleLayouter) nodeSize(node Node, shape string, fontSize float64) (float64, float64) {
+	lines, _ := ParseLabel(node.Label)
+	width, height := measureLabel(lines, fontSize)
+	width += 2 * l.LabelPadding
+	height += 2 * l.LabelPadding
+
+	switch shape {
+	case "ellipse", "circle", "oval":
+		width, height = width*math.Sqrt2, height*math.Sqrt2
+	case "diamond", "rhombus":
+		width, height = width*2, height*2
+	}
+	return math.Max(l.NodeWidth, width), math.Max(l.NodeHeight, height)
+}
+
+// nodeFontSize returns the font size in px of a node's label, including
+// sizes set by its classes and node-style. Sizes in relative units keep
+// the default.
+func (l *SimpleLayouter) nodeFontSize(diagram *Diagram, node Node) float64 {
+	if text, ok := diagram.NodeAttribute(node, "font-size"); ok {
+		if length, err := ParseLength(text); err == nil {
+			if size, ok := length.Pixels(); ok && size > 0 {
+				return size
+			}
+		}
+	}
+	return labelFontSize("node-label")
+}
+
+// getNodeShape determines the shape of a node, including shapes set by
+// its classes and node-style
+func (l *SimpleLayouter) getNodeShape(diagram *Diagram, node Node) string {
+	if shape, exists := diagram.NodeAttribute(node, "shape"); exists {
 		return shape
 	}
 	return "rect" // default shape
 }
 
+// addGroups computes a bounding box for every group that has positioned
+// members. Outer groups are added before the groups nested in them.
+func (l *SimpleLayouter) addGroups(layout *Layout, diagram *Diagram) {
+	for _, group := range diagram.Groups {
+		l.addGroup(layout, group, 0)
+	}
+}
+
+func (l *SimpleLayouter) addGroup(layout *Layout, group Group, depth int) (LayoutGroup, bool) {
+	index := len(layout.Groups)
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	minY, maxY := math.Inf(1), math.Inf(-1)
+
+	for _, id := range group.Nodes {
+		node, ok := layout.Nodes[id]
+		if !ok {
+			continue
+		}
+		minX = math.Min(minX, node.X-node.Width/2)
+		maxX = math.Max(maxX, node.X+node.Width/2)
+		minY = math.Min(minY, node.Y-node.Height/2)
+		maxY = math.Max(maxY, node.Y+node.Height/2)
+	}
+
+	for _, child := range group.Groups {
+		box, ok := l.addGroup(layout, child, depth+1)
+		if !ok {
+			continue
+		}
+		minX = math.Min(minX, box.X-box.Width/2)
+		maxX = math.Max(maxX, box.X+box.Width/2)
+		minY = math.Min(minY, box.Y-box.Height/2)
+		maxY = math.Max(maxY, box.Y+box.Height/2)
+	}
+
+	if math.IsInf(minX, 1) {
+		return LayoutGroup{}, false
+	}
+
+	// The label sits along the top edge, which has the larger Y since the
+	// SVG output flips the vertical axis
+	minX -= l.GroupPadding
+	maxX += l.GroupPadding
+	minY -= l.GroupPadding
+	maxY += l.GroupPadding + l.GroupLabelHeight
+
+	box := LayoutGroup{
+		ID:     group.ID,
+		Label:  group.Label,
+		X:      (minX + maxX) / 2,
+		Y:      (minY + maxY) / 2,
+		Width:  maxX - minX,
+		Height: maxY - minY,
+		Depth:  depth,
+
+		Attributes: group.Attributes,
+	}
+
+	layout.Groups = append(layout.Groups, LayoutGroup{})
+	copy(layout.Groups[index+1:], layout.Groups[index:])
+	layout.Groups[index] = box
+	return box, true
+}
+
+// endpoint returns the box an edge attaches to: a node, or the bounding
+// box of a group
+func (l *SimpleLayouter) endpoint(layout *Layout, id string) (LayoutNode, bool) {
+	if node, ok := layout.Nodes[id]; ok {
+		return node, true
+	}
+	for _, group := range layout.Groups {
+		if group.ID == id {
+			return LayoutNode{ID: group.ID, X: group.X, Y: group.Y, Width: group.Width, Height: group.Height}, true
+		}
+	}
+	return LayoutNode{}, false
+}
+
 // addEdges adds edges to the layout
 func (l *SimpleLayouter) addEdges(layout *Layout, diagram *Diagram) {
+	ports := make(map[string][]string)
+	for _, node := range diagram.Nodes {
+		ports[node.ID] = diagram.NodePorts(node)
+	}
+
 	for _, edge := range diagram.Edges {
-		fromNode, fromExists := layout.Nodes[edge.From]
-		toNode, toExists := layout.Nodes[edge.To]
+		fromNode, fromExists := l.endpoint(layout, edge.From)
+		toNode, toExists := l.endpoint(layout, edge.To)
 
 		if !fromExists || !toExists {
 			continue // Skip edges to non-existent nodes
@@ -343,6 +736,11 @@ func (l *SimpleLayouter) addEdges(layout *Layout, diagram *Diagram) {
 		labelX := (fromNode.X + toNode.X) / 2
 		labelY := (fromNode.Y + toNode.Y) / 2
 
+		if len(points) == 2 && (edge.FromPort != "" || edge.ToPort != "") {
+			points = l.routePorts(edge, points, fromNode, toNode, ports[edge.From], ports[edge.To])
+			labelX, labelY = curveMidpoint(points)
+		}
+
 		layoutEdge := LayoutEdge{
 			From:   edge.From,
 			To:     edge.To,
@@ -350,12 +748,61 @@ func (l *SimpleLayouter) addEdges(layout *Layout, diagram *Diagram) {
 			Label:  edge.Label,
 			X:      labelX,
 			Y:      labelY,
+
+			Classes:    edge.Classes,
+			Dir:        diagram.EdgeDirection(edge),
+			Attributes: edge.Attributes,
 		}
 
 		layout.Edges = append(layout.Edges, layoutEdge)
 	}
 }
 
+// routePorts moves the ends of an edge to its ports. The edge becomes a
+// cubic curve that leaves and enters each end along the port's direction,
+// so an edge from "decision:e" heads right before turning to its target.
+func (l *SimpleLayouter) routePorts(edge Edge, points []Point, fromNode, toNode LayoutNode, fromPorts, toPorts []string) []Point {
+	fromSide, toSide := l.edgeSides()
+	start, startDir := points[0], fromSide
+	if point, dir, ok := portPoint(fromNode, edge.FromPort, fromPorts, fromSide); ok {
+		start, startDir = point, dir
+	}
+	end, endDir := points[1], toSide
+	if point, dir, ok := portPoint(toNode, edge.ToPort, toPorts, toSide); ok {
+		end, endDir = point, dir
+	}
+
+	reach := math.Min(l.HorizontalGap, l.VerticalGap) / 2
+	return []Point{
+		start,
+		{X: start.X + startDir.X*reach, Y: start.Y + startDir.Y*reach},
+		{X: end.X + endDir.X*reach, Y: end.Y + endDir.Y*reach},
+		end,
+	}
+}
+
+// edgeSides returns the outward directions of the sides edges leave their
+// source and enter their target by in the current layout direction
+func (l *SimpleLayouter) edgeSides() (from, to Point) {
+	switch l.Direction {
+	case DirectionBottomToTop:
+		return Point{X: 0, Y: 1}, Point{X: 0, Y: -1}
+	case DirectionLeftToRight:
+		return Point{X: 1, Y: 0}, Point{X: -1, Y: 0}
+	case DirectionRightToLeft:
+		return Point{X: -1, Y: 0}, Point{X: 1, Y: 0}
+	default:
+		return Point{X: 0, Y: -1}, Point{X: 0, Y: 1}
+	}
+}
+
+// curveMidpoint returns the point halfway along a cubic curve
+func curveMidpoint(points []Point) (float64, float64) {
+	x := (points[0].X + 3*points[1].X + 3*points[2].X + points[3].X) / 8
+	y := (points[0].Y + 3*points[1].Y + 3*points[2].Y + points[3].Y) / 8
+	return x, y
+}
+
 // calculateCanvasSize calculates the final canvas size based on node positions
 func (l *SimpleLayouter) calculateCanvasSize(layout *Layout) {
 	if len(layout.Nodes) == 0 {
@@ -379,6 +826,13 @@ func (l *SimpleLayouter) calculateCanvasSize(layout *Layout) {
 		maxY = math.Max(maxY, nodeMaxY)
 	}
 
+	for _, group := range layout.Groups {
+		minX = math.Min(minX, group.X-group.Width/2)
+		maxX = math.Max(maxX, group.X+group.Width/2)
+		minY = math.Min(minY, group.Y-group.Height/2)
+		maxY = math.Max(maxY, group.Y+group.Height/2)
+	}
+
 	// Add padding
 	padding := 40.0
 	layout.Width = maxX - minX + padding*2
@@ -395,6 +849,12 @@ func (l *SimpleLayouter) calculateCanvasSize(layout *Layout) {
 		layout.Nodes[id] = node
 	}
 
+	// Update group positions
+	for i := range layout.Groups {
+		layout.Groups[i].X += offsetX
+		layout.Groups[i].Y += offsetY
+	}
+
 	// Update edge positions
 	for i, edge := range layout.Edges {
 		for j, point := range edge.Points {
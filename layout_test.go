@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"math"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -431,7 +433,187 @@ func TestBuildDependencyGraph(t *testing.T) {
 	}
 }
 
+// TestLayoutUndirectedEdges tests that undirected edges rank by distance
+// from the first node instead of by the order of their endpoints
+func TestLayoutUndirectedEdges(t *testing.T) {
+	layouter := NewSimpleLayouter()
+	diagram := &Diagram{
+		Options: Options{Undirected: true},
+		Nodes: []Node{
+			{ID: "hub"}, {ID: "A"}, {ID: "B"}, {ID: "C"},
+		},
+		Edges: []Edge{
+			{From: "A", To: "hub"},
+			{From: "B", To: "hub"},
+			{From: "C", To: "B"},
+			{From: "A", To: "C"},
+		},
+	}
+
+	graph := layouter.buildDependencyGraph(diagram)
+	levels := layouter.calculateLevels(graph, diagram.Nodes)
+
+	expected := [][]string{{"hub"}, {"A", "B"}, {"C"}}
+	if !reflect.DeepEqual(levels, expected) {
+		t.Errorf("Expected levels %v, got %v", expected, levels)
+	}
+
+	layout, err := layouter.LayoutDiagram(diagram)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, edge := range layout.Edges {
+		if edge.Dir != DirNone {
+			t.Errorf("Expected undirected layout edge, got %s", edge.Dir)
+		}
+	}
+}
+
+// TestLayoutMixedDirections tests that undirected edges hang below the
+// roots of directed ones and that back edges keep declaration order
+func TestLayoutMixedDirections(t *testing.T) {
+	layouter := NewSimpleLayouter()
+	diagram := &Diagram{
+		Nodes: []Node{
+			{ID: "peer"}, {ID: "root"}, {ID: "child"},
+		},
+		Edges: []Edge{
+			{From: "root", To: "child", Attributes: map[string]string{"dir": "back"}},
+			{From: "peer", To: "root", Attributes: map[string]string{"dir": "none"}},
+		},
+	}
+
+	graph := layouter.buildDependencyGraph(diagram)
+	levels := layouter.calculateLevels(graph, diagram.Nodes)
+
+	expected := [][]string{{"root"}, {"child", "peer"}}
+	if !reflect.DeepEqual(levels, expected) {
+		t.Errorf("Expected levels %v, got %v", expected, levels)
+	}
+}
+
+// TestLayoutPorts tests that edges attach to their ports and leave along
+// the port's direction
+func TestLayoutPorts(t *testing.T) {
+	layouter := NewSimpleLayouter()
+	diagram := &Diagram{
+		Nodes: []Node{
+			{ID: "decision", Attributes: map[string]string{"shape": "diamond"}},
+			{ID: "yes"},
+			{ID: "table", Attributes: map[string]string{"ports": "id name"}},
+		},
+		Edges: []Edge{
+			{From: "decision", FromPort: "e", To: "yes"},
+			{From: "decision", To: "table", ToPort: "name"},
+			{From: "yes", To: "table"},
+		},
+	}
+
+	layout, err := layouter.LayoutDiagram(diagram)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	decision := layout.Nodes["decision"]
+	east := layout.Edges[0]
+	if len(east.Points) != 4 {
+		t.Fatalf("Expected a curve through 4 points, got %v", east.Points)
+	}
+	start := east.Points[0]
+	if start.X != decision.X+decision.Width/2 || start.Y != decision.Y {
+		t.Errorf("Expected edge to start at the east vertex, got %v", start)
+	}
+	if east.Points[1].X <= start.X || east.Points[1].Y != start.Y {
+		t.Errorf("Expected edge to leave heading east, got %v", east.Points[1])
+	}
+
+	table := layout.Nodes["table"]
+	end := layout.Edges[1].Points[3]
+	if math.Abs(end.X-(table.X+table.Width/6)) > 0.01 || end.Y != table.Y+table.Height/2 {
+		t.Errorf("Expected edge to end at port name on the top side, got %v", end)
+	}
+
+	if len(layout.Edges[2].Points) != 2 {
+		t.Errorf("Expected edges without ports to stay straight, got %v", layout.Edges[2].Points)
+	}
+}
+
 // TestCalculateLevels tests level calculation
+func TestLayoutLabelSizing(t *testing.T) {
+	layouter := NewSimpleLayouter()
+	diagram := &Diagram{
+		Nodes: []Node{
+			{ID: "short", Label: "A"},
+			{ID: "long", Label: "**Order processing service**\n`v2`"},
+			{ID: "big", Label: "[Title]{size=40}"},
+			{ID: "next", Label: "B"},
+		},
+		Edges: []Edge{
+			{From: "short", To: "next"},
+			{From: "long", To: "next"},
+			{From: "big", To: "next"},
+		},
+	}
+
+	layout, err := layouter.LayoutDiagram(diagram)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	short, long, big, next := layout.Nodes["short"], layout.Nodes["long"], layout.Nodes["big"], layout.Nodes["next"]
+	if short.Width != layouter.NodeWidth || short.Height != layouter.NodeHeight {
+		t.Errorf("Expected short labels to keep the default size, got %.2fx%.2f", short.Width, short.Height)
+	}
+
+	// 24 bold characters at 12px plus padding on both sides
+	if expected := 24*boldCharWidth*12 + 2*layouter.LabelPadding; math.Abs(long.Width-expected) > 1e-9 {
+		t.Errorf("Expected long label width %.2f, got %.2f", expected, long.Width)
+	}
+	if expected := labelLineHeight*40 + 2*layouter.LabelPadding; math.Abs(big.Height-expected) > 1e-9 {
+		t.Errorf("Expected large text height %.2f, got %.2f", expected, big.Height)
+	}
+
+	// Nodes of a level do not overlap, and the next level starts below
+	// the tallest node
+	if long.X-long.Width/2 < short.X+short.Width/2+layouter.HorizontalGap-1e-9 {
+		t.Errorf("Expected wide node to keep its distance, got %v and %v", short, long)
+	}
+	if gap := (big.Y - big.Height/2) - (next.Y + next.Height/2); math.Abs(gap-layouter.VerticalGap) > 1e-9 {
+		t.Errorf("Expected a gap of %.2f below the tallest node, got %.2f", layouter.VerticalGap, gap)
+	}
+}
+
+// TestLayoutFontSize tests that nodes grow to fit labels drawn with a
+// larger font, however the size is set
+func TestLayoutFontSize(t *testing.T) {
+	label := "Order processing service"
+	diagram := &Diagram{
+		NodeStyle: map[string]string{"font-size": "16"},
+		Classes:   []Class{{Name: "big", Attributes: map[string]string{"font-size": "18pt"}}},
+		Nodes: []Node{
+			{ID: "own", Label: label, Attributes: map[string]string{"font-size": "20px"}},
+			{ID: "class", Label: label, Classes: []string{"big"}},
+			{ID: "style", Label: label},
+			{ID: "relative", Label: label, Attributes: map[string]string{"font-size": "2em"}},
+		},
+	}
+
+	layouter := NewSimpleLayouter()
+	layout, err := layouter.LayoutDiagram(diagram)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// 24 characters plus padding on both sides; relative sizes keep the
+	// default of 12px
+	for id, size := range map[string]float64{"own": 20, "class": 24, "style": 16, "relative": 12} {
+		expected := 24*charWidth*size + 2*layouter.LabelPadding
+		if width := layout.Nodes[id].Width; math.Abs(width-expected) > 1e-9 {
+			t.Errorf("Expected %s to be %.2f wide, got %.2f", id, expected, width)
+		}
+	}
+}
+
 func TestCalculateLevels(t *testing.T) {
 	layouter := NewSimpleLayouter()
 	nodes := []Node{
@@ -465,6 +647,158 @@ func TestCalculateLevels(t *testing.T) {
 	}
 }
 
+// TestLayoutGroups tests group bounding boxes and member ordering
+func TestLayoutGroups(t *testing.T) {
+	diagram := &Diagram{
+		Nodes: []Node{
+			{ID: "root"}, {ID: "a1"}, {ID: "b1"}, {ID: "a2"}, {ID: "b2"}, {ID: "c"},
+		},
+		Groups: []Group{
+			{ID: "outer", Label: "Outer", Nodes: []string{"a1"}, Groups: []Group{
+				{ID: "inner", Label: "Inner", Nodes: []string{"a2"}},
+			}},
+			{ID: "other", Label: "Other", Nodes: []string{"b1", "b2"}},
+		},
+		Edges: []Edge{
+			{From: "root", To: "b1"},
+			{From: "root", To: "c"},
+			{From: "root", To: "a1"},
+			{From: "root", To: "b2"},
+			{From: "root", To: "a2"},
+			{From: "c", To: "other"},
+		},
+	}
+
+	layout := LayoutTestDiagram(t, diagram)
+
+	if len(layout.Groups) != 3 {
+		t.Fatalf("Expected 3 group boxes, got %d", len(layout.Groups))
+	}
+	if layout.Groups[0].ID != "outer" || layout.Groups[1].ID != "inner" || layout.Groups[2].ID != "other" {
+		t.Errorf("Expected outer groups before nested ones, got %+v", layout.Groups)
+	}
+	if layout.Groups[1].Depth != 1 {
+		t.Errorf("Expected inner group at depth 1, got %d", layout.Groups[1].Depth)
+	}
+
+	contains := func(outer LayoutGroup, x, y, w, h float64) bool {
+		return x-w/2 > outer.X-outer.Width/2 && x+w/2 < outer.X+outer.Width/2 &&
+			y-h/2 > outer.Y-outer.Height/2 && y+h/2 < outer.Y+outer.Height/2
+	}
+
+	groups := make(map[string]LayoutGroup)
+	for _, group := range layout.Groups {
+		groups[group.ID] = group
+	}
+	for _, id := range []string{"a1", "a2"} {
+		node := layout.Nodes[id]
+		if !contains(groups["outer"], node.X, node.Y, node.Width, node.Height) {
+			t.Errorf("Node %s should be inside the outer group box", id)
+		}
+	}
+	inner := groups["inner"]
+	if !contains(groups["outer"], inner.X, inner.Y, inner.Width, inner.Height) {
+		t.Errorf("Inner group box should be inside the outer group box")
+	}
+
+	// Edges into a group make its members rank below the source, so b1
+	// and b2 end up on the level after c, next to each other
+	b1, b2, c := layout.Nodes["b1"], layout.Nodes["b2"], layout.Nodes["c"]
+	if b1.Y != b2.Y || b1.Y >= c.Y {
+		t.Errorf("Expected b1 and b2 on the same level below c, got b1=%.0f b2=%.0f c=%.0f", b1.Y, b2.Y, c.Y)
+	}
+	if math.Abs(b1.X-b2.X) != NewSimpleLayouter().NodeWidth+NewSimpleLayouter().HorizontalGap {
+		t.Errorf("Expected b1 and b2 to be adjacent, got x=%.0f and x=%.0f", b1.X, b2.X)
+	}
+
+	// The edge to the group attaches to the group box rather than a node
+	other := groups["other"]
+	for _, edge := range layout.Edges {
+		if edge.From == "c" && edge.To == "other" {
+			end := edge.Points[len(edge.Points)-1]
+			if end.Y != other.Y+other.Height/2 {
+				t.Errorf("Expected edge to end at top of group box (%.2f), got %.2f", other.Y+other.Height/2, end.Y)
+			}
+		}
+	}
+}
+
+// TestLayoutGroupBands tests that sibling group boxes stay apart and hold
+// only their own members, whatever the levels of the members
+func TestLayoutGroupBands(t *testing.T) {
+	diagram := &Diagram{
+		Nodes: []Node{
+			{ID: "root"}, {ID: "a1"}, {ID: "a2"}, {ID: "b1"}, {ID: "b2"}, {ID: "c1"}, {ID: "x"},
+		},
+		Groups: []Group{
+			{ID: "g1", Nodes: []string{"a1", "a2"}},
+			{ID: "g2", Nodes: []string{"b1"}, Groups: []Group{
+				{ID: "g3", Nodes: []string{"b2", "c1"}},
+			}},
+		},
+		Edges: []Edge{
+			{From: "root", To: "a1"},
+			{From: "a1", To: "a2"},
+			{From: "root", To: "b1"},
+			{From: "root", To: "b2"},
+			{From: "b1", To: "c1"},
+			{From: "a2", To: "x"},
+		},
+	}
+	members := map[string][]string{
+		"g1": {"a1", "a2"},
+		"g2": {"b1", "b2", "c1"},
+		"g3": {"b2", "c1"},
+	}
+
+	intersect := func(a, b LayoutGroup) bool {
+		return math.Abs(a.X-b.X) < (a.Width+b.Width)/2 && math.Abs(a.Y-b.Y) < (a.Height+b.Height)/2
+	}
+
+	for _, direction := range []string{"top-to-bottom", "left-to-right", "right-to-left"} {
+		t.Run(direction, func(t *testing.T) {
+			diagram.LayoutDirection = direction
+			layout := LayoutTestDiagram(t, diagram)
+
+			groups := make(map[string]LayoutGroup)
+			for _, group := range layout.Groups {
+				groups[group.ID] = group
+			}
+			if intersect(groups["g1"], groups["g2"]) {
+				t.Errorf("Expected sibling boxes g1 and g2 not to intersect, got %+v and %+v", groups["g1"], groups["g2"])
+			}
+
+			for id, ids := range members {
+				box := groups[id]
+				for nodeID, node := range layout.Nodes {
+					inside := math.Abs(node.X-box.X) < (node.Width+box.Width)/2 &&
+						math.Abs(node.Y-box.Y) < (node.Height+box.Height)/2
+					if inside != slices.Contains(ids, nodeID) {
+						t.Errorf("Group %s box %+v: node %s inside=%v", id, box, nodeID, inside)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestOrderLevelsByGroup tests that grouped nodes become contiguous
+func TestOrderLevelsByGroup(t *testing.T) {
+	diagram := &Diagram{
+		Groups: []Group{
+			{ID: "g1", Nodes: []string{"a", "c"}},
+			{ID: "g2", Nodes: []string{"b", "d"}},
+		},
+	}
+	levels := [][]string{{"a", "b", "x", "c", "d"}}
+
+	NewSimpleLayouter().orderLevelsByGroup(levels, diagram)
+
+	if strings.Join(levels[0], ",") != "x,a,c,b,d" {
+		t.Errorf("Expected x,a,c,b,d, got %v", levels[0])
+	}
+}
+
 // BenchmarkLayout benchmarks layout performance
 func BenchmarkLayout(b *testing.B) {
 	layouter := NewSimpleLayouter()
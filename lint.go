@@ -0,0 +1,475 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Codes of the lint rules. Lint problems are legal diagrams that are
+// probably not what was meant, so they are warnings unless configured
+// otherwise.
+var (
+	CodeIsolatedNode       = DiagnosticCode{"W001", "isolated-node"}
+	CodeUnreachableNode    = DiagnosticCode{"W002", "unreachable-node"}
+	CodeCycle              = DiagnosticCode{"W003", "cycle"}
+	CodeDuplicateEdge      = DiagnosticCode{"W004", "duplicate-edge"}
+	CodeSelfLoop           = DiagnosticCode{"W005", "self-loop"}
+	CodeRedundantEdgeLabel = DiagnosticCode{"W006", "redundant-edge-label"}
+	CodeUnusedClass        = DiagnosticCode{"W007", "unused-class"}
+	CodeLongLabel          = DiagnosticCode{"W008", "long-label"}
+)
+
+// defaultMaxLabelLength is the longest label line long-label allows
+// unless :max-label-length says otherwise
+const defaultMaxLabelLength = 40
+
+// LintRule is a check run by Validator.Lint. Its check returns the
+// problems found with their messages and locations; Lint fills in the
+// code and severity.
+type LintRule struct {
+	Code        DiagnosticCode
+	Description string
+	check       func(d *Diagram, g *diagramGraph, config LintConfig) []Diagnostic
+}
+
+// lintRules lists the lint rules in the order they are run
+var lintRules = []LintRule{
+	{CodeIsolatedNode, "Nodes without any edges", lintIsolatedNodes},
+	{CodeUnreachableNode, "Nodes that cannot be reached from a node without incoming edges", lintUnreachableNodes},
+	{CodeCycle, "Edges that lead back to where they started", lintCycles},
+	{CodeDuplicateEdge, "Edges repeating another with the same endpoints, ports and label", lintDuplicateEdges},
+	{CodeSelfLoop, "Edges from a node to itself", lintSelfLoops},
+	{CodeRedundantEdgeLabel, "Edge labels repeating the label of an endpoint", lintRedundantEdgeLabels},
+	{CodeUnusedClass, "Classes no node or edge uses", lintUnusedClasses},
+	{CodeLongLabel, "Labels with a line longer than :max-label-length characters", lintLongLabels},
+}
+
+// findLintRule returns the rule with the given name, such as "self-loop"
+func findLintRule(name string) (LintRule, bool) {
+	for _, rule := range lintRules {
+		if rule.Code.Name == name {
+			return rule, true
+		}
+	}
+	return LintRule{}, false
+}
+
+// LintConfig selects the lint rules to run and their severity. Rules are
+// enabled and warnings unless set otherwise; a zero MaxLabelLength means
+// the default.
+type LintConfig struct {
+	Enabled        map[string]bool
+	Severity       map[string]Severity
+	MaxLabelLength int
+}
+
+// IsZero reports whether the configuration changes none of the defaults
+func (c LintConfig) IsZero() bool {
+	return len(c.Enabled) == 0 && len(c.Severity) == 0 && c.MaxLabelLength == 0
+}
+
+// Merge returns c with the settings made in other, which take precedence
+func (c LintConfig) Merge(other LintConfig) LintConfig {
+	merged := LintConfig{
+		Enabled:        make(map[string]bool),
+		Severity:       make(map[string]Severity),
+		MaxLabelLength: c.MaxLabelLength,
+	}
+	for _, config := range []LintConfig{c, other} {
+		for name, enabled := range config.Enabled {
+			merged.Enabled[name] = enabled
+		}
+		for name, severity := range config.Severity {
+			merged.Severity[name] = severity
+		}
+	}
+	if other.MaxLabelLength != 0 {
+		merged.MaxLabelLength = other.MaxLabelLength
+	}
+	return merged
+}
+
+func (c LintConfig) enabled(rule LintRule) bool {
+	enabled, ok := c.Enabled[rule.Code.Name]
+	return !ok || enabled
+}
+
+func (c LintConfig) severity(rule LintRule) Severity {
+	if severity, ok := c.Severity[rule.Code.Name]; ok {
+		return severity
+	}
+	return SeverityWarning
+}
+
+func (c LintConfig) maxLabelLength() int {
+	if c.MaxLabelLength > 0 {
+		return c.MaxLabelLength
+	}
+	return defaultMaxLabelLength
+}
+
+// interpretLint handles
+//
+//	(lint :disable ("self-loop") :error ("cycle") :max-label-length 30)
+//
+// :enable and :disable switch rules on and off; :error, :warning and
+// :info set the severity they are reported with.
+func interpretLint(in *Interpreter, diagram *Diagram, form Value) error {
+	attrs, err := readAttributes(form, 1)
+	in.report(err)
+
+	config := &diagram.Lint
+	for _, attr := range attrs {
+		if attr.Key == "max-label-length" {
+			n, err := attr.Value.AsInt()
+			if err == nil && n <= 0 {
+				err = fmt.Errorf("expected a positive length, got %d", n)
+			}
+			if err != nil {
+				in.report(newSourceError(attr.Span, "invalid :%s: %v", attr.Key, err))
+				continue
+			}
+			config.MaxLabelLength = int(n)
+			continue
+		}
+
+		var set func(name string)
+		switch attr.Key {
+		case "enable", "disable":
+			enabled := attr.Key == "enable"
+			set = func(name string) {
+				if config.Enabled == nil {
+					config.Enabled = make(map[string]bool)
+				}
+				config.Enabled[name] = enabled
+			}
+		case "error", "warning", "info":
+			severity := map[string]Severity{"error": SeverityError, "warning": SeverityWarning, "info": SeverityInfo}[attr.Key]
+			set = func(name string) {
+				if config.Severity == nil {
+					config.Severity = make(map[string]Severity)
+				}
+				config.Severity[name] = severity
+			}
+		default:
+			in.report(newSourceError(attr.Span, "unknown lint option: :%s", attr.Key))
+			continue
+		}
+
+		names, err := attr.Value.AsList()
+		if err != nil {
+			in.report(newSourceError(attr.Span, "invalid :%s: %v", attr.Key, err))
+			continue
+		}
+		for _, name := range names {
+			if _, ok := findLintRule(name); !ok {
+				in.report(newSourceError(attr.Span, "unknown lint rule: %s", name))
+				continue
+			}
+			set(name)
+		}
+	}
+	return nil
+}
+
+// ReadLintConfig reads a lint configuration file, which holds (lint ...)
+// forms as written in diagrams. Later forms override earlier ones.
+func ReadLintConfig(name string, input []byte) (LintConfig, error) {
+	var errors ErrorList
+	forms, err := NewReader(NewFileLexer(name, string(input))).ReadAll()
+	errors.Add(err)
+
+	in := NewInterpreter()
+	var diagram Diagram
+	for _, form := range forms {
+		if form.Kind != ValueList {
+			errors.Add(newSourceError(form.Span, "expected '(', got %s", form.describe()))
+			continue
+		}
+		if form.Head() != "lint" {
+			errors.Add(newSourceError(elementSpan(form, 0), "expected 'lint', got %s", describeElement(form, 0)))
+			continue
+		}
+		in.report(interpretLint(in, &diagram, form))
+	}
+	errors = append(errors, in.errors...)
+	return diagram.Lint, errors.Err()
+}
+
+// Lint runs the lint rules enabled by config over a diagram and returns
+// what they find, in source order. Problems on a line marked with a
+// lint:ignore comment, or on the line after one written on a line of its
+// own, are left out:
+//
+//	("A" "A") ; lint:ignore self-loop
+//	; lint:ignore -- drawn on purpose
+//	("B" "B")
+//
+// A lint:ignore comment without rule names suppresses every rule, and
+// text after "--" explains why the problem is not one. Lint expects a
+// diagram that passes Validate; undeclared endpoints are ignored.
+func (v *Validator) Lint(diagram *Diagram, config LintConfig) []Diagnostic {
+	g := newDiagramGraph(diagram)
+	suppressions := make(lintSuppressions)
+
+	var diagnostics []Diagnostic
+	for _, rule := range lintRules {
+		if !config.enabled(rule) {
+			continue
+		}
+		for _, d := range rule.check(diagram, g, config) {
+			d.Code = rule.Code
+			d.Severity = config.severity(rule)
+			if !suppressions.suppressed(d) {
+				diagnostics = append(diagnostics, d)
+			}
+		}
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i].Span.Start, diagnostics[j].Span.Start
+		if a.Filename() != b.Filename() {
+			return a.Filename() < b.Filename()
+		}
+		return a.Offset < b.Offset
+	})
+	return diagnostics
+}
+
+// lintSuppressions holds the rules suppressed on each line of the sources
+// read so far; an empty rule name suppresses every rule
+type lintSuppressions map[*Source]map[int][]string
+
+func (s lintSuppressions) suppressed(d Diagnostic) bool {
+	source := d.Span.Start.Source
+	if source == nil || !d.Span.IsValid() {
+		return false
+	}
+	lines, ok := s[source]
+	if !ok {
+		lines = readSuppressions(source)
+		s[source] = lines
+	}
+	for _, name := range lines[d.Span.Start.Line] {
+		if name == "" || name == d.Code.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// readSuppressions finds the lint:ignore comments of a source and returns
+// the rules they suppress by line
+func readSuppressions(source *Source) map[int][]string {
+	lines := make(map[int][]string)
+	lexer := NewFileLexer(source.Name, source.Text)
+	lexer.KeepComments = true
+	for {
+		token := lexer.NextToken()
+		if token.Type == TokenEOF || token.Type == TokenError {
+			return lines
+		}
+		if token.Type != TokenComment || strings.HasPrefix(token.Value, "#;") {
+			continue
+		}
+
+		text := strings.TrimLeft(token.Value, ";#| \t")
+		text = strings.TrimSpace(strings.TrimSuffix(text, "|#"))
+		rest, found := strings.CutPrefix(text, "lint:ignore")
+		if !found || (rest != "" && rest[0] != ' ' && rest[0] != '\t') {
+			continue
+		}
+
+		// A comment on a line of its own applies to the next line
+		line := token.Span.End.Line
+		offset := token.Span.Start.Offset
+		lineStart := strings.LastIndexByte(source.Text[:offset], '\n') + 1
+		if strings.TrimSpace(source.Text[lineStart:offset]) == "" {
+			line++
+		}
+		rest, _, _ = strings.Cut(rest, "--")
+		names := strings.Fields(rest)
+		if len(names) == 0 {
+			names = []string{""}
+		}
+		lines[line] = append(lines[line], names...)
+	}
+}
+
+func lintIsolatedNodes(d *Diagram, g *diagramGraph, config LintConfig) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, node := range d.Nodes {
+		if len(g.out[node.ID]) == 0 && len(g.in[node.ID]) == 0 {
+			diagnostics = append(diagnostics, Diagnostic{
+				Message: fmt.Sprintf("node '%s' has no edges", node.ID),
+				Span:    node.Span,
+			})
+		}
+	}
+	return diagnostics
+}
+
+// lintUnreachableNodes reports the nodes of directed diagrams that no path
+// leads to from a root, which are those on or behind a cycle no edge
+// enters. Isolated nodes are roots and left to isolated-node.
+func lintUnreachableNodes(d *Diagram, g *diagramGraph, config LintConfig) []Diagnostic {
+	if d.Options.Undirected {
+		return nil
+	}
+	reached := g.reachable(g.roots())
+	var diagnostics []Diagnostic
+	for _, node := range d.Nodes {
+		if !reached[node.ID] {
+			diagnostics = append(diagnostics, Diagnostic{
+				Message: fmt.Sprintf("node '%s' is not reachable from any root", node.ID),
+				Span:    node.Span,
+			})
+		}
+	}
+	return diagnostics
+}
+
+// lintCycles reports a cycle through each set of nodes of a directed
+// diagram that lead back to each other, at its first edge
+func lintCycles(d *Diagram, g *diagramGraph, config LintConfig) []Diagnostic {
+	if d.Options.Undirected {
+		return nil
+	}
+	var diagnostics []Diagnostic
+	for _, cycle := range g.cycles() {
+		diagnostic := Diagnostic{
+			Message: fmt.Sprintf("cycle: %s", pathString(cycle)),
+			Span:    d.Edges[cycle[0].index].Span,
+		}
+		for _, e := range cycle[1:] {
+			diagnostic.Related = append(diagnostic.Related, RelatedLocation{
+				Span:    d.Edges[e.index].Span,
+				Message: fmt.Sprintf("%s -> %s", e.from, e.to),
+			})
+		}
+		diagnostics = append(diagnostics, diagnostic)
+	}
+	return diagnostics
+}
+
+func lintDuplicateEdges(d *Diagram, g *diagramGraph, config LintConfig) []Diagnostic {
+	type edgeKey struct {
+		from, fromPort, to, toPort, label string
+	}
+	first := make(map[edgeKey]int)
+	var diagnostics []Diagnostic
+	for i, edge := range d.Edges {
+		key := edgeKey{edge.From, edge.FromPort, edge.To, edge.ToPort, edge.Label}
+		if d.Options.Undirected && (key.to < key.from || key.to == key.from && key.toPort < key.fromPort) {
+			key.from, key.fromPort, key.to, key.toPort = key.to, key.toPort, key.from, key.fromPort
+		}
+		if j, ok := first[key]; ok {
+			diagnostics = append(diagnostics, Diagnostic{
+				Message: fmt.Sprintf("edge %d: duplicates edge %d from '%s' to '%s'", i, j, edge.From, edge.To),
+				Span:    edge.Span,
+				Related: firstDefinedAt(d.Edges[j].Span),
+			})
+			continue
+		}
+		first[key] = i
+	}
+	return diagnostics
+}
+
+func lintSelfLoops(d *Diagram, g *diagramGraph, config LintConfig) []Diagnostic {
+	var diagnostics []Diagnostic
+	for i, edge := range d.Edges {
+		if edge.From == edge.To {
+			diagnostics = append(diagnostics, Diagnostic{
+				Message: fmt.Sprintf("edge %d: '%s' is connected to itself", i, edge.From),
+				Span:    edge.Span,
+			})
+		}
+	}
+	return diagnostics
+}
+
+func lintRedundantEdgeLabels(d *Diagram, g *diagramGraph, config LintConfig) []Diagnostic {
+	labels := make(map[string]string)
+	for _, node := range d.Nodes {
+		labels[node.ID] = strings.TrimSpace(PlainLabel(node.Label))
+	}
+	for _, group := range d.AllGroups() {
+		if _, ok := labels[group.ID]; !ok {
+			labels[group.ID] = strings.TrimSpace(PlainLabel(group.Label))
+		}
+	}
+
+	var diagnostics []Diagnostic
+	for i, edge := range d.Edges {
+		label := strings.TrimSpace(PlainLabel(edge.Label))
+		if label == "" {
+			continue
+		}
+		for _, id := range []string{edge.From, edge.To} {
+			if labels[id] == label {
+				diagnostics = append(diagnostics, Diagnostic{
+					Message: fmt.Sprintf("edge %d: label repeats the label of '%s'", i, id),
+					Span:    edge.AttrSpan("label"),
+				})
+				break
+			}
+		}
+	}
+	return diagnostics
+}
+
+func lintUnusedClasses(d *Diagram, g *diagramGraph, config LintConfig) []Diagnostic {
+	used := make(map[string]bool)
+	for _, node := range d.Nodes {
+		for _, name := range node.Classes {
+			used[name] = true
+		}
+	}
+	for _, edge := range d.Edges {
+		for _, name := range edge.Classes {
+			used[name] = true
+		}
+	}
+
+	var diagnostics []Diagnostic
+	for _, class := range d.Classes {
+		if !used[class.Name] {
+			diagnostics = append(diagnostics, Diagnostic{
+				Message: fmt.Sprintf("class '%s' is never used", class.Name),
+				Span:    class.Span,
+			})
+		}
+	}
+	return diagnostics
+}
+
+func lintLongLabels(d *Diagram, g *diagramGraph, config LintConfig) []Diagnostic {
+	limit := config.maxLabelLength()
+	var diagnostics []Diagnostic
+	check := func(what, label string, span Span) {
+		longest := 0
+		for _, line := range strings.Split(PlainLabel(label), "\n") {
+			longest = max(longest, utf8.RuneCountInString(line))
+		}
+		if longest > limit {
+			diagnostics = append(diagnostics, Diagnostic{
+				Message: fmt.Sprintf("%s: label is %d characters long (max %d)", what, longest, limit),
+				Span:    span,
+			})
+		}
+	}
+
+	for _, node := range d.Nodes {
+		check(fmt.Sprintf("node '%s'", node.ID), node.Label, node.AttrSpan("label"))
+	}
+	for i, edge := range d.Edges {
+		check(fmt.Sprintf("edge %d", i), edge.Label, edge.AttrSpan("label"))
+	}
+	for _, group := range d.AllGroups() {
+		check(fmt.Sprintf("group '%s'", group.ID), group.Label, group.AttrSpan("label"))
+	}
+	return diagnostics
+}
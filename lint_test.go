@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// lintCodes parses input and returns the codes of its lint problems
+func lintCodes(t *testing.T, input string, config LintConfig) []DiagnosticCode {
+	t.Helper()
+	diagram := ParseTestInput(t, input)
+	var codes []DiagnosticCode
+	for _, d := range NewValidator().Lint(diagram, config.Merge(diagram.Lint)) {
+		codes = append(codes, d.Code)
+	}
+	return codes
+}
+
+// TestLintRules tests each rule on a diagram that breaks it
+func TestLintRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []DiagnosticCode
+	}{
+		{"clean", `(diagram (defclass "c") (nodes (id "A" :class "c") (id "B")) (edges ("A" "B" :label "calls")))`, nil},
+		{"isolated", `(diagram (nodes (id "A") (id "B") (id "C")) (edges ("A" "B")))`, []DiagnosticCode{CodeIsolatedNode}},
+		{"group edges", `(diagram (group "g" (nodes (id "A"))) (nodes (id "B")) (edges ("g" "B")))`, nil},
+		{
+			"unreachable",
+			`(diagram (nodes (id "A") (id "B") (id "C")) (edges ("A" "B") ("C" "A")))`,
+			nil,
+		},
+		{
+			"cycle",
+			`(diagram (nodes (id "R") (id "A") (id "B")) (edges ("R" "A") ("A" "B") ("B" "A")))`,
+			[]DiagnosticCode{CodeCycle},
+		},
+		{
+			"unreachable cycle",
+			`(diagram (nodes (id "A") (id "B")) (edges ("A" "B") ("B" "A")))`,
+			[]DiagnosticCode{CodeUnreachableNode, CodeUnreachableNode, CodeCycle},
+		},
+		{
+			"duplicate edge",
+			`(diagram (nodes (id "A") (id "B")) (edges ("A" "B") ("A" "B" :label "x") ("A" "B")))`,
+			[]DiagnosticCode{CodeDuplicateEdge},
+		},
+		{"self-loop", `(diagram (nodes (id "A")) (edges ("A" "A")))`, []DiagnosticCode{CodeSelfLoop}},
+		{
+			"redundant label",
+			`(diagram (nodes (id "A") (id "B" :label "**Store**")) (edges ("A" "B" :label "Store")))`,
+			[]DiagnosticCode{CodeRedundantEdgeLabel},
+		},
+		{"unused class", `(diagram (defclass "c") (nodes (id "A") (id "B")) (edges ("A" "B")))`, []DiagnosticCode{CodeUnusedClass}},
+		{
+			"long label",
+			`(diagram (nodes (id "A" :label "short\nthis line of the label is far too long to read") (id "B")) (edges ("A" "B")))`,
+			[]DiagnosticCode{CodeLongLabel},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codes := lintCodes(t, tt.input, LintConfig{})
+			if fmt.Sprint(codes) != fmt.Sprint(tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, codes)
+			}
+		})
+	}
+}
+
+// TestLintUndirected tests that undirected diagrams have no cycles or
+// roots, and that their edges match either way round
+func TestLintUndirected(t *testing.T) {
+	codes := lintCodes(t, `(diagram (options :directed false) (nodes (id "A") (id "B"))
+	  (edges ("A" "B") ("B" "A")))`, LintConfig{})
+	expected := []DiagnosticCode{CodeDuplicateEdge}
+	if fmt.Sprint(codes) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, codes)
+	}
+}
+
+// TestLintMessages tests the text and locations of lint problems
+func TestLintMessages(t *testing.T) {
+	diagram := ParseTestInput(t, "(diagram\n  (nodes (id \"A\") (id \"B\"))\n  (edges\n    (\"A\" \"B\")\n    (\"B\" \"A\")))")
+	diagnostics := NewValidator().Lint(diagram, LintConfig{Enabled: map[string]bool{"unreachable-node": false}})
+	if len(diagnostics) != 1 {
+		t.Fatalf("Expected 1 problem, got %v", diagnostics)
+	}
+
+	expected := `<input>:4:5: warning[W003]: cycle: A -> B -> A
+        ("A" "B")
+        ^
+<input>:5:5: note: B -> A
+        ("B" "A")))
+        ^`
+	if diagnostics[0].Error() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, diagnostics[0].Error())
+	}
+}
+
+// TestLintConfig tests (lint ...) settings and their precedence over a
+// configuration file
+func TestLintConfig(t *testing.T) {
+	input := `(lint :error "isolated-node")
+	(diagram
+	  (lint :disable ("self-loop") :info ("long-label") :max-label-length 3)
+	  (nodes (id "A" :label "Long") (id "B"))
+	  (edges ("A" "A")))`
+	diagram := ParseTestInput(t, input)
+
+	file, err := ReadLintConfig("lint.sxd", []byte(`(lint :enable ("self-loop") :warning ("isolated-node"))`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var got []string
+	for _, d := range NewValidator().Lint(diagram, file.Merge(diagram.Lint)) {
+		got = append(got, d.Severity.String()+" "+d.Code.Name)
+	}
+	expected := "[info long-label error isolated-node]"
+	if fmt.Sprint(got) != expected {
+		t.Errorf("Expected %s, got %v", expected, got)
+	}
+}
+
+// TestLintConfigErrors tests mistakes in (lint ...) forms
+func TestLintConfigErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"unknown rule", `(diagram (lint :disable ("self-loops")))`, "1:16: unknown lint rule: self-loops"},
+		{"unknown option", `(diagram (lint :ignore ("cycle")))`, "1:16: unknown lint option: :ignore"},
+		{"bad length", `(diagram (lint :max-label-length 0))`, "1:16: invalid :max-label-length: expected a positive length, got 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewParser(NewLexer(tt.input)).ParseDiagram()
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error containing '%s', got: %v", tt.expected, err)
+			}
+		})
+	}
+
+	if _, err := ReadLintConfig("lint.sxd", []byte(`(diagram)`)); err == nil || !strings.Contains(err.Error(), "expected 'lint', got diagram") {
+		t.Errorf("Expected an error for a config file without lint forms, got %v", err)
+	}
+}
+
+// TestLintSuppressions tests lint:ignore comments
+func TestLintSuppressions(t *testing.T) {
+	input := `(diagram
+  (nodes (id "A") (id "B") (id "C") (id "D"))
+  (edges
+    ("A" "B")
+    ("A" "A") ; lint:ignore self-loop
+    ("B" "B") ; lint:ignore cycle
+    ; lint:ignore -- loops back on purpose
+    ("C" "C")
+    #| lint:ignore duplicate-edge
+       self-loop |#
+    ("D" "D")
+    ("A" "B") ; lint:ignored
+  ))`
+	codes := lintCodes(t, input, LintConfig{})
+	expected := []DiagnosticCode{CodeSelfLoop, CodeDuplicateEdge}
+	if fmt.Sprint(codes) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, codes)
+	}
+}
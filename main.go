@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -29,14 +31,76 @@ The input file should contain a valid S-expression diagram description.`,
 
 	var outputFile string
 	var verbose bool
+	var eval bool
+	var implicitNodes bool
+	var diagramName string
+	var profile string
+	var defines []string
 
-	compileCmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output SVG file (default: replace .sxd with .svg)")
+	compileCmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output SVG file (default: replace .sxd with .svg, or with .<name>.svg for files holding several diagrams)")
 	compileCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+	compileCmd.Flags().BoolVarP(&eval, "eval", "e", false, "Evaluate define, let, lambda, map and other expressions before building the diagram")
+	compileCmd.Flags().BoolVar(&implicitNodes, "implicit-nodes", false, "Create nodes for undeclared edge endpoints (overrides the diagram's options)")
+	compileCmd.Flags().StringVar(&diagramName, "diagram", "", "Compile only the named diagram of a file holding several")
+	compileCmd.Flags().StringVar(&profile, "profile", "", "Compile the variant selected by the named (profile ...)")
+	compileCmd.Flags().StringArrayVar(&defines, "define", nil, "Set a variable tested by :when, as key=value (repeatable)")
+	compileCmd.Flags().String("diagnostics", "text", "Format of the problems reported on standard error: text or json")
+
+	var fmtCmd = &cobra.Command{
+		Use:   "fmt [input.sxd ...]",
+		Short: "Format diagram files",
+		Long: `Rewrite diagram files in the canonical layout: consistent indentation,
+aligned :key value pairs and normalised string quoting. Comments and blank
+lines are kept. Without files, standard input is formatted to standard output.`,
+		RunE:         fmtCommand,
+		SilenceUsage: true,
+	}
+
+	var write bool
+	var check bool
+	var sortEntries bool
+
+	fmtCmd.Flags().BoolVarP(&write, "write", "w", false, "Write the result back to the files instead of standard output")
+	fmtCmd.Flags().BoolVar(&check, "check", false, "List files that are not formatted and fail if there are any")
+	fmtCmd.Flags().BoolVar(&sortEntries, "sort", false, "Sort the entries of nodes and edges by ID")
+
+	var attrsCmd = &cobra.Command{
+		Use:   "attrs [name ...]",
+		Short: "Describe the attributes of nodes, edges, groups and diagrams",
+		Long: `Print the reference of the attributes the language knows: what they
+apply to, the values they accept and their defaults. Without names, every
+attribute is listed.`,
+		RunE:         attrsCommand,
+		SilenceUsage: true,
+	}
+
+	var lintCmd = &cobra.Command{
+		Use:   "lint [input.sxd ...]",
+		Short: "Check diagrams for likely mistakes",
+		Long: `Validate diagram files and check them for things that are legal but
+usually mistakes: isolated and unreachable nodes, cycles, duplicate edges,
+self-loops, redundant edge labels, unused classes and long labels. Rules are
+configured with (lint ...) in the diagram or in a --config file, and problems
+are suppressed with "; lint:ignore rule" comments. Without files, standard
+input is checked.`,
+		RunE:         lintCommand,
+		SilenceUsage: true,
+	}
+
+	lintCmd.Flags().BoolP("eval", "e", false, "Evaluate define, let, lambda, map and other expressions before building the diagram")
+	lintCmd.Flags().String("config", "", "File of (lint ...) forms configuring the rules; the diagram's own (lint ...) takes precedence")
+	lintCmd.Flags().String("diagnostics", "text", "Format of the problems reported on standard output: text or json")
+	lintCmd.Flags().Bool("fail-on-warnings", false, "Exit with an error status if there are warnings, not only errors")
 
 	rootCmd.AddCommand(compileCmd)
+	rootCmd.AddCommand(fmtCmd)
+	rootCmd.AddCommand(attrsCmd)
+	rootCmd.AddCommand(lintCmd)
 
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if !errors.Is(err, errDiagnosticsReported) {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
 		os.Exit(1)
 	}
 }
@@ -51,31 +115,88 @@ func compileCommand(cmd *cobra.Command, args []string) error {
 		inputFile = "-"
 	}
 
-	// Get output file
+	// Get output file; the default depends on the diagrams in the file
 	outputFile, _ := cmd.Flags().GetString("output")
-	if outputFile == "" {
-		if inputFile == "-" {
-			outputFile = "-" // stdout
-		} else {
-			outputFile = replaceExtension(inputFile, ".svg")
+
+	var opts compileOptions
+	opts.Verbose, _ = cmd.Flags().GetBool("verbose")
+	opts.Eval, _ = cmd.Flags().GetBool("eval")
+	opts.Diagram, _ = cmd.Flags().GetString("diagram")
+	opts.Profile, _ = cmd.Flags().GetString("profile")
+	defines, _ := cmd.Flags().GetStringArray("define")
+	for _, define := range defines {
+		key, value, err := parseDefine(define)
+		if err != nil {
+			return err
 		}
+		if opts.Defines == nil {
+			opts.Defines = make(map[string]string)
+		}
+		opts.Defines[key] = value
+	}
+	if cmd.Flags().Changed("implicit-nodes") {
+		implicit, _ := cmd.Flags().GetBool("implicit-nodes")
+		opts.ImplicitNodes = &implicit
 	}
 
-	verbose, _ := cmd.Flags().GetBool("verbose")
+	format, _ := cmd.Flags().GetString("diagnostics")
+	if format != "text" && format != "json" {
+		return fmt.Errorf("invalid --diagnostics format '%s' (expected text or json)", format)
+	}
 
 	// Compile the diagram
-	if err := compileDiagram(inputFile, outputFile, verbose); err != nil {
+	err := compileDiagram(inputFile, outputFile, opts)
+	return reportDiagnostics(cmd, err, format)
+}
+
+// errDiagnosticsReported is returned by commands that have already
+// written their diagnostics, so that main only sets the exit status
+var errDiagnosticsReported = errors.New("diagnostics reported")
+
+// reportDiagnostics writes the problems in a compilation error to
+// standard error. JSON output is always written, as an empty list if
+// compilation succeeded; in text mode, errors without a source location
+// are returned to be printed as usual.
+func reportDiagnostics(cmd *cobra.Command, err error, format string) error {
+	diagnostics := DiagnosticsOf(err)
+	if format == "json" {
+		if werr := WriteDiagnosticsJSON(cmd.ErrOrStderr(), diagnostics); werr != nil {
+			return werr
+		}
+	} else if err == nil {
+		return nil
+	} else if len(diagnostics) == 1 && !diagnostics[0].Span.IsValid() {
 		return fmt.Errorf("compilation failed: %w", err)
+	} else {
+		WriteDiagnostics(cmd.ErrOrStderr(), diagnostics)
 	}
 
-	if verbose {
-		fmt.Printf("Successfully compiled %s to %s\n", inputFile, outputFile)
+	if err == nil {
+		return nil
 	}
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+	return errDiagnosticsReported
+}
 
-	return nil
+// compileOptions holds the settings of a compile run
+type compileOptions struct {
+	Verbose bool
+	Eval    bool
+
+	// ImplicitNodes overrides the diagram's implicit-nodes option when set
+	ImplicitNodes *bool
+
+	// Diagram selects one diagram of a file holding several
+	Diagram string
+
+	// Profile selects the variant to compile, and Defines sets variables
+	// tested by :when, overriding those of the profile
+	Profile string
+	Defines map[string]string
 }
 
-func compileDiagram(inputFile, outputFile string, verbose bool) error {
+func compileDiagram(inputFile, outputFile string, opts compileOptions) error {
 	// Read input
 	var input []byte
 	var err error
@@ -92,29 +213,127 @@ func compileDiagram(inputFile, outputFile string, verbose bool) error {
 		}
 	}
 
-	if verbose {
+	if opts.Verbose {
 		fmt.Printf("Parsing S-expression from %s...\n", inputFile)
 	}
 
 	// Parse S-expression
-	lexer := NewLexer(string(input))
+	sourceName := inputFile
+	if inputFile == "-" {
+		sourceName = "<stdin>"
+	}
+	lexer := NewFileLexer(sourceName, string(input))
 	parser := NewParser(lexer)
-	diagram, err := parser.ParseDiagram()
+	if opts.Eval {
+		parser.SetEvaluator(NewEvaluator())
+	}
+	diagrams, err := parser.ParseDiagrams()
 	if err != nil {
 		return fmt.Errorf("parsing failed: %w", err)
 	}
 
-	if verbose {
+	if opts.Diagram != "" {
+		diagram, err := findDiagram(diagrams, opts.Diagram)
+		if err != nil {
+			return err
+		}
+		diagrams = []*Diagram{diagram}
+	}
+
+	// Files holding several diagrams write one SVG per diagram, named
+	// after it
+	several := len(diagrams) > 1
+	if several && (outputFile != "" || inputFile == "-") {
+		return fmt.Errorf("%s holds %d diagrams: select one with --diagram", sourceName, len(diagrams))
+	}
+
+	// Render every diagram before writing any, so that a failure leaves
+	// no partial output behind
+	contents := make([]string, len(diagrams))
+	for i, diagram := range diagrams {
+		if contents[i], err = renderDiagram(diagram, opts); err != nil {
+			return err
+		}
+	}
+
+	for i, diagram := range diagrams {
+		output := outputFile
+		switch {
+		case output != "":
+		case inputFile == "-":
+			output = "-" // stdout
+		case several:
+			output = replaceExtension(inputFile, "."+diagram.Name+".svg")
+		default:
+			output = replaceExtension(inputFile, ".svg")
+		}
+
+		if output == "-" {
+			fmt.Print(contents[i])
+		} else if err := os.WriteFile(output, []byte(contents[i]), 0644); err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
+		}
+		if opts.Verbose {
+			fmt.Printf("Successfully compiled %s to %s\n", inputFile, output)
+		}
+	}
+
+	return nil
+}
+
+// findDiagram returns the diagram with the given name
+func findDiagram(diagrams []*Diagram, name string) (*Diagram, error) {
+	var names []string
+	for _, diagram := range diagrams {
+		if diagram.Name == name {
+			return diagram, nil
+		}
+		if diagram.Name != "" {
+			names = append(names, diagram.Name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no diagram named '%s': the file has no named diagrams", name)
+	}
+	return nil, fmt.Errorf("no diagram named '%s' (available: %s)", name, strings.Join(names, ", "))
+}
+
+// renderDiagram validates and lays out one diagram and returns its SVG
+func renderDiagram(diagram *Diagram, opts compileOptions) (string, error) {
+	if opts.Verbose {
+		if diagram.Name != "" {
+			fmt.Printf("Diagram '%s':\n", diagram.Name)
+		}
 		fmt.Printf("Parsed diagram with %d nodes and %d edges\n", len(diagram.Nodes), len(diagram.Edges))
 	}
 
+	// Leave out the elements not in the selected variant
+	if err := diagram.ApplyProfile(opts.Profile, opts.Defines); err != nil {
+		return "", fmt.Errorf("profile failed: %w", err)
+	}
+	if opts.Verbose && (opts.Profile != "" || len(opts.Defines) > 0) {
+		fmt.Printf("Kept %d nodes and %d edges\n", len(diagram.Nodes), len(diagram.Edges))
+	}
+
+	// Declare nodes used only by edges
+	if opts.ImplicitNodes != nil {
+		diagram.Options.ImplicitNodes = *opts.ImplicitNodes
+	}
+	if diagram.Options.ImplicitNodes {
+		for _, node := range diagram.AddImplicitNodes() {
+			if opts.Verbose {
+				fmt.Printf("Created implicit node '%s' (first used at %s)\n", node.ID, node.Span)
+			}
+		}
+	}
+
 	// Validate AST
 	validator := NewValidator()
 	if err := validator.Validate(diagram); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return "", fmt.Errorf("validation failed: %w", err)
 	}
 
-	if verbose {
+	if opts.Verbose {
 		fmt.Println("Validation passed")
 	}
 
@@ -122,10 +341,10 @@ func compileDiagram(inputFile, outputFile string, verbose bool) error {
 	layouter := NewSimpleLayouter()
 	layout, err := layouter.LayoutDiagram(diagram)
 	if err != nil {
-		return fmt.Errorf("layout failed: %w", err)
+		return "", fmt.Errorf("layout failed: %w", err)
 	}
 
-	if verbose {
+	if opts.Verbose {
 		fmt.Printf("Layout completed: %.0fx%.0f\n", layout.Width, layout.Height)
 	}
 
@@ -133,22 +352,162 @@ func compileDiagram(inputFile, outputFile string, verbose bool) error {
 	svgGenerator := NewSVGGenerator()
 	svgContent := svgGenerator.GenerateWithCustomStyles(layout, diagram)
 
-	if verbose {
+	if opts.Verbose {
 		fmt.Println("Generated SVG content")
 	}
 
-	// Write output
-	if outputFile == "-" {
-		fmt.Print(svgContent)
-	} else {
-		if err := os.WriteFile(outputFile, []byte(svgContent), 0644); err != nil {
-			return fmt.Errorf("failed to write output file: %w", err)
+	return svgContent, nil
+}
+
+func fmtCommand(cmd *cobra.Command, args []string) error {
+	write, _ := cmd.Flags().GetBool("write")
+	check, _ := cmd.Flags().GetBool("check")
+	var opts FormatOptions
+	opts.Sort, _ = cmd.Flags().GetBool("sort")
+
+	if len(args) == 0 {
+		if write {
+			return fmt.Errorf("cannot use -w when reading from stdin")
+		}
+		args = []string{"-"}
+	}
+
+	unformatted := 0
+	for _, inputFile := range args {
+		var input []byte
+		var err error
+		sourceName := inputFile
+		if inputFile == "-" {
+			sourceName = "<stdin>"
+			input, err = io.ReadAll(os.Stdin)
+		} else {
+			input, err = os.ReadFile(inputFile)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read input file: %w", err)
+		}
+
+		output, err := Format(sourceName, input, opts)
+		if err != nil {
+			return fmt.Errorf("formatting failed: %w", err)
+		}
+
+		switch {
+		case check:
+			if !bytes.Equal(input, output) {
+				fmt.Println(sourceName)
+				unformatted++
+			}
+		case write:
+			if !bytes.Equal(input, output) {
+				if err := os.WriteFile(inputFile, output, 0644); err != nil {
+					return fmt.Errorf("failed to write output file: %w", err)
+				}
+			}
+		default:
+			os.Stdout.Write(output)
+		}
+	}
+
+	if unformatted > 0 {
+		return fmt.Errorf("%d file(s) not formatted", unformatted)
+	}
+	return nil
+}
+
+func attrsCommand(cmd *cobra.Command, args []string) error {
+	return WriteAttributeReference(cmd.OutOrStdout(), args)
+}
+
+func lintCommand(cmd *cobra.Command, args []string) error {
+	eval, _ := cmd.Flags().GetBool("eval")
+	failOnWarnings, _ := cmd.Flags().GetBool("fail-on-warnings")
+	format, _ := cmd.Flags().GetString("diagnostics")
+	if format != "text" && format != "json" {
+		return fmt.Errorf("invalid --diagnostics format '%s' (expected text or json)", format)
+	}
+
+	var config LintConfig
+	if configFile, _ := cmd.Flags().GetString("config"); configFile != "" {
+		input, err := os.ReadFile(configFile)
+		if err != nil {
+			return fmt.Errorf("failed to read lint config: %w", err)
 		}
+		if config, err = ReadLintConfig(configFile, input); err != nil {
+			return fmt.Errorf("invalid lint config: %w", err)
+		}
+	}
+
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+	var diagnostics []Diagnostic
+	for _, inputFile := range args {
+		found, err := lintFile(inputFile, config, eval)
+		if err != nil {
+			return err
+		}
+		diagnostics = append(diagnostics, found...)
+	}
+
+	if format == "json" {
+		if err := WriteDiagnosticsJSON(cmd.OutOrStdout(), diagnostics); err != nil {
+			return err
+		}
+	} else {
+		WriteDiagnostics(cmd.OutOrStdout(), diagnostics)
 	}
 
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError || (failOnWarnings && d.Severity == SeverityWarning) {
+			cmd.SilenceErrors = true
+			return errDiagnosticsReported
+		}
+	}
 	return nil
 }
 
+// lintFile validates and lints the diagrams of a file. Files that do not
+// parse are reported without being linted, as are diagrams that fail
+// validation.
+func lintFile(inputFile string, config LintConfig, eval bool) ([]Diagnostic, error) {
+	var input []byte
+	var err error
+	sourceName := inputFile
+	if inputFile == "-" {
+		sourceName = "<stdin>"
+		input, err = io.ReadAll(os.Stdin)
+	} else {
+		input, err = os.ReadFile(inputFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input file: %w", err)
+	}
+
+	parser := NewParser(NewFileLexer(sourceName, string(input)))
+	if eval {
+		parser.SetEvaluator(NewEvaluator())
+	}
+	diagrams, err := parser.ParseDiagrams()
+	if err != nil {
+		return DiagnosticsOf(err), nil
+	}
+
+	var diagnostics []Diagnostic
+	for _, diagram := range diagrams {
+		if diagram.Options.ImplicitNodes {
+			diagram.AddImplicitNodes()
+		}
+		validator := NewValidator()
+		if err := validator.Validate(diagram); err != nil {
+			diagnostics = append(diagnostics, DiagnosticsOf(err)...)
+			continue
+		}
+		diagnostics = append(diagnostics, validator.Lint(diagram, config.Merge(diagram.Lint))...)
+	}
+	return diagnostics, nil
+}
+
 func replaceExtension(filename, newExt string) string {
 	ext := filepath.Ext(filename)
 	if ext == "" {
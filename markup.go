@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// TextStyle is the styling of a run of label text. Size is a font size in
+// px and Color a CSS color; zero values inherit from the label.
+type TextStyle struct {
+	Bold   bool
+	Italic bool
+	Mono   bool
+	Size   float64
+	Color  string
+}
+
+// TextRun is a piece of label text drawn in one style
+type TextRun struct {
+	Text  string
+	Style TextStyle
+}
+
+// markupChars are the characters that can be escaped with a backslash to
+// be taken literally
+const markupChars = "*`[]{}\\"
+
+// ParseLabel splits a label into lines of styled runs. Labels may contain
+//
+//	**bold**, *italic*, `monospace`
+//	[text]{size=14 color=#c00}
+//
+// and line breaks. Markup does not span lines, and markers without a
+// partner are kept as text. The returned error lists invalid span
+// attributes, which are ignored.
+func ParseLabel(label string) ([][]TextRun, error) {
+	var errors []string
+	lines := make([][]TextRun, 0, 1)
+	for _, line := range strings.Split(label, "\n") {
+		lines = append(lines, mergeRuns(parseInline(line, TextStyle{}, &errors)))
+	}
+	if len(errors) > 0 {
+		return lines, fmt.Errorf("%s", strings.Join(errors, "; "))
+	}
+	return lines, nil
+}
+
+// PlainLabel returns the text of a label without its markup
+func PlainLabel(label string) string {
+	lines, _ := ParseLabel(label)
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		for _, run := range line {
+			texts[i] += run.Text
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// parseInline parses the markup of a single line, drawn in style
+func parseInline(text string, style TextStyle, errors *[]string) []TextRun {
+	var runs []TextRun
+	var sb strings.Builder
+	flush := func() {
+		if sb.Len() > 0 {
+			runs = append(runs, TextRun{Text: sb.String(), Style: style})
+			sb.Reset()
+		}
+	}
+
+	for i := 0; i < len(text); {
+		switch {
+		case text[i] == '\\' && i+1 < len(text) && strings.IndexByte(markupChars, text[i+1]) >= 0:
+			sb.WriteByte(text[i+1])
+			i += 2
+			continue
+
+		case text[i] == '`':
+			if end := strings.IndexByte(text[i+1:], '`'); end > 0 {
+				flush()
+				mono := style
+				mono.Mono = true
+				runs = append(runs, TextRun{Text: text[i+1 : i+1+end], Style: mono})
+				i += end + 2
+				continue
+			}
+
+		case strings.HasPrefix(text[i:], "**"):
+			if end := closingMarker(text[i+2:], "**"); end > 0 {
+				flush()
+				bold := style
+				bold.Bold = true
+				runs = append(runs, parseInline(text[i+2:i+2+end], bold, errors)...)
+				i += end + 4
+				continue
+			}
+			// Keep both stars so a lone ** is not read as two italics
+			sb.WriteString("**")
+			i += 2
+			continue
+
+		case text[i] == '*':
+			if end := closingMarker(text[i+1:], "*"); end > 0 {
+				flush()
+				italic := style
+				italic.Italic = true
+				runs = append(runs, parseInline(text[i+1:i+1+end], italic, errors)...)
+				i += end + 2
+				continue
+			}
+
+		case text[i] == '[':
+			if content, attrs, n, ok := bracketedSpan(text[i:]); ok {
+				flush()
+				runs = append(runs, parseInline(content, spanStyle(style, attrs, errors), errors)...)
+				i += n
+				continue
+			}
+		}
+
+		sb.WriteByte(text[i])
+		i++
+	}
+	flush()
+	return runs
+}
+
+// closingMarker returns the index in text of the marker closing an
+// emphasis, or -1. The emphasised text must not be empty or start or end
+// with a space; escaped characters and code are skipped, and for "*" so
+// are the "**" of bold text inside it.
+func closingMarker(text, marker string) int {
+	if text == "" || text[0] == ' ' || strings.HasPrefix(text, marker) {
+		return -1
+	}
+	for i := 0; i < len(text); i++ {
+		switch {
+		case text[i] == '\\':
+			i++
+		case text[i] == '`':
+			if end := strings.IndexByte(text[i+1:], '`'); end > 0 {
+				i += end + 1
+			}
+		case marker == "*" && strings.HasPrefix(text[i:], "**"):
+			if end := closingMarker(text[i+2:], "**"); end > 0 {
+				i += end + 3
+			} else {
+				i++
+			}
+		case strings.HasPrefix(text[i:], marker) && text[i-1] != ' ':
+			return i
+		}
+	}
+	return -1
+}
+
+// bracketedSpan reads a [text]{attributes} span at the start of text and
+// returns its content, its attributes and its length
+func bracketedSpan(text string) (string, string, int, bool) {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth > 0 {
+				continue
+			}
+			if !strings.HasPrefix(text[i+1:], "{") {
+				return "", "", 0, false
+			}
+			end := strings.IndexByte(text[i+1:], '}')
+			if end < 0 {
+				return "", "", 0, false
+			}
+			return text[1:i], text[i+2 : i+1+end], i + 2 + end, true
+		}
+	}
+	return "", "", 0, false
+}
+
+// spanStyle applies the size=... and color=... attributes of a bracketed
+// span to style
+func spanStyle(style TextStyle, attrs string, errors *[]string) TextStyle {
+	for _, attr := range strings.Fields(attrs) {
+		key, value, _ := strings.Cut(attr, "=")
+		switch key {
+		case "size":
+			length, err := ParseLength(value)
+			if err != nil || (length.Unit != "" && length.Unit != "px") || length.Value <= 0 {
+				*errors = append(*errors, fmt.Sprintf("invalid size '%s'", value))
+				continue
+			}
+			style.Size = length.Value
+		case "color":
+			if _, err := ParseColor(value); err != nil {
+				*errors = append(*errors, fmt.Sprintf("invalid color '%s'", value))
+				continue
+			}
+			style.Color = value
+		default:
+			*errors = append(*errors, fmt.Sprintf("unknown span attribute '%s'", key))
+		}
+	}
+	return style
+}
+
+// mergeRuns joins neighbouring runs drawn in the same style
+func mergeRuns(runs []TextRun) []TextRun {
+	var merged []TextRun
+	for _, run := range runs {
+		if n := len(merged); n > 0 && merged[n-1].Style == run.Style {
+			merged[n-1].Text += run.Text
+			continue
+		}
+		merged = append(merged, run)
+	}
+	return merged
+}
+
+// Average advance of a character in em, used to estimate how much room a
+// label needs without access to font metrics
+const (
+	charWidth     = 0.6
+	boldCharWidth = 0.65
+)
+
+// lineSize returns the largest font size used in a line of a label drawn
+// at fontSize
+func lineSize(line []TextRun, fontSize float64) float64 {
+	size := fontSize
+	for _, run := range line {
+		if run.Style.Size > size {
+			size = run.Style.Size
+		}
+	}
+	return size
+}
+
+// measureLabel estimates the width and height of a label drawn at
+// fontSize, as laid out by generateText
+func measureLabel(lines [][]TextRun, fontSize float64) (float64, float64) {
+	var width, height float64
+	for _, line := range lines {
+		var w float64
+		for _, run := range line {
+			size := fontSize
+			if run.Style.Size > 0 {
+				size = run.Style.Size
+			}
+			advance := charWidth
+			if run.Style.Bold {
+				advance = boldCharWidth
+			}
+			w += float64(utf8.RuneCountInString(run.Text)) * advance * size
+		}
+		width = math.Max(width, w)
+		height += labelLineHeight * lineSize(line, fontSize)
+	}
+	return width, height
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseLabel tests splitting labels into styled runs
+func TestParseLabel(t *testing.T) {
+	bold := TextStyle{Bold: true}
+	italic := TextStyle{Italic: true}
+	mono := TextStyle{Mono: true}
+
+	tests := []struct {
+		name     string
+		label    string
+		expected [][]TextRun
+	}{
+		{"plain", "Order service", [][]TextRun{{{Text: "Order service"}}}},
+		{"empty", "", [][]TextRun{nil}},
+		{"bold and code", "**Order** service\n`v2`", [][]TextRun{
+			{{Text: "Order", Style: bold}, {Text: " service"}},
+			{{Text: "v2", Style: mono}},
+		}},
+		{"italic", "a *b* c", [][]TextRun{{{Text: "a "}, {Text: "b", Style: italic}, {Text: " c"}}}},
+		{"bold inside italic", "*a **b** c*", [][]TextRun{{
+			{Text: "a ", Style: italic},
+			{Text: "b", Style: TextStyle{Bold: true, Italic: true}},
+			{Text: " c", Style: italic},
+		}}},
+		{"code keeps markup", "`**x**`", [][]TextRun{{{Text: "**x**", Style: mono}}}},
+		{"span", "[big]{size=16 color=#c00} text", [][]TextRun{
+			{{Text: "big", Style: TextStyle{Size: 16, Color: "#c00"}}, {Text: " text"}},
+		}},
+		{"markup in span", "[**x**]{color=red}", [][]TextRun{{{Text: "x", Style: TextStyle{Bold: true, Color: "red"}}}}},
+		{"unmatched markers", "2 * 3 = 6, a*b, **, [x] {y}", [][]TextRun{{{Text: "2 * 3 = 6, a*b, **, [x] {y}"}}}},
+		{"escapes", `\*not italic\* \[x\]{y}`, [][]TextRun{{{Text: "*not italic* [x]{y}"}}}},
+		{"markup does not span lines", "**a\nb**", [][]TextRun{{{Text: "**a"}}, {{Text: "b**"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, err := ParseLabel(tt.label)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(lines, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, lines)
+			}
+		})
+	}
+}
+
+// TestParseLabelErrors tests invalid span attributes
+func TestParseLabelErrors(t *testing.T) {
+	lines, err := ParseLabel("[a]{size=big} [b]{color=#12 weight=2}")
+	expected := "invalid size 'big'; invalid color '#12'; unknown span attribute 'weight'"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected error %q, got %v", expected, err)
+	}
+	if PlainLabel("[a]{size=big} [b]{color=#12 weight=2}") != "a b" || len(lines[0]) != 1 {
+		t.Errorf("Expected invalid attributes to be ignored, got %+v", lines)
+	}
+}
+
+// TestMeasureLabel tests the estimated size of labels with markup
+func TestMeasureLabel(t *testing.T) {
+	plain, _ := ParseLabel("abcd")
+	width, height := measureLabel(plain, 10)
+	if width != 24 || height != 12 {
+		t.Errorf("Expected 24x12, got %.2fx%.2f", width, height)
+	}
+
+	styled, _ := ParseLabel("**abcd**\n[ab]{size=20}")
+	width, height = measureLabel(styled, 10)
+	if width != 26 || height != 36 {
+		t.Errorf("Expected 26x36, got %.2fx%.2f", width, height)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"math"
+	"strings"
+)
+
+// PortSeparator separates a node ID from a port in edge endpoints, as in
+// "db:north" or "table:col3"
+const PortSeparator = ":"
+
+// compassPorts maps the compass points every node and group has to their
+// direction, with north pointing up
+var compassPorts = map[string]Point{
+	"n":  {X: 0, Y: 1},
+	"ne": {X: 1, Y: 1},
+	"e":  {X: 1, Y: 0},
+	"se": {X: 1, Y: -1},
+	"s":  {X: 0, Y: -1},
+	"sw": {X: -1, Y: -1},
+	"w":  {X: -1, Y: 0},
+	"nw": {X: -1, Y: 1},
+}
+
+// compassNames maps the long compass names to the short ones
+var compassNames = map[string]string{
+	"north":     "n",
+	"northeast": "ne",
+	"east":      "e",
+	"southeast": "se",
+	"south":     "s",
+	"southwest": "sw",
+	"west":      "w",
+	"northwest": "nw",
+}
+
+// compassPort returns the direction of a compass port, written either
+// short ("ne") or long ("northeast")
+func compassPort(port string) (Point, bool) {
+	if short, ok := compassNames[port]; ok {
+		port = short
+	}
+	dir, ok := compassPorts[port]
+	return dir, ok
+}
+
+// splitPort splits an "id:port" endpoint. Endpoints without a separator,
+// or with nothing on either side of it, are returned unchanged.
+func splitPort(endpoint string) (id, port string) {
+	id, port, found := strings.Cut(endpoint, PortSeparator)
+	if !found || id == "" || port == "" {
+		return endpoint, ""
+	}
+	return id, port
+}
+
+// edgeEndpoints are the endpoints of an edge as written, before splitPort
+type edgeEndpoints struct {
+	from, to string
+}
+
+// resolvePortEndpoints joins the endpoints split by splitPort again when
+// more of the endpoint is a declared node or group ID, so that an edge to
+// "db:primary" reaches the node of that name rather than port primary of
+// "db", and "db:primary:n" reaches its port n. written holds the
+// endpoints as written by edge index; edges without them, and endpoints
+// renamed since they were split, such as by a namespace, are left alone.
+func resolvePortEndpoints(d *Diagram, written map[int]edgeEndpoints) {
+	declared := make(map[string]bool)
+	for _, node := range d.Nodes {
+		declared[node.ID] = true
+	}
+	for _, group := range d.AllGroups() {
+		declared[group.ID] = true
+	}
+
+	join := func(id, port *string, text, portAttr string, attrSpans map[string]Span) {
+		if *id == text || !strings.HasPrefix(text, *id+PortSeparator) {
+			return
+		}
+		// The longest declared ID wins
+		for end := len(text); end > len(*id); end = strings.LastIndex(text[:end], PortSeparator) {
+			if declared[text[:end]] {
+				*id = text[:end]
+				if _, explicit := attrSpans[portAttr]; !explicit {
+					*port = strings.TrimPrefix(text[end:], PortSeparator)
+				}
+				return
+			}
+		}
+	}
+	for i, ends := range written {
+		edge := &d.Edges[i]
+		join(&edge.From, &edge.FromPort, ends.from, "from-port", edge.AttrSpans)
+		join(&edge.To, &edge.ToPort, ends.to, "to-port", edge.AttrSpans)
+	}
+}
+
+// NodePorts returns the named ports declared with :ports on node or its
+// classes
+func (d *Diagram) NodePorts(node Node) []string {
+	ports, _ := d.NodeAttribute(node, "ports")
+	return strings.Fields(ports)
+}
+
+// portPoint returns where an edge attached to port leaves node and the
+// direction it leaves in. Compass ports lie on the outline of the node's
+// shape. Named ports are spread evenly along side, the side the edge
+// would use without a port, in the order they are declared.
+func portPoint(node LayoutNode, port string, ports []string, side Point) (Point, Point, bool) {
+	if dir, ok := compassPort(port); ok {
+		return shapePoint(node, dir), normalize(dir), true
+	}
+
+	for i, name := range ports {
+		if name != port {
+			continue
+		}
+		offset := float64(i+1)/float64(len(ports)+1) - 0.5
+		if side.X == 0 {
+			return Point{X: node.X + offset*node.Width, Y: node.Y + side.Y*node.Height/2}, side, true
+		}
+		return Point{X: node.X + side.X*node.Width/2, Y: node.Y - offset*node.Height}, side, true
+	}
+	return Point{}, Point{}, false
+}
+
+// shapePoint returns the point where a ray from the centre of node in
+// direction dir meets the outline of its shape
+func shapePoint(node LayoutNode, dir Point) Point {
+	switch node.Shape {
+	case "ellipse", "circle", "oval":
+		dir = normalize(dir)
+	case "diamond", "rhombus":
+		sum := math.Abs(dir.X) + math.Abs(dir.Y)
+		dir = Point{X: dir.X / sum, Y: dir.Y / sum}
+	}
+	return Point{X: node.X + dir.X*node.Width/2, Y: node.Y + dir.Y*node.Height/2}
+}
+
+func normalize(p Point) Point {
+	length := math.Hypot(p.X, p.Y)
+	return Point{X: p.X / length, Y: p.Y / length}
+}
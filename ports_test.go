@@ -0,0 +1,72 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// TestSplitPort tests splitting "id:port" endpoints
+func TestSplitPort(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		id       string
+		port     string
+	}{
+		{"db", "db", ""},
+		{"db:north", "db", "north"},
+		{"auth/table:col3", "auth/table", "col3"},
+		{"db:", "db:", ""},
+		{":n", ":n", ""},
+	}
+
+	for _, tt := range tests {
+		id, port := splitPort(tt.endpoint)
+		if id != tt.id || port != tt.port {
+			t.Errorf("splitPort(%q) = %q, %q; expected %q, %q", tt.endpoint, id, port, tt.id, tt.port)
+		}
+	}
+}
+
+// TestPortPoint tests where compass and named ports lie on a node
+func TestPortPoint(t *testing.T) {
+	rect := LayoutNode{X: 0, Y: 0, Width: 100, Height: 50, Shape: "rect"}
+	diamond := LayoutNode{X: 0, Y: 0, Width: 100, Height: 50, Shape: "diamond"}
+	ellipse := LayoutNode{X: 0, Y: 0, Width: 100, Height: 50, Shape: "ellipse"}
+	south := Point{X: 0, Y: -1}
+	east := Point{X: 1, Y: 0}
+	fields := []string{"a", "b", "c"}
+
+	tests := []struct {
+		name     string
+		node     LayoutNode
+		port     string
+		side     Point
+		expected Point
+	}{
+		{"north", rect, "n", south, Point{X: 0, Y: 25}},
+		{"long name", rect, "north", south, Point{X: 0, Y: 25}},
+		{"rect corner", rect, "se", south, Point{X: 50, Y: -25}},
+		{"diamond side", diamond, "ne", south, Point{X: 25, Y: 12.5}},
+		{"diamond vertex", diamond, "w", south, Point{X: -50, Y: 0}},
+		{"ellipse", ellipse, "e", south, Point{X: 50, Y: 0}},
+		{"first field", rect, "a", south, Point{X: -25, Y: -25}},
+		{"last field", rect, "c", south, Point{X: 25, Y: -25}},
+		{"field on a vertical side", rect, "a", east, Point{X: 50, Y: 12.5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			point, _, ok := portPoint(tt.node, tt.port, fields, tt.side)
+			if !ok {
+				t.Fatalf("Expected port %q to exist", tt.port)
+			}
+			if math.Abs(point.X-tt.expected.X) > 0.01 || math.Abs(point.Y-tt.expected.Y) > 0.01 {
+				t.Errorf("Expected %v, got %v", tt.expected, point)
+			}
+		})
+	}
+
+	if _, _, ok := portPoint(rect, "missing", fields, south); ok {
+		t.Errorf("Expected unknown port to be rejected")
+	}
+}
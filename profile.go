@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Profile is a named variant of a diagram, defined with (profile ...) and
+// selected with --profile. It drops the elements carrying excluded tags
+// and the tagged elements carrying none of the included tags, and sets
+// the variables tested by :when.
+type Profile struct {
+	Name        string
+	IncludeTags []string
+	ExcludeTags []string
+	Defines     map[string]string
+
+	Span Span
+}
+
+// interpretProfile handles
+//
+//	(profile "public" :exclude-tags ("internal") :define ("audience=public"))
+func interpretProfile(in *Interpreter, diagram *Diagram, form Value) error {
+	if len(form.List) < 2 || (form.List[1].Kind != ValueString && form.List[1].Kind != ValueSymbol) {
+		return newSourceError(elementSpan(form, 1), "expected profile name, got %s", describeElement(form, 1))
+	}
+
+	attrs, err := readAttributes(form, 2)
+	in.report(err)
+
+	profile := Profile{
+		Name:    form.List[1].Text,
+		Defines: make(map[string]string),
+		Span:    form.Span,
+	}
+	for _, attr := range attrs {
+		items, err := attr.Value.AsList()
+		if err != nil {
+			in.report(newSourceError(attr.Span, "invalid :%s: %v", attr.Key, err))
+			continue
+		}
+		switch attr.Key {
+		case "include-tags":
+			profile.IncludeTags = append(profile.IncludeTags, items...)
+		case "exclude-tags":
+			profile.ExcludeTags = append(profile.ExcludeTags, items...)
+		case "define":
+			for _, item := range items {
+				key, value, err := parseDefine(item)
+				if err != nil {
+					in.report(newSourceError(attr.Span, "%v", err))
+					continue
+				}
+				profile.Defines[key] = value
+			}
+		default:
+			in.report(newSourceError(attr.Span, "unknown profile option: :%s", attr.Key))
+		}
+	}
+	diagram.Profiles = append(diagram.Profiles, profile)
+	return nil
+}
+
+// parseDefine splits a "key=value" variable definition
+func parseDefine(text string) (string, string, error) {
+	key, value, found := strings.Cut(text, "=")
+	if !found || key == "" || strings.ContainsAny(key, " !") {
+		return "", "", fmt.Errorf("invalid define '%s': expected key=value", text)
+	}
+	return key, value, nil
+}
+
+// FindProfile returns the profile with the given name
+func (d *Diagram) FindProfile(name string) (Profile, bool) {
+	for _, profile := range d.Profiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return Profile{}, false
+}
+
+// ApplyProfile removes the nodes, edges and groups left out of a variant
+// of the diagram: those filtered out by the named profile's tags, if name
+// is not empty, and those whose :when condition does not hold. Variables
+// in defines override those set by the profile. Removing a group removes
+// its members, and edges to removed nodes or groups are removed with
+// them; edges to IDs that were never declared are kept for the validator
+// to report.
+func (d *Diagram) ApplyProfile(name string, defines map[string]string) error {
+	var profile Profile
+	if name != "" {
+		var ok bool
+		if profile, ok = d.FindProfile(name); !ok {
+			var names []string
+			for _, p := range d.Profiles {
+				names = append(names, p.Name)
+			}
+			if len(names) == 0 {
+				return fmt.Errorf("no profile named '%s': the diagram defines no profiles", name)
+			}
+			return fmt.Errorf("no profile named '%s' (available: %s)", name, strings.Join(names, ", "))
+		}
+	}
+
+	vars := make(map[string]string)
+	for key, value := range profile.Defines {
+		vars[key] = value
+	}
+	for key, value := range defines {
+		vars[key] = value
+	}
+
+	var errors ErrorList
+	removed := make(map[string]bool)
+
+	// keep decides whether an element with the given tags and condition
+	// is part of the variant; what names it in error messages
+	keep := func(what, tags string, when string, span Span) bool {
+		if !profile.keepsTags(strings.Fields(tags)) {
+			return false
+		}
+		holds, err := evalCondition(when, vars)
+		if err != nil {
+			e := newSourceError(span, "%s: invalid :when: %v", what, err)
+			e.Code = CodeInvalidCondition
+			errors.Add(e)
+			return true
+		}
+		return holds
+	}
+
+	var filterGroups func([]Group) []Group
+	filterGroups = func(groups []Group) []Group {
+		var kept []Group
+		for _, group := range groups {
+			what := fmt.Sprintf("group '%s'", group.ID)
+			if !keep(what, group.Attributes["tags"], group.Attributes["when"], group.AttrSpan("when")) {
+				removed[group.ID] = true
+				for _, child := range (&Diagram{Groups: group.Groups}).AllGroups() {
+					removed[child.ID] = true
+				}
+				for _, id := range group.Members() {
+					removed[id] = true
+				}
+				continue
+			}
+			group.Groups = filterGroups(group.Groups)
+			kept = append(kept, group)
+		}
+		return kept
+	}
+	d.Groups = filterGroups(d.Groups)
+
+	var nodes []Node
+	for _, node := range d.Nodes {
+		tags, _ := d.NodeAttribute(node, "tags")
+		when, _ := d.NodeAttribute(node, "when")
+		what := fmt.Sprintf("node '%s'", node.ID)
+		if removed[node.ID] || !keep(what, tags, when, node.AttrSpan("when")) {
+			removed[node.ID] = true
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	d.Nodes = nodes
+	d.Groups = removeMembers(d.Groups, removed)
+
+	var edges []Edge
+	for i, edge := range d.Edges {
+		if removed[edge.From] || removed[edge.To] {
+			continue
+		}
+		tags, _ := d.EdgeAttribute(edge, "tags")
+		when, _ := d.EdgeAttribute(edge, "when")
+		if !keep(fmt.Sprintf("edge %d", i), tags, when, edge.AttrSpan("when")) {
+			continue
+		}
+		edges = append(edges, edge)
+	}
+	d.Edges = edges
+
+	return errors.Err()
+}
+
+// removeMembers drops removed nodes from the member lists of groups
+func removeMembers(groups []Group, removed map[string]bool) []Group {
+	for i := range groups {
+		var members []string
+		for _, id := range groups[i].Nodes {
+			if !removed[id] {
+				members = append(members, id)
+			}
+		}
+		groups[i].Nodes = members
+		groups[i].Groups = removeMembers(groups[i].Groups, removed)
+	}
+	return groups
+}
+
+// keepsTags reports whether an element with the given tags is part of the
+// profile's variant. Untagged elements are only dropped by :when.
+func (p Profile) keepsTags(tags []string) bool {
+	has := make(map[string]bool)
+	for _, tag := range tags {
+		has[tag] = true
+	}
+	for _, tag := range p.ExcludeTags {
+		if has[tag] {
+			return false
+		}
+	}
+	if len(p.IncludeTags) == 0 || len(tags) == 0 {
+		return true
+	}
+	for _, tag := range p.IncludeTags {
+		if has[tag] {
+			return true
+		}
+	}
+	return false
+}
+
+// evalCondition evaluates a :when condition: space-separated terms that
+// must all hold, each one of
+//
+//	key        key is defined and not "false"
+//	!key       key is undefined or "false"
+//	key=value  key is defined as value
+//	key!=value key is not defined as value
+func evalCondition(condition string, vars map[string]string) (bool, error) {
+	holds := true
+	for _, term := range strings.Fields(condition) {
+		var ok bool
+		if key, value, found := strings.Cut(term, "!="); found {
+			if key == "" {
+				return false, fmt.Errorf("invalid condition '%s'", term)
+			}
+			ok = vars[key] != value
+		} else if key, value, found := strings.Cut(term, "="); found {
+			if key == "" {
+				return false, fmt.Errorf("invalid condition '%s'", term)
+			}
+			ok = vars[key] == value
+		} else if key, found := strings.CutPrefix(term, "!"); found {
+			if key == "" {
+				return false, fmt.Errorf("invalid condition '%s'", term)
+			}
+			ok = !isSet(vars, key)
+		} else {
+			ok = isSet(vars, term)
+		}
+		holds = holds && ok
+	}
+	return holds, nil
+}
+
+// isSet reports whether a variable is defined and not "false"
+func isSet(vars map[string]string, key string) bool {
+	value, ok := vars[key]
+	return ok && value != "false"
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const profileInput = `(diagram
+  (profile "public" :exclude-tags ("internal"))
+  (profile "ops" :include-tags ("ops") :define ("env=prod"))
+  (defclass "secret" :tags "internal")
+  (nodes
+    (id "web")
+    (id "api" :tags ("public" "ops"))
+    (id "admin" :class "secret")
+    (id "metrics" :tags "ops")
+    (id "docs" :tags "public")
+    (id "debug" :when "env!=prod"))
+  (group "backoffice" :tags "internal"
+    (nodes (id "billing"))
+    (group "inner" (nodes (id "ledger"))))
+  (edges
+    ("web" "api")
+    ("api" "admin")
+    ("api" "billing")
+    ("web" "docs" :tags "internal")
+    ("api" "metrics" :when "env=prod")
+    ("api" "missing")))`
+
+// TestApplyProfile tests filtering diagrams by profile tags and :when
+func TestApplyProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		defines map[string]string
+		nodes   []string
+		edges   []string
+		groups  int
+	}{
+		{"no profile", "", nil,
+			[]string{"web", "api", "admin", "metrics", "docs", "debug", "billing", "ledger"},
+			[]string{"web-api", "api-admin", "api-billing", "web-docs", "api-missing"}, 1},
+		{"exclude tags", "public", nil,
+			[]string{"web", "api", "metrics", "docs", "debug"},
+			[]string{"web-api", "api-missing"}, 0},
+		{"include tags and defines", "ops", nil,
+			[]string{"web", "api", "metrics"},
+			[]string{"web-api", "api-metrics", "api-missing"}, 0},
+		{"defines override the profile", "ops", map[string]string{"env": "dev"},
+			[]string{"web", "api", "metrics", "debug"},
+			[]string{"web-api", "api-missing"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagram := ParseTestInput(t, profileInput)
+			if err := diagram.ApplyProfile(tt.profile, tt.defines); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var nodes, edges []string
+			for _, node := range diagram.Nodes {
+				nodes = append(nodes, node.ID)
+			}
+			for _, edge := range diagram.Edges {
+				edges = append(edges, edge.From+"-"+edge.To)
+			}
+			if !reflect.DeepEqual(nodes, tt.nodes) {
+				t.Errorf("Expected nodes %v, got %v", tt.nodes, nodes)
+			}
+			if !reflect.DeepEqual(edges, tt.edges) {
+				t.Errorf("Expected edges %v, got %v", tt.edges, edges)
+			}
+			if len(diagram.Groups) != tt.groups {
+				t.Errorf("Expected %d groups, got %d", tt.groups, len(diagram.Groups))
+			}
+		})
+	}
+}
+
+// TestApplyProfileMembers tests that removed nodes leave their groups
+func TestApplyProfileMembers(t *testing.T) {
+	diagram := ParseTestInput(t, `(diagram
+  (group "g" (nodes (id "a") (id "b" :when "full"))))`)
+	if err := diagram.ApplyProfile("", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if members := diagram.Groups[0].Members(); !reflect.DeepEqual(members, []string{"a"}) {
+		t.Errorf("Expected group members [a], got %v", members)
+	}
+	if err := NewValidator().Validate(diagram); err != nil {
+		t.Errorf("Expected the filtered diagram to validate, got %v", err)
+	}
+}
+
+// TestApplyProfileErrors tests unknown profiles and invalid conditions
+func TestApplyProfileErrors(t *testing.T) {
+	diagram := ParseTestInput(t, profileInput)
+	err := diagram.ApplyProfile("internal", nil)
+	if err == nil || err.Error() != "no profile named 'internal' (available: public, ops)" {
+		t.Errorf("Expected an unknown profile error, got %v", err)
+	}
+
+	diagram = ParseTestInput(t, `(diagram (nodes (id "a" :when "=x")))`)
+	err = diagram.ApplyProfile("", nil)
+	if err == nil || !strings.Contains(err.Error(), "1:25: node 'a': invalid :when: invalid condition '=x'") {
+		t.Errorf("Expected an invalid condition error, got %v", err)
+	}
+}
+
+// TestEvalCondition tests :when conditions
+func TestEvalCondition(t *testing.T) {
+	vars := map[string]string{"env": "prod", "beta": "false", "debug": ""}
+	tests := []struct {
+		condition string
+		expected  bool
+	}{
+		{"", true},
+		{"env", true},
+		{"beta", false},
+		{"debug", true},
+		{"missing", false},
+		{"!beta", true},
+		{"!env", false},
+		{"env=prod", true},
+		{"env=dev", false},
+		{"env!=dev", true},
+		{"missing=", true},
+		{"env=prod !beta", true},
+		{"env=prod beta", false},
+	}
+
+	for _, tt := range tests {
+		holds, err := evalCondition(tt.condition, vars)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.condition, err)
+		}
+		if holds != tt.expected {
+			t.Errorf("%q: expected %v, got %v", tt.condition, tt.expected, holds)
+		}
+	}
+}
+
+// TestInterpreterProfileErrors tests errors in profile definitions
+func TestInterpreterProfileErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"missing name", "(diagram (profile))", "1:18: expected profile name, got )"},
+		{"unknown option", "(diagram (profile \"p\" :hide-tags (\"x\")))", "1:23: unknown profile option: :hide-tags"},
+		{"bad define", "(diagram (profile \"p\" :define (\"x\")))", "1:23: invalid define 'x': expected key=value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewParser(NewLexer(tt.input)).ParseDiagram()
+			if err == nil {
+				t.Fatalf("Expected error")
+			}
+			if !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error containing '%s', got: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+// TestValidatorProfiles tests duplicate profile names
+func TestValidatorProfiles(t *testing.T) {
+	diagram := ParseTestInput(t, `(diagram (profile "p") (profile "p"))`)
+	err := NewValidator().Validate(diagram)
+	if err == nil || !strings.Contains(err.Error(), "1:24: duplicate profile: p") {
+		t.Errorf("Expected a duplicate profile error, got %v", err)
+	}
+}
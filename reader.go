@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ValueKind identifies the type of a Value
+type ValueKind int
+
+const (
+	ValueList ValueKind = iota
+	ValueSymbol
+	ValueKeyword
+	ValueString
+	ValueInt
+	ValueFloat
+	ValueBool
+)
+
+func (k ValueKind) String() string {
+	switch k {
+	case ValueList:
+		return "list"
+	case ValueSymbol:
+		return "symbol"
+	case ValueKeyword:
+		return "keyword"
+	case ValueString:
+		return "string"
+	case ValueInt:
+		return "integer"
+	case ValueFloat:
+		return "float"
+	case ValueBool:
+		return "boolean"
+	default:
+		return "unknown"
+	}
+}
+
+// Value is a datum read from S-expression source. Text holds the name of
+// a symbol or keyword (without the colon), the contents of a string, or
+// the literal spelling of a number or boolean.
+type Value struct {
+	Kind  ValueKind
+	Text  string
+	Int   int64
+	Float float64
+	Bool  bool
+	List  []Value
+	Span  Span
+}
+
+// IsAtom reports whether the value can be used where a plain name or
+// scalar is expected (anything but lists and keywords)
+func (v Value) IsAtom() bool {
+	return v.Kind != ValueList && v.Kind != ValueKeyword
+}
+
+// Head returns the symbol name at the start of a list, or "" if the value
+// is not a list starting with a symbol
+func (v Value) Head() string {
+	if v.Kind != ValueList || len(v.List) == 0 || v.List[0].Kind != ValueSymbol {
+		return ""
+	}
+	return v.List[0].Text
+}
+
+// CloseSpan returns the location of the closing parenthesis of a list
+func (v Value) CloseSpan() Span {
+	end := v.Span.End
+	if !end.IsValid() {
+		return v.Span
+	}
+	start := end
+	start.Offset--
+	start.Column--
+	return Span{Start: start, End: end}
+}
+
+// String renders the value as S-expression source
+func (v Value) String() string {
+	switch v.Kind {
+	case ValueList:
+		parts := make([]string, len(v.List))
+		for i, elem := range v.List {
+			parts[i] = elem.String()
+		}
+		return "(" + strings.Join(parts, " ") + ")"
+	case ValueKeyword:
+		return ":" + v.Text
+	case ValueString:
+		return quoteString(v.Text)
+	case ValueInt:
+		if v.Text == "" {
+			return strconv.FormatInt(v.Int, 10)
+		}
+		return v.Text
+	case ValueFloat:
+		if v.Text == "" {
+			return strconv.FormatFloat(v.Float, 'g', -1, 64)
+		}
+		return v.Text
+	case ValueBool:
+		return strconv.FormatBool(v.Bool)
+	default:
+		return v.Text
+	}
+}
+
+// describe renders a value for use in error messages
+func (v Value) describe() string {
+	text := v.String()
+	if len(text) > 40 {
+		text = text[:37] + "..."
+	}
+	return text
+}
+
+// quoteString renders text as a string literal the lexer reads back
+// unchanged
+func quoteString(text string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range text {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\r':
+			sb.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				sb.WriteString(fmt.Sprintf(`\u{%x}`, r))
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// Reader reads S-expression values from a lexer. Syntax errors do not
+// stop reading: they are recorded, the reader resynchronises and carries
+// on, and all of them are available from Err once reading is done.
+type Reader struct {
+	lexer  *Lexer
+	cur    Token
+	errors ErrorList
+}
+
+func NewReader(lexer *Lexer) *Reader {
+	r := &Reader{lexer: lexer}
+	r.next()
+	return r
+}
+
+func (r *Reader) next() {
+	r.cur = r.lexer.NextToken()
+}
+
+func (r *Reader) errorf(span Span, format string, args ...interface{}) {
+	err := newSourceError(span, format, args...)
+	err.Code = CodeSyntax
+	r.errors.Add(err)
+}
+
+// Read returns the next complete value, or io.EOF when the input is
+// exhausted. Stray tokens between values are reported and skipped, and an
+// unclosed list is returned with the elements read so far.
+func (r *Reader) Read() (Value, error) {
+	for {
+		switch r.cur.Type {
+		case TokenEOF:
+			return Value{}, io.EOF
+		case TokenRParen:
+			r.errorf(r.cur.Span, "unexpected ')'")
+			r.next()
+		case TokenError:
+			r.errorf(r.cur.Span, "%s", r.cur.Value)
+			r.next()
+		default:
+			return r.readValue(), nil
+		}
+	}
+}
+
+// ReadAll reads every remaining value and returns them together with any
+// syntax errors encountered
+func (r *Reader) ReadAll() ([]Value, error) {
+	var values []Value
+	for {
+		value, err := r.Read()
+		if err == io.EOF {
+			return values, r.Err()
+		}
+		values = append(values, value)
+	}
+}
+
+// Err returns the syntax errors recorded so far, or nil if there were none
+func (r *Reader) Err() error {
+	return r.errors.Err()
+}
+
+// Span returns the location of the next unread token
+func (r *Reader) Span() Span {
+	return r.cur.Span
+}
+
+// readValue reads the value starting at the current token, which must not
+// be ')', an error token or the end of input
+func (r *Reader) readValue() Value {
+	tok := r.cur
+	switch tok.Type {
+	case TokenLParen:
+		return r.readList()
+	case TokenKeyword:
+		r.next()
+		return Value{Kind: ValueKeyword, Text: tok.Value, Span: tok.Span}
+	case TokenString:
+		r.next()
+		return Value{Kind: ValueString, Text: tok.Value, Span: tok.Span}
+	default:
+		r.next()
+		return atomValue(tok)
+	}
+}
+
+func (r *Reader) readList() Value {
+	open := r.cur.Span
+	r.next() // consume '('
+
+	list := Value{Kind: ValueList, List: []Value{}}
+	for r.cur.Type != TokenRParen {
+		switch r.cur.Type {
+		case TokenEOF:
+			r.errorf(open, "unclosed '(': expected ')' before end of input")
+			list.Span = Span{Start: open.Start, End: r.cur.Span.Start}
+			return list
+		case TokenError:
+			// Keep the shape of the form so the interpreter does not
+			// report follow-on errors for the rejected token
+			r.errorf(r.cur.Span, "%s", r.cur.Value)
+			list.List = append(list.List, Value{Kind: ValueString, Span: r.cur.Span})
+			r.next()
+		default:
+			list.List = append(list.List, r.readValue())
+		}
+	}
+
+	list.Span = Span{Start: open.Start, End: r.cur.Span.End}
+	r.next() // consume ')'
+	return list
+}
+
+// atomValue classifies an atom token as a number, boolean or symbol
+func atomValue(tok Token) Value {
+	value := Value{Kind: ValueSymbol, Text: tok.Value, Span: tok.Span}
+
+	switch tok.Value {
+	case "true", "false":
+		value.Kind = ValueBool
+		value.Bool = tok.Value == "true"
+		return value
+	}
+
+	if !looksNumeric(tok.Value) {
+		return value
+	}
+	if n, err := strconv.ParseInt(tok.Value, 10, 64); err == nil {
+		value.Kind = ValueInt
+		value.Int = n
+	} else if f, err := strconv.ParseFloat(tok.Value, 64); err == nil {
+		value.Kind = ValueFloat
+		value.Float = f
+	}
+	return value
+}
+
+// looksNumeric reports whether text starts like a decimal number, which
+// keeps words such as "Inf" or "NaN" as symbols
+func looksNumeric(text string) bool {
+	text = strings.TrimLeft(text, "+-")
+	text = strings.TrimPrefix(text, ".")
+	return text != "" && text[0] >= '0' && text[0] <= '9'
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestReaderValues tests that atoms are classified into typed values
+func TestReaderValues(t *testing.T) {
+	tests := []struct {
+		input string
+		kind  ValueKind
+		check func(Value) bool
+	}{
+		{"name", ValueSymbol, func(v Value) bool { return v.Text == "name" }},
+		{":shape", ValueKeyword, func(v Value) bool { return v.Text == "shape" }},
+		{`"text"`, ValueString, func(v Value) bool { return v.Text == "text" }},
+		{"42", ValueInt, func(v Value) bool { return v.Int == 42 && v.Text == "42" }},
+		{"-10", ValueInt, func(v Value) bool { return v.Int == -10 }},
+		{"1.5", ValueFloat, func(v Value) bool { return v.Float == 1.5 }},
+		{".25", ValueFloat, func(v Value) bool { return v.Float == 0.25 }},
+		{"1e3", ValueFloat, func(v Value) bool { return v.Float == 1000 }},
+		{"true", ValueBool, func(v Value) bool { return v.Bool }},
+		{"false", ValueBool, func(v Value) bool { return !v.Bool }},
+		{"12px", ValueSymbol, func(v Value) bool { return v.Text == "12px" }},
+		{"Inf", ValueSymbol, func(v Value) bool { return v.Text == "Inf" }},
+		{"-", ValueSymbol, func(v Value) bool { return v.Text == "-" }},
+		{`"42"`, ValueString, func(v Value) bool { return v.Text == "42" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			value, err := NewReader(NewLexer(tt.input)).Read()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if value.Kind != tt.kind {
+				t.Errorf("Expected kind %s, got %s", tt.kind, value.Kind)
+			}
+			if !tt.check(value) {
+				t.Errorf("Unexpected value %+v", value)
+			}
+		})
+	}
+}
+
+// TestReaderLists tests reading nested lists with positions
+func TestReaderLists(t *testing.T) {
+	reader := NewReader(NewLexer("(a (b 1) :k \"v\")\n(c)"))
+
+	values, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(values) != 2 {
+		t.Fatalf("Expected 2 values, got %d", len(values))
+	}
+
+	first := values[0]
+	if first.Kind != ValueList || len(first.List) != 4 {
+		t.Fatalf("Expected list of 4 elements, got %s", first)
+	}
+	if first.Head() != "a" {
+		t.Errorf("Expected head 'a', got '%s'", first.Head())
+	}
+	if first.List[1].Head() != "b" || first.List[1].List[1].Int != 1 {
+		t.Errorf("Unexpected nested list %s", first.List[1])
+	}
+	if first.Span.Start.Column != 1 || first.Span.End.Column != 17 {
+		t.Errorf("Expected list span 1-17, got %d-%d", first.Span.Start.Column, first.Span.End.Column)
+	}
+	if close := first.CloseSpan(); close.Start.Column != 16 {
+		t.Errorf("Expected closing paren at column 16, got %d", close.Start.Column)
+	}
+	if values[1].Span.Start.Line != 2 {
+		t.Errorf("Expected second value on line 2, got %d", values[1].Span.Start.Line)
+	}
+
+	if _, err := reader.Read(); err != io.EOF {
+		t.Errorf("Expected io.EOF after last value, got %v", err)
+	}
+}
+
+// TestReaderErrors tests malformed input
+func TestReaderErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"unclosed list", "(a (b c)", "<input>:1:1: unclosed '('"},
+		{"unclosed nested list", "(a\n  (b c)\n  (d", "<input>:3:3: unclosed '('"},
+		{"unexpected close", ")", "<input>:1:1: unexpected ')'"},
+		{"lexical error", `(a "\q")`, "<input>:1:5: invalid escape sequence"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewReader(NewLexer(tt.input)).ReadAll()
+			if err == nil {
+				t.Fatalf("Expected error")
+			}
+			if !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error containing '%s', got: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+// TestValueString tests rendering values back to source
+func TestValueString(t *testing.T) {
+	input := `(diagram (size 800 400) (id "A \"quoted\"\nnext" :flag true :w 1.50) ())`
+
+	value, err := NewReader(NewLexer(input)).Read()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if value.String() != input {
+		t.Errorf("Expected %s, got %s", input, value.String())
+	}
+
+	reread, err := NewReader(NewLexer(value.String())).Read()
+	if err != nil {
+		t.Fatalf("Unexpected error rereading: %v", err)
+	}
+	if reread.String() != value.String() {
+		t.Errorf("Round trip changed value: %s", reread.String())
+	}
+
+	if got := quoteString("tab\there\u0001"); got != `"tab\there\u{1}"` {
+		t.Errorf("Unexpected quoted string %s", got)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"sort"
+)
+
+// Serialize writes a diagram as .sxd source that parses back to the same
+// diagram, apart from source locations. The output is deterministic:
+// attributes are sorted by name and everything else keeps the order of
+// the diagram, laid out as by Format.
+//
+// Nodes are written inside the groups they belong to, so the order of
+// Diagram.Nodes is kept as long as the members of each group are adjacent,
+// as they are in parsed diagrams. Edges are written after all nodes.
+// Nodes created by AddImplicitNodes are left out when the implicit-nodes
+// option will create them again.
+func Serialize(d *Diagram) []byte {
+	form := listValue(symbolValue("diagram"))
+	if d.Name != "" {
+		form.List = append(form.List, stringValue(d.Name))
+	}
+	form.List = append(form.List, listValue(symbolValue("size"), intValue(int64(d.Width), Span{}), intValue(int64(d.Height), Span{})))
+	if d.LayoutDirection != "" {
+		form.List = append(form.List, listValue(symbolValue("layout-direction"), stringValue(d.LayoutDirection)))
+	}
+	if d.Title != "" {
+		title := listValue(symbolValue("title"), stringValue(d.Title))
+		if d.TitlePosition != "" {
+			title.List = append(title.List, keywordValue("position"), stringValue(d.TitlePosition))
+		}
+		form.List = append(form.List, title)
+	}
+	if d.Description != "" {
+		form.List = append(form.List, listValue(symbolValue("description"), stringValue(d.Description)))
+	}
+	if len(d.Meta) > 0 {
+		form.List = append(form.List, styleForm("meta", d.Meta))
+	}
+	if options := serializeOptions(d.Options); options != nil {
+		form.List = append(form.List, *options)
+	}
+	if len(d.NodeStyle) > 0 {
+		form.List = append(form.List, styleForm("node-style", d.NodeStyle))
+	}
+	if len(d.EdgeStyle) > 0 {
+		form.List = append(form.List, styleForm("edge-style", d.EdgeStyle))
+	}
+	for _, class := range d.Classes {
+		defclass := listValue(symbolValue("defclass"), stringValue(class.Name))
+		defclass.List = append(defclass.List, attributeValues(class.Attributes, class.Values)...)
+		form.List = append(form.List, defclass)
+	}
+	for _, profile := range d.Profiles {
+		form.List = append(form.List, profileForm(profile))
+	}
+	if !d.Lint.IsZero() {
+		form.List = append(form.List, lintForm(d.Lint))
+	}
+	if len(d.Assertions) > 0 {
+		form.List = append(form.List, assertForm(d.Assertions))
+	}
+
+	var nodes []Node
+	for _, node := range d.Nodes {
+		if !(node.Implicit && d.Options.ImplicitNodes) {
+			nodes = append(nodes, node)
+		}
+	}
+	form.List = append(form.List, nodeForms(nodes, d.Groups)...)
+
+	if len(d.Edges) > 0 {
+		edges := listValue(symbolValue("edges"))
+		for _, edge := range d.Edges {
+			edges.List = append(edges.List, edgeForm(edge))
+		}
+		form.List = append(form.List, edges)
+	}
+
+	output, err := Format("", []byte(form.String()), FormatOptions{})
+	if err != nil {
+		// Values built here always read back; keep the unformatted text
+		// should an attribute name not
+		return []byte(form.String() + "\n")
+	}
+	return output
+}
+
+// serializeOptions returns the (options ...) form for settings that differ
+// from the defaults, or nil if there are none
+func serializeOptions(options Options) *Value {
+	form := listValue(symbolValue("options"))
+	if options.ImplicitNodes {
+		form.List = append(form.List, keywordValue("implicit-nodes"), boolValue(true, Span{}))
+	}
+	if options.Undirected {
+		form.List = append(form.List, keywordValue("directed"), boolValue(false, Span{}))
+	}
+	if len(form.List) == 1 {
+		return nil
+	}
+	return &form
+}
+
+func styleForm(head string, style map[string]string) Value {
+	return listValue(append([]Value{symbolValue(head)}, attributeValues(style, nil)...)...)
+}
+
+func profileForm(profile Profile) Value {
+	form := listValue(symbolValue("profile"), stringValue(profile.Name))
+	if len(profile.IncludeTags) > 0 {
+		form.List = append(form.List, keywordValue("include-tags"), stringList(profile.IncludeTags))
+	}
+	if len(profile.ExcludeTags) > 0 {
+		form.List = append(form.List, keywordValue("exclude-tags"), stringList(profile.ExcludeTags))
+	}
+	if len(profile.Defines) > 0 {
+		keys := make([]string, 0, len(profile.Defines))
+		for key := range profile.Defines {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		defines := make([]string, len(keys))
+		for i, key := range keys {
+			defines[i] = key + "=" + profile.Defines[key]
+		}
+		form.List = append(form.List, keywordValue("define"), stringList(defines))
+	}
+	return form
+}
+
+// lintForm writes a lint configuration, listing rules in the order of
+// lintRules
+func lintForm(config LintConfig) Value {
+	names := make(map[string][]string)
+	for _, rule := range lintRules {
+		name := rule.Code.Name
+		if enabled, ok := config.Enabled[name]; ok && enabled {
+			names["enable"] = append(names["enable"], name)
+		} else if ok {
+			names["disable"] = append(names["disable"], name)
+		}
+		if severity, ok := config.Severity[name]; ok {
+			names[severity.String()] = append(names[severity.String()], name)
+		}
+	}
+
+	form := listValue(symbolValue("lint"))
+	for _, key := range []string{"enable", "disable", "error", "warning", "info"} {
+		if len(names[key]) > 0 {
+			form.List = append(form.List, keywordValue(key), stringList(names[key]))
+		}
+	}
+	if config.MaxLabelLength != 0 {
+		form.List = append(form.List, keywordValue("max-label-length"), intValue(int64(config.MaxLabelLength), Span{}))
+	}
+	return form
+}
+
+// assertForm writes the assertions of a diagram as a single form
+func assertForm(assertions []Assertion) Value {
+	form := listValue(symbolValue("assert"))
+	for _, a := range assertions {
+		form.List = append(form.List, keywordValue(a.Name))
+		switch assertionArguments[a.Name] {
+		case "limit":
+			form.List = append(form.List, intValue(int64(a.Limit), Span{}))
+		case "node":
+			form.List = append(form.List, stringValue(a.Node))
+		}
+	}
+	return form
+}
+
+// nodeForms writes nodes, placing each group where its first member
+// appears and empty groups before the groups that follow them. Nodes that
+// belong to none of the groups are collected into (nodes ...) forms
+// between them.
+func nodeForms(nodes []Node, groups []Group) []Value {
+	owner := make(map[string]int)
+	for i, group := range groups {
+		for _, id := range group.Members() {
+			owner[id] = i
+		}
+	}
+
+	var forms []Value
+	var pending []Value
+	written := 0
+	writeGroups := func(upTo int) {
+		if len(pending) > 0 {
+			forms = append(forms, listValue(append([]Value{symbolValue("nodes")}, pending...)...))
+			pending = nil
+		}
+		for ; written <= upTo && written < len(groups); written++ {
+			forms = append(forms, groupForm(groups[written], nodes))
+		}
+	}
+
+	for _, node := range nodes {
+		if i, grouped := owner[node.ID]; !grouped {
+			pending = append(pending, nodeForm(node))
+		} else if i >= written {
+			writeGroups(i)
+		}
+	}
+	writeGroups(len(groups))
+	return forms
+}
+
+// groupForm writes a group with its members, taken from nodes in order
+func groupForm(group Group, nodes []Node) Value {
+	form := listValue(symbolValue("group"), stringValue(group.ID))
+	if group.Label != group.ID {
+		form.List = append(form.List, keywordValue("label"), stringValue(group.Label))
+	}
+	form.List = append(form.List, attributeValues(group.Attributes, group.Values)...)
+
+	members := make(map[string]bool)
+	for _, id := range group.Members() {
+		members[id] = true
+	}
+	var inside []Node
+	for _, node := range nodes {
+		if members[node.ID] {
+			inside = append(inside, node)
+		}
+	}
+	form.List = append(form.List, nodeForms(inside, group.Groups)...)
+	return form
+}
+
+func nodeForm(node Node) Value {
+	form := listValue(symbolValue("id"), stringValue(node.ID))
+	if node.Label != node.ID {
+		form.List = append(form.List, keywordValue("label"), stringValue(node.Label))
+	}
+	if len(node.Classes) > 0 {
+		form.List = append(form.List, keywordValue("class"), classValue(node.Classes))
+	}
+	form.List = append(form.List, attributeValues(node.Attributes, node.Values)...)
+	return form
+}
+
+func edgeForm(edge Edge) Value {
+	form := listValue(stringValue(edge.From), stringValue(edge.To))
+	if edge.Label != "" {
+		form.List = append(form.List, keywordValue("label"), stringValue(edge.Label))
+	}
+	if len(edge.Classes) > 0 {
+		form.List = append(form.List, keywordValue("class"), classValue(edge.Classes))
+	}
+	if edge.FromPort != "" {
+		form.List = append(form.List, keywordValue("from-port"), stringValue(edge.FromPort))
+	}
+	if edge.ToPort != "" {
+		form.List = append(form.List, keywordValue("to-port"), stringValue(edge.ToPort))
+	}
+	form.List = append(form.List, attributeValues(edge.Attributes, edge.Values)...)
+	return form
+}
+
+// attributeValues returns :key value pairs sorted by key, using the typed
+// value where there is one and the text otherwise
+func attributeValues(attrs map[string]string, values map[string]Value) []Value {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []Value
+	for _, key := range keys {
+		value, ok := values[key]
+		if !ok {
+			value = stringValue(attrs[key])
+		}
+		pairs = append(pairs, keywordValue(key), value)
+	}
+	return pairs
+}
+
+// classValue writes a single class as a string and several as a list
+func classValue(classes []string) Value {
+	if len(classes) == 1 {
+		return stringValue(classes[0])
+	}
+	return stringList(classes)
+}
+
+func stringList(texts []string) Value {
+	items := make([]Value, len(texts))
+	for i, text := range texts {
+		items[i] = stringValue(text)
+	}
+	return listValue(items...)
+}
+
+func listValue(items ...Value) Value {
+	return Value{Kind: ValueList, List: items}
+}
+
+func symbolValue(name string) Value {
+	return Value{Kind: ValueSymbol, Text: name}
+}
+
+func keywordValue(name string) Value {
+	return Value{Kind: ValueKeyword, Text: name}
+}
+
+func stringValue(text string) Value {
+	return Value{Kind: ValueString, Text: text}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// stripLocations removes every source location from a diagram, including
+// those of typed attribute values
+func stripLocations(d *Diagram) {
+	stripValue := func(values map[string]Value) {
+		for key, value := range values {
+			values[key] = valueWithoutSpans(value)
+		}
+	}
+	var stripGroups func([]Group)
+	stripGroups = func(groups []Group) {
+		for i := range groups {
+			groups[i].Span = Span{}
+			groups[i].AttrSpans = nil
+			stripValue(groups[i].Values)
+			stripGroups(groups[i].Groups)
+		}
+	}
+
+	d.NodeStyleSpans = nil
+	d.EdgeStyleSpans = nil
+	for i := range d.Nodes {
+		d.Nodes[i].Span = Span{}
+		d.Nodes[i].AttrSpans = nil
+		stripValue(d.Nodes[i].Values)
+	}
+	for i := range d.Edges {
+		d.Edges[i].Span = Span{}
+		d.Edges[i].AttrSpans = nil
+		stripValue(d.Edges[i].Values)
+	}
+	for i := range d.Classes {
+		d.Classes[i].Span = Span{}
+		d.Classes[i].AttrSpans = nil
+		stripValue(d.Classes[i].Values)
+	}
+	for i := range d.Profiles {
+		d.Profiles[i].Span = Span{}
+	}
+	for i := range d.Assertions {
+		d.Assertions[i].Span = Span{}
+	}
+	stripGroups(d.Groups)
+}
+
+func valueWithoutSpans(v Value) Value {
+	v.Span = Span{}
+	if v.List != nil {
+		items := make([]Value, len(v.List))
+		for i, item := range v.List {
+			items[i] = valueWithoutSpans(item)
+		}
+		v.List = items
+	}
+	return v
+}
+
+// assertRoundTrip checks that serializing the diagram parsed from src and
+// parsing the result gives the same diagram, and returns the serialized text
+func assertRoundTrip(t *testing.T, name, src string) string {
+	t.Helper()
+
+	original, err := NewParser(NewFileLexer(name, src)).ParseDiagram()
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	text := Serialize(original)
+
+	parsed, err := NewParser(NewFileLexer("serialized.sxd", string(text))).ParseDiagram()
+	if err != nil {
+		t.Fatalf("Serialized diagram does not parse: %v\n%s", err, text)
+	}
+
+	stripLocations(original)
+	stripLocations(parsed)
+	if !reflect.DeepEqual(original, parsed) {
+		t.Errorf("Round trip changed the diagram.\nexpected: %+v\ngot:      %+v\nsource:\n%s", original, parsed, text)
+	}
+	if again := Serialize(parsed); string(again) != string(text) {
+		t.Errorf("Serialization is not deterministic:\n%s\n%s", text, again)
+	}
+	return string(text)
+}
+
+// TestSerialize tests the text written for a diagram
+func TestSerialize(t *testing.T) {
+	input := `(diagram
+  (size 640 480)
+  (layout-direction left-to-right)
+  (options :directed false :implicit-nodes true)
+  (node-style :shape "rect" :fill "#fff")
+  (defclass "db" :shape "ellipse" :stroke-width 2px)
+  (nodes (id "app" :label "App" :weight 1.5 :tags ("web" "critical")))
+  (group "data" :label "Data tier"
+    (nodes (id "db" :class ("db" "primary") :ports ("read" "write"))))
+  (edges
+    ("app" "db:write" :label "" :dir both)))`
+
+	expected := `(diagram
+  (size 640 480)
+  (layout-direction "left-to-right")
+  (options :implicit-nodes true :directed false)
+  (node-style :fill "#fff" :shape "rect")
+  (defclass "db" :shape "ellipse" :stroke-width 2px)
+  (nodes
+    (id "app" :label "App" :tags ("web" "critical") :weight 1.5))
+  (group "data" :label "Data tier"
+    (nodes
+      (id "db" :class ("db" "primary") :ports ("read" "write"))))
+  (edges
+    ("app" "db" :to-port "write" :dir both)))
+`
+
+	if text := assertRoundTrip(t, "<input>", input); text != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, text)
+	}
+}
+
+// TestSerializeRoundTrip tests Parse(Serialize(d)) == d for diagrams using
+// every directive
+func TestSerializeRoundTrip(t *testing.T) {
+	tests := map[string]string{
+		"empty": `(diagram)`,
+		"labels": `(diagram
+  (nodes (id "A" :label "") (id "B" :label "Line\nbreak \"quoted\""))
+  (edges ("A" "B" :label "x")))`,
+		"multi-line labels": `(diagram
+  (nodes (id "A" :label "  Total:\n  42") (id "B" :label "first\n  second\n") (id "C" :label " 0\n"))
+  (edges ("A" "B" :label "x\ty\r\nz") ("B" "C" :label "one  \r\ntwo")))`,
+		"nested groups": `(diagram
+  (nodes (id "before"))
+  (group "empty")
+  (group "outer" :stroke "#333"
+    (nodes (id "a"))
+    (group "inner" (nodes (id "b") (id "c")))
+    (nodes (id "d"))
+    (edges ("a" "b")))
+  (nodes (id "after"))
+  (edges ("before" "outer") ("d" "after" :class "x")))`,
+		"named": `(diagram "overview"
+  (nodes (id "a")))`,
+		"metadata": `(diagram
+  (title "Checkout" :position "bottom")
+  (description "How an order is paid")
+  (meta :author "Jane Doe" :version 2))`,
+		"profiles": `(diagram
+  (profile "public" :exclude-tags ("internal" "debug") :define ("audience=public" "beta=false"))
+  (profile "ops" :include-tags "ops")
+  (nodes (id "a" :tags ("internal") :when "!beta")))`,
+		"lint": `(diagram
+  (lint :disable ("cycle" "self-loop") :enable "long-label" :error ("unused-class") :max-label-length 30)
+  (nodes (id "a")))`,
+		"assertions": `(diagram
+  (assert :acyclic :max-depth 6 :single-root)
+  (assert :reaches "done" :max-out-degree 2)
+  (nodes (id "a") (id "done"))
+  (edges ("a" "done")))`,
+		"edge ports": `(diagram
+  (nodes (id "a") (id "b"))
+  (edges ("a:ne" "b" :to-port "s" :style "dashed")))`,
+	}
+
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			assertRoundTrip(t, "<input>", input)
+		})
+	}
+}
+
+// TestSerializeExamples tests round trips of the example diagrams
+func TestSerializeExamples(t *testing.T) {
+	files, _ := filepath.Glob("examples/*.sxd")
+	files = append(files, "sample.sxd")
+
+	for _, file := range files {
+		t.Run(file, func(t *testing.T) {
+			src, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", file, err)
+			}
+			assertRoundTrip(t, file, string(src))
+		})
+	}
+}
+
+// TestSerializeBuiltDiagram tests serializing a diagram built in Go
+func TestSerializeBuiltDiagram(t *testing.T) {
+	diagram := NewDiagram()
+	diagram.Nodes = append(diagram.Nodes,
+		Node{ID: "A", Label: "Start", Attributes: map[string]string{"shape": "ellipse"}},
+		Node{ID: "B", Label: "B"},
+	)
+	diagram.Edges = append(diagram.Edges, Edge{From: "A", To: "B", Attributes: map[string]string{"style": "dashed"}})
+
+	expected := `(diagram
+  (size 800 400)
+  (layout-direction "top-to-bottom")
+  (nodes
+    (id "A" :label "Start" :shape "ellipse")
+    (id "B"))
+  (edges
+    ("A" "B" :style "dashed")))
+`
+	if text := string(Serialize(diagram)); text != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, text)
+	}
+}
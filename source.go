@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Source holds the text of an input file so errors can quote it
+type Source struct {
+	Name string
+	Text string
+}
+
+// NewSource creates a source for the given file name and text
+func NewSource(name, text string) *Source {
+	return &Source{Name: name, Text: text}
+}
+
+// Line returns the text of the given 1-based line without its terminator
+func (s *Source) Line(n int) string {
+	if s == nil || n < 1 {
+		return ""
+	}
+	text := s.Text
+	for i := 1; i < n; i++ {
+		idx := strings.IndexByte(text, '\n')
+		if idx < 0 {
+			return ""
+		}
+		text = text[idx+1:]
+	}
+	if idx := strings.IndexByte(text, '\n'); idx >= 0 {
+		text = text[:idx]
+	}
+	return strings.TrimSuffix(text, "\r")
+}
+
+// Pos represents a position in a source file
+type Pos struct {
+	Source *Source
+	Offset int
+	Line   int
+	Column int
+}
+
+// IsValid reports whether the position refers to a source location
+func (p Pos) IsValid() bool {
+	return p.Line > 0
+}
+
+// Filename returns the name of the source file
+func (p Pos) Filename() string {
+	if p.Source == nil || p.Source.Name == "" {
+		return "<input>"
+	}
+	return p.Source.Name
+}
+
+func (p Pos) String() string {
+	if !p.IsValid() {
+		return p.Filename()
+	}
+	return fmt.Sprintf("%s:%d:%d", p.Filename(), p.Line, p.Column)
+}
+
+// Span represents a range of source text
+type Span struct {
+	Start Pos
+	End   Pos
+}
+
+// IsValid reports whether the span refers to a source location
+func (s Span) IsValid() bool {
+	return s.Start.IsValid()
+}
+
+func (s Span) String() string {
+	return s.Start.String()
+}
+
+// SourceError is an error tied to a location in the source. Code
+// classifies it for Diagnostic; most errors leave it unset.
+type SourceError struct {
+	Span    Span
+	Message string
+	Code    DiagnosticCode
+}
+
+func (e *SourceError) Error() string {
+	return formatSourceMessage(e.Span, e.Message)
+}
+
+// newSourceError creates a SourceError at the given span
+func newSourceError(span Span, format string, args ...interface{}) *SourceError {
+	return &SourceError{
+		Span:    span,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// formatSourceMessage renders a message as file:line:col followed by the
+// offending source line and a caret under the reported column
+func formatSourceMessage(span Span, message string) string {
+	if !span.IsValid() {
+		return message
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s: %s", span.Start, message))
+
+	line := span.Start.Source.Line(span.Start.Line)
+	if line == "" {
+		return sb.String()
+	}
+
+	sb.WriteString("\n    ")
+	sb.WriteString(line)
+	sb.WriteString("\n    ")
+	sb.WriteString(caretPadding(line, span.Start.Column))
+	sb.WriteString("^")
+	return sb.String()
+}
+
+// caretPadding returns whitespace that lines up with the given 1-based
+// column of line, keeping tabs so the caret aligns in terminals
+func caretPadding(line string, column int) string {
+	var sb strings.Builder
+	col := 1
+	for _, r := range line {
+		if col >= column {
+			break
+		}
+		if r == '\t' {
+			sb.WriteByte('\t')
+		} else {
+			sb.WriteByte(' ')
+		}
+		col++
+	}
+	for ; col < column; col++ {
+		sb.WriteByte(' ')
+	}
+	return sb.String()
+}
+
+// ErrorList collects source errors so all of them can be reported at once
+type ErrorList []*SourceError
+
+// Add appends err to the list, flattening nested lists
+func (l *ErrorList) Add(err error) {
+	switch e := err.(type) {
+	case nil:
+	case ErrorList:
+		*l = append(*l, e...)
+	case *SourceError:
+		*l = append(*l, e)
+	default:
+		*l = append(*l, &SourceError{Message: err.Error()})
+	}
+}
+
+// Sort orders the errors by file and position
+func (l ErrorList) Sort() {
+	sort.SliceStable(l, func(i, j int) bool {
+		a, b := l[i].Span.Start, l[j].Span.Start
+		if a.Filename() != b.Filename() {
+			return a.Filename() < b.Filename()
+		}
+		return a.Offset < b.Offset
+	})
+}
+
+// Err returns the list as an error, or nil if it is empty
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+
+	messages := make([]string, len(l))
+	for i, err := range l {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d errors:\n%s", len(l), strings.Join(messages, "\n"))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestSourceLine tests line lookup in source text
+func TestSourceLine(t *testing.T) {
+	source := NewSource("test.sxd", "first\nsecond\r\nthird")
+
+	tests := []struct {
+		line     int
+		expected string
+	}{
+		{1, "first"},
+		{2, "second"},
+		{3, "third"},
+		{4, ""},
+		{0, ""},
+	}
+
+	for _, tt := range tests {
+		if got := source.Line(tt.line); got != tt.expected {
+			t.Errorf("Line(%d): expected '%s', got '%s'", tt.line, tt.expected, got)
+		}
+	}
+}
+
+// TestPosString tests position formatting
+func TestPosString(t *testing.T) {
+	pos := Pos{Source: NewSource("flow.sxd", ""), Line: 3, Column: 7}
+	if pos.String() != "flow.sxd:3:7" {
+		t.Errorf("Expected 'flow.sxd:3:7', got '%s'", pos.String())
+	}
+
+	unnamed := Pos{Source: NewSource("", ""), Line: 1, Column: 1}
+	if unnamed.String() != "<input>:1:1" {
+		t.Errorf("Expected '<input>:1:1', got '%s'", unnamed.String())
+	}
+
+	if (Pos{}).IsValid() {
+		t.Errorf("Zero position should not be valid")
+	}
+}
+
+// TestFormatSourceMessage tests rendering of located messages
+func TestFormatSourceMessage(t *testing.T) {
+	source := NewSource("flow.sxd", "(diagram\n\t(nodes (id \"A\" foo)))")
+	span := Span{Start: Pos{Source: source, Line: 2, Column: 15}}
+
+	got := formatSourceMessage(span, "expected keyword, got foo")
+	expected := "flow.sxd:2:15: expected keyword, got foo\n" +
+		"    \t(nodes (id \"A\" foo)))\n" +
+		"    \t             ^"
+	if got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	if got := formatSourceMessage(Span{}, "plain"); got != "plain" {
+		t.Errorf("Expected message without location to be unchanged, got '%s'", got)
+	}
+}
+
+// TestSourceErrorLocation tests that parse errors point at the offending token
+func TestSourceErrorLocation(t *testing.T) {
+	input := "(diagram\n  (nodes\n    (id \"A\" label \"x\")))"
+	parser := NewParser(NewFileLexer("bad.sxd", input))
+
+	_, err := parser.ParseDiagram()
+	if err == nil {
+		t.Fatalf("Expected parse error")
+	}
+
+	errors, ok := err.(ErrorList)
+	if !ok || len(errors) != 1 {
+		t.Fatalf("Expected ErrorList with one error, got %T: %v", err, err)
+	}
+	sourceErr := errors[0]
+	if sourceErr.Span.Start.Line != 3 || sourceErr.Span.Start.Column != 13 {
+		t.Errorf("Expected error at 3:13, got %s", sourceErr.Span)
+	}
+	if !strings.HasPrefix(err.Error(), "bad.sxd:3:13: expected keyword, got label") {
+		t.Errorf("Unexpected error message: %v", err)
+	}
+	if !strings.Contains(err.Error(), "(id \"A\" label \"x\")))\n                ^") {
+		t.Errorf("Expected caret under offending token, got:\n%v", err)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -20,7 +21,8 @@ func (s *SVGGenerator) Generate(layout *Layout, diagram *Diagram) string {
 	// Calculate viewBox with some padding
 	padding := 20.0
 	viewWidth := layout.Width + padding*2
-	viewHeight := layout.Height + padding*2
+	band := titleBand(diagram)
+	viewHeight := layout.Height + padding*2 + band
 
 	// SVG header
 	sb.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
@@ -29,16 +31,31 @@ func (s *SVGGenerator) Generate(layout *Layout, diagram *Diagram) string {
 		viewWidth, viewHeight, viewWidth, viewHeight))
 	sb.WriteString("\n")
 
+	// Title, description and document metadata
+	sb.WriteString(s.generateMetadata(diagram))
+
 	// Add CSS styles
 	sb.WriteString(s.generateCSS())
 
 	// Create definitions for arrowheads
 	sb.WriteString(s.generateDefs())
 
+	// Visible title above or below the drawing
+	sb.WriteString(s.generateTitle(diagram, viewWidth, padding+layout.Height, padding))
+	bottom := viewHeight - padding
+	if band > 0 && diagram.TitlePosition == "bottom" {
+		bottom -= band
+	}
+
 	// Transform coordinate system (Graphviz uses bottom-left origin, SVG uses top-left)
-	sb.WriteString(fmt.Sprintf(`<g transform="translate(%.0f, %.0f) scale(1, -1)">`, padding, viewHeight-padding))
+	sb.WriteString(fmt.Sprintf(`<g transform="translate(%.0f, %.0f) scale(1, -1)">`, padding, bottom))
 	sb.WriteString("\n")
 
+	// Generate group boxes behind everything else
+	for _, group := range layout.Groups {
+		sb.WriteString(s.generateGroup(group))
+	}
+
 	// Generate edges first (so they appear behind nodes)
 	for _, edge := range layout.Edges {
 		sb.WriteString(s.generateEdge(edge))
@@ -104,6 +121,30 @@ func (s *SVGGenerator) generateCSS() string {
       fill: #000000;
       pointer-events: none;
     }
+    .group {
+      fill: #f8f8f8;
+      fill-opacity: 0.6;
+      stroke: #999999;
+      stroke-width: 1;
+      stroke-dasharray: 4 2;
+    }
+    .group-label {
+      font-family: Arial, sans-serif;
+      font-size: 11px;
+      font-weight: bold;
+      text-anchor: start;
+      dominant-baseline: hanging;
+      fill: #555555;
+      pointer-events: none;
+    }
+    .diagram-title {
+      font-family: Arial, sans-serif;
+      font-size: 16px;
+      font-weight: bold;
+      text-anchor: middle;
+      dominant-baseline: middle;
+      fill: #000000;
+    }
   </style>
 `
 }
@@ -116,24 +157,137 @@ func (s *SVGGenerator) generateDefs() string {
             refX="9" refY="3.5" orient="auto">
       <polygon points="0 0, 10 3.5, 0 7" fill="#000000"/>
     </marker>
+    <marker id="arrowhead-start" markerWidth="10" markerHeight="7" 
+            refX="1" refY="3.5" orient="auto">
+      <polygon points="10 0, 0 3.5, 10 7" fill="#000000"/>
+    </marker>
   </defs>
 `
 }
 
+// titleBandHeight is the height of the band showing a visible title
+const titleBandHeight = 30.0
+
+// titleBand returns the height the visible title of diagram adds to the
+// picture
+func titleBand(diagram *Diagram) float64 {
+	if diagram == nil || diagram.Title == "" || diagram.TitlePosition == "" {
+		return 0
+	}
+	return titleBandHeight
+}
+
+// generateTitle generates the visible title, centred in its band above or
+// below a drawing of the given width whose top edge is at y=top and
+// bottom edge at y=bottom, both measured from the top of the picture
+func (s *SVGGenerator) generateTitle(diagram *Diagram, width, bottom, top float64) string {
+	band := titleBand(diagram)
+	if band == 0 {
+		return ""
+	}
+	y := top + band/2
+	if diagram.TitlePosition == "bottom" {
+		y = bottom + band/2
+	}
+	return fmt.Sprintf(`  <text x="%.2f" y="%.2f" class="diagram-title">%s</text>`+"\n",
+		width/2, y, s.escapeXML(diagram.Title))
+}
+
+// metaElements maps the keys of (meta ...) to the RDF elements they are
+// written as in the SVG metadata
+var metaElements = map[string]string{
+	"author":      "dc:creator",
+	"contributor": "dc:contributor",
+	"publisher":   "dc:publisher",
+	"date":        "dc:date",
+	"license":     "dc:rights",
+	"language":    "dc:language",
+	"keywords":    "dc:subject",
+	"source":      "dc:source",
+	"identifier":  "dc:identifier",
+	"version":     "owl:versionInfo",
+}
+
+// generateMetadata generates the <title> and <desc> elements and an RDF
+// <metadata> block with the Dublin Core description of the diagram
+func (s *SVGGenerator) generateMetadata(diagram *Diagram) string {
+	if diagram == nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	var elements []string
+	if diagram.Title != "" {
+		sb.WriteString(fmt.Sprintf("  <title>%s</title>\n", s.escapeXML(diagram.Title)))
+		elements = append(elements, s.rdfElement("dc:title", diagram.Title))
+	}
+	if diagram.Description != "" {
+		sb.WriteString(fmt.Sprintf("  <desc>%s</desc>\n", s.escapeXML(diagram.Description)))
+		elements = append(elements, s.rdfElement("dc:description", diagram.Description))
+	}
+
+	var keys []string
+	for key := range diagram.Meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if element, ok := metaElements[key]; ok {
+			elements = append(elements, s.rdfElement(element, diagram.Meta[key]))
+		}
+	}
+
+	if len(elements) == 0 {
+		return sb.String()
+	}
+	sb.WriteString("  <metadata>\n")
+	sb.WriteString(`    <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:owl="http://www.w3.org/2002/07/owl#">`)
+	sb.WriteString("\n")
+	sb.WriteString(`      <rdf:Description rdf:about="">`)
+	sb.WriteString("\n")
+	for _, element := range elements {
+		sb.WriteString(element)
+	}
+	sb.WriteString("      </rdf:Description>\n")
+	sb.WriteString("    </rdf:RDF>\n")
+	sb.WriteString("  </metadata>\n")
+	return sb.String()
+}
+
+func (s *SVGGenerator) rdfElement(name, text string) string {
+	return fmt.Sprintf("        <%s>%s</%s>\n", name, s.escapeXML(text), name)
+}
+
+// edgeMarkers returns the marker attributes drawing the arrowheads of an
+// edge with direction dir
+func edgeMarkers(dir EdgeDir) string {
+	switch dir {
+	case DirBack:
+		return ` marker-start="url(#arrowhead-start)"`
+	case DirBoth:
+		return ` marker-start="url(#arrowhead-start)" marker-end="url(#arrowhead)"`
+	case DirNone:
+		return ""
+	default:
+		return ` marker-end="url(#arrowhead)"`
+	}
+}
+
 // generateNode generates SVG for a single node
 func (s *SVGGenerator) generateNode(node LayoutNode) string {
 	var sb strings.Builder
 
 	shape := s.getNodeShape(node.Shape)
-	class := fmt.Sprintf("node %s", shape)
+	class := classList(fmt.Sprintf("node %s", shape), node.Classes)
+	shapeStyle, labelStyle := s.inlineStyles(node.Attributes, TargetNode)
 
 	switch shape {
 	case "rect":
-		sb.WriteString(fmt.Sprintf(`  <rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" class="%s"/>`,
-			node.X-node.Width/2, node.Y-node.Height/2, node.Width, node.Height, class))
+		sb.WriteString(fmt.Sprintf(`  <rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" class="%s"%s/>`,
+			node.X-node.Width/2, node.Y-node.Height/2, node.Width, node.Height, class, shapeStyle))
 	case "ellipse":
-		sb.WriteString(fmt.Sprintf(`  <ellipse cx="%.2f" cy="%.2f" rx="%.2f" ry="%.2f" class="%s"/>`,
-			node.X, node.Y, node.Width/2, node.Height/2, class))
+		sb.WriteString(fmt.Sprintf(`  <ellipse cx="%.2f" cy="%.2f" rx="%.2f" ry="%.2f" class="%s"%s/>`,
+			node.X, node.Y, node.Width/2, node.Height/2, class, shapeStyle))
 	case "diamond":
 		// Create diamond shape using polygon
 		points := fmt.Sprintf("%.2f,%.2f %.2f,%.2f %.2f,%.2f %.2f,%.2f",
@@ -141,24 +295,57 @@ func (s *SVGGenerator) generateNode(node LayoutNode) string {
 			node.X+node.Width/2, node.Y, // right
 			node.X, node.Y+node.Height/2, // bottom
 			node.X-node.Width/2, node.Y) // left
-		sb.WriteString(fmt.Sprintf(`  <polygon points="%s" class="%s"/>`, points, class))
+		sb.WriteString(fmt.Sprintf(`  <polygon points="%s" class="%s"%s/>`, points, class, shapeStyle))
 	default:
 		// Default to ellipse
-		sb.WriteString(fmt.Sprintf(`  <ellipse cx="%.2f" cy="%.2f" rx="%.2f" ry="%.2f" class="%s"/>`,
-			node.X, node.Y, node.Width/2, node.Height/2, class))
+		sb.WriteString(fmt.Sprintf(`  <ellipse cx="%.2f" cy="%.2f" rx="%.2f" ry="%.2f" class="%s"%s/>`,
+			node.X, node.Y, node.Width/2, node.Height/2, class, shapeStyle))
 	}
 	sb.WriteString("\n")
 
 	// Add label (flip Y coordinate back for text)
 	if node.Label != "" {
-		sb.WriteString(fmt.Sprintf(`  <text x="%.2f" y="%.2f" class="node-label" transform="scale(1, -1)">%s</text>`,
-			node.X, -node.Y, s.escapeXML(node.Label)))
+		sb.WriteString(s.generateText(node.X, -node.Y, "node-label", labelStyle, node.Label))
+	}
+
+	return sb.String()
+}
+
+// generateGroup generates the bounding box and label of a group
+func (s *SVGGenerator) generateGroup(group LayoutGroup) string {
+	var sb strings.Builder
+
+	left := group.X - group.Width/2
+	top := group.Y + group.Height/2
+	boxStyle, _ := s.inlineStyles(group.Attributes, TargetGroup)
+
+	sb.WriteString(fmt.Sprintf(`  <rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" rx="6" ry="6" class="group"%s/>`,
+		left, group.Y-group.Height/2, group.Width, group.Height, boxStyle))
+	sb.WriteString("\n")
+
+	if group.Label != "" {
+		sb.WriteString(fmt.Sprintf(`  <text x="%.2f" y="%.2f" class="group-label" transform="scale(1, -1)">%s</text>`,
+			left+8, -top+5, s.generateGroupLabel(group.Label)))
 		sb.WriteString("\n")
 	}
 
 	return sb.String()
 }
 
+// generateGroupLabel writes the text of a group label, which is drawn on
+// a single line
+func (s *SVGGenerator) generateGroupLabel(label string) string {
+	lines, _ := ParseLabel(label)
+	var runs []TextRun
+	for i, line := range lines {
+		if i > 0 {
+			runs = append(runs, TextRun{Text: " "})
+		}
+		runs = append(runs, line...)
+	}
+	return s.generateRuns(mergeRuns(runs))
+}
+
 // generateEdge generates SVG for a single edge
 func (s *SVGGenerator) generateEdge(edge LayoutEdge) string {
 	var sb strings.Builder
@@ -173,6 +360,10 @@ func (s *SVGGenerator) generateEdge(edge LayoutEdge) string {
 	if len(edge.Points) == 2 {
 		// Simple line
 		pathData += fmt.Sprintf(" L %.2f %.2f", edge.Points[1].X, edge.Points[1].Y)
+	} else if len(edge.Points) == 4 {
+		// Cubic curve, as routed to ports
+		pathData += fmt.Sprintf(" C %.2f %.2f, %.2f %.2f, %.2f %.2f",
+			edge.Points[1].X, edge.Points[1].Y, edge.Points[2].X, edge.Points[2].Y, edge.Points[3].X, edge.Points[3].Y)
 	} else {
 		// Bezier curve - use points as control points
 		for i := 1; i < len(edge.Points); i++ {
@@ -186,19 +377,113 @@ func (s *SVGGenerator) generateEdge(edge LayoutEdge) string {
 		}
 	}
 
-	sb.WriteString(fmt.Sprintf(`  <path d="%s" class="edge" marker-end="url(#arrowhead)"/>`, pathData))
+	lineStyle, labelStyle := s.inlineStyles(edge.Attributes, TargetEdge)
+	sb.WriteString(fmt.Sprintf(`  <path d="%s" class="%s"%s%s/>`, pathData, classList("edge", edge.Classes), lineStyle, edgeMarkers(edge.Dir)))
 	sb.WriteString("\n")
 
 	// Add edge label if present
 	if edge.Label != "" && edge.X != 0 && edge.Y != 0 {
-		sb.WriteString(fmt.Sprintf(`  <text x="%.2f" y="%.2f" class="edge-label" transform="scale(1, -1)">%s</text>`,
-			edge.X, -edge.Y, s.escapeXML(edge.Label)))
-		sb.WriteString("\n")
+		sb.WriteString(s.generateText(edge.X, -edge.Y, "edge-label", labelStyle, edge.Label))
 	}
 
 	return sb.String()
 }
 
+// classList appends the classes applied with :class to the built-in
+// classes of an element
+func classList(base string, classes []string) string {
+	if len(classes) == 0 {
+		return base
+	}
+	return base + " " + strings.Join(classes, " ")
+}
+
+// labelLineHeight is the distance between stacked label lines in em
+const labelLineHeight = 1.2
+
+// labelFontSizes gives the font size in px of each kind of label, as set
+// in the stylesheet
+var labelFontSizes = map[string]float64{
+	"node-label":  12,
+	"edge-label":  10,
+	"group-label": 11,
+}
+
+// labelFontSize returns the font size of labels drawn with class
+func labelFontSize(class string) float64 {
+	if size, ok := labelFontSizes[class]; ok {
+		return size
+	}
+	return labelFontSizes["node-label"]
+}
+
+// generateText generates a label centred on (x, y). Markup is written as
+// nested <tspan>s; multi-line labels get one <tspan> per line, shifted up
+// so the block stays centred. Lines holding larger text are given more
+// room.
+func (s *SVGGenerator) generateText(x, y float64, class, style, label string) string {
+	lines, _ := ParseLabel(label)
+	if len(lines) == 1 {
+		return fmt.Sprintf(`  <text x="%.2f" y="%.2f" class="%s"%s transform="scale(1, -1)">%s</text>`+"\n",
+			x, y, class, style, s.generateRuns(lines[0]))
+	}
+
+	// Line heights in em of the label's font size
+	base := labelFontSize(class)
+	heights := make([]float64, len(lines))
+	total := 0.0
+	for i, line := range lines {
+		heights[i] = labelLineHeight * lineSize(line, base) / base
+		total += heights[i]
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf(`  <text x="%.2f" y="%.2f" class="%s"%s transform="scale(1, -1)">`, x, y, class, style))
+	for i, line := range lines {
+		var dy float64
+		if i == 0 {
+			dy = -(total - heights[0]) / 2
+		} else {
+			dy = (heights[i-1] + heights[i]) / 2
+		}
+		sb.WriteString(fmt.Sprintf(`<tspan x="%.2f" dy="%.2fem">%s</tspan>`, x, dy, s.generateRuns(line)))
+	}
+	sb.WriteString("</text>\n")
+	return sb.String()
+}
+
+// generateRuns writes a line of label text, wrapping styled runs in
+// <tspan>s with the matching presentation attributes
+func (s *SVGGenerator) generateRuns(line []TextRun) string {
+	var sb strings.Builder
+	for _, run := range line {
+		text := s.escapeXML(run.Text)
+		if run.Style == (TextStyle{}) {
+			sb.WriteString(text)
+			continue
+		}
+
+		sb.WriteString("<tspan")
+		if run.Style.Bold {
+			sb.WriteString(` font-weight="bold"`)
+		}
+		if run.Style.Italic {
+			sb.WriteString(` font-style="italic"`)
+		}
+		if run.Style.Mono {
+			sb.WriteString(` font-family="monospace"`)
+		}
+		if run.Style.Size > 0 {
+			sb.WriteString(fmt.Sprintf(` font-size="%spx"`, strconv.FormatFloat(run.Style.Size, 'f', -1, 64)))
+		}
+		if run.Style.Color != "" {
+			sb.WriteString(fmt.Sprintf(` fill="%s"`, s.escapeXML(cssValue("color", run.Style.Color))))
+		}
+		sb.WriteString(">" + text + "</tspan>")
+	}
+	return sb.String()
+}
+
 // getNodeShape maps Graphviz shapes to SVG shapes
 func (s *SVGGenerator) getNodeShape(shape string) string {
 	switch strings.ToLower(shape) {
@@ -232,7 +517,8 @@ func (s *SVGGenerator) GenerateWithCustomStyles(layout *Layout, diagram *Diagram
 	// Calculate viewBox with some padding
 	padding := 20.0
 	viewWidth := layout.Width + padding*2
-	viewHeight := layout.Height + padding*2
+	band := titleBand(diagram)
+	viewHeight := layout.Height + padding*2 + band
 
 	// SVG header
 	sb.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
@@ -241,16 +527,31 @@ func (s *SVGGenerator) GenerateWithCustomStyles(layout *Layout, diagram *Diagram
 		viewWidth, viewHeight, viewWidth, viewHeight))
 	sb.WriteString("\n")
 
+	// Title, description and document metadata
+	sb.WriteString(s.generateMetadata(diagram))
+
 	// Add CSS styles with custom overrides
 	sb.WriteString(s.generateCustomCSS(diagram))
 
 	// Create definitions for arrowheads
 	sb.WriteString(s.generateDefs())
 
+	// Visible title above or below the drawing
+	sb.WriteString(s.generateTitle(diagram, viewWidth, padding+layout.Height, padding))
+	bottom := viewHeight - padding
+	if band > 0 && diagram.TitlePosition == "bottom" {
+		bottom -= band
+	}
+
 	// Transform coordinate system
-	sb.WriteString(fmt.Sprintf(`<g transform="translate(%.0f, %.0f) scale(1, -1)">`, padding, viewHeight-padding))
+	sb.WriteString(fmt.Sprintf(`<g transform="translate(%.0f, %.0f) scale(1, -1)">`, padding, bottom))
 	sb.WriteString("\n")
 
+	// Generate group boxes behind everything else
+	for _, group := range layout.Groups {
+		sb.WriteString(s.generateGroup(group))
+	}
+
 	// Generate edges first
 	for _, edge := range layout.Edges {
 		sb.WriteString(s.generateEdge(edge))
@@ -277,6 +578,108 @@ func (s *SVGGenerator) GenerateWithCustomStyles(layout *Layout, diagram *Diagram
 	return sb.String()
 }
 
+// lineStyles gives the declarations each edge :style is drawn with, on
+// the line and on its label
+var lineStyles = map[string]struct{ line, label []string }{
+	"solid":     {line: []string{"stroke-dasharray: none"}},
+	"dashed":    {line: []string{"stroke-dasharray: 5 5"}},
+	"dotted":    {line: []string{"stroke-dasharray: 2 2"}},
+	"bold":      {line: []string{"stroke-width: 3"}},
+	"invis":     {line: []string{"visibility: hidden"}, label: []string{"visibility: hidden"}},
+	"invisible": {line: []string{"visibility: hidden"}, label: []string{"visibility: hidden"}},
+}
+
+// styleDeclarations returns the CSS declarations for the attributes in
+// attrs that apply to target, in name order: those of the shape and those
+// of the label. An edge :style comes first, leaving out the properties
+// set explicitly, such as :stroke-dasharray.
+func styleDeclarations(attrs map[string]string, target AttributeTarget) ([]string, []string) {
+	var shape, label []string
+	if target&TargetEdge != 0 {
+		if style, ok := lineStyles[attrs["style"]]; ok {
+			explicit := make(map[string]bool)
+			for key := range attrs {
+				if spec, ok := LookupAttribute(key); ok && spec.CSS != "" && !spec.LabelCSS {
+					explicit[spec.CSS] = true
+				}
+			}
+			for _, declaration := range style.line {
+				if property, _, _ := strings.Cut(declaration, ":"); !explicit[property] {
+					shape = append(shape, declaration)
+				}
+			}
+			label = append(label, style.label...)
+		}
+	}
+
+	var keys []string
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		spec, ok := LookupAttribute(key)
+		if !ok || spec.CSS == "" || spec.AppliesTo&target == 0 {
+			continue
+		}
+		value := cssValue(key, attrs[key])
+		if !safeCSSValue(value) {
+			continue
+		}
+		declaration := spec.CSS + ": " + value
+		if spec.LabelCSS {
+			label = append(label, declaration)
+		} else {
+			shape = append(shape, declaration)
+		}
+	}
+	return shape, label
+}
+
+// styleProperties returns the declarations for the attributes in attrs
+// that apply to target as lines of a stylesheet rule: those of the shape
+// and those of the label
+func styleProperties(attrs map[string]string, target AttributeTarget) (string, string) {
+	shape, label := styleDeclarations(attrs, target)
+	rule := func(declarations []string) string {
+		var sb strings.Builder
+		for _, declaration := range declarations {
+			sb.WriteString("      " + declaration + ";\n")
+		}
+		return sb.String()
+	}
+	return rule(shape), rule(label)
+}
+
+// inlineStyles returns the style="..." attributes drawing an element's
+// own attributes on its shape and on its label, which win over node-style,
+// edge-style and classes, or empty strings if it sets none
+func (s *SVGGenerator) inlineStyles(attrs map[string]string, target AttributeTarget) (string, string) {
+	shape, label := styleDeclarations(attrs, target)
+	attribute := func(declarations []string) string {
+		if len(declarations) == 0 {
+			return ""
+		}
+		return fmt.Sprintf(` style="%s"`, s.escapeXML(strings.Join(declarations, "; ")))
+	}
+	return attribute(shape), attribute(label)
+}
+
+// generateClassCSS generates the rules for selector holding the styles a
+// class sets on elements of target, or nothing if it sets none of them
+func (s *SVGGenerator) generateClassCSS(selector, labelSelector string, class Class, target AttributeTarget) string {
+	var sb strings.Builder
+	shape, label := styleProperties(class.Attributes, target)
+	if shape != "" {
+		sb.WriteString(fmt.Sprintf("    %s {\n%s    }\n", selector, shape))
+	}
+	if label != "" {
+		sb.WriteString(fmt.Sprintf("    %s {\n%s    }\n", labelSelector, label))
+	}
+	return sb.String()
+}
+
 // generateCustomCSS generates CSS with custom styles from diagram
 func (s *SVGGenerator) generateCustomCSS(diagram *Diagram) string {
 	var sb strings.Builder
@@ -288,19 +691,8 @@ func (s *SVGGenerator) generateCustomCSS(diagram *Diagram) string {
 	sb.WriteString("      stroke-width: 1;\n")
 
 	// Apply custom node styles in deterministic order
-	var nodeStyleKeys []string
-	for key := range diagram.NodeStyle {
-		nodeStyleKeys = append(nodeStyleKeys, key)
-	}
-	sort.Strings(nodeStyleKeys)
-	
-	for _, key := range nodeStyleKeys {
-		value := diagram.NodeStyle[key]
-		switch key {
-		case "fill", "stroke", "stroke-width":
-			sb.WriteString(fmt.Sprintf("      %s: %s;\n", key, value))
-		}
-	}
+	nodeShape, nodeLabel := styleProperties(diagram.NodeStyle, TargetNode)
+	sb.WriteString(nodeShape)
 
 	sb.WriteString("    }\n")
 
@@ -310,19 +702,8 @@ func (s *SVGGenerator) generateCustomCSS(diagram *Diagram) string {
 	sb.WriteString("      stroke-width: 1;\n")
 
 	// Apply custom edge styles in deterministic order
-	var edgeStyleKeys []string
-	for key := range diagram.EdgeStyle {
-		edgeStyleKeys = append(edgeStyleKeys, key)
-	}
-	sort.Strings(edgeStyleKeys)
-	
-	for _, key := range edgeStyleKeys {
-		value := diagram.EdgeStyle[key]
-		switch key {
-		case "stroke", "stroke-width", "stroke-dasharray":
-			sb.WriteString(fmt.Sprintf("      %s: %s;\n", key, value))
-		}
-	}
+	edgeShape, edgeLabel := styleProperties(diagram.EdgeStyle, TargetEdge)
+	sb.WriteString(edgeShape)
 
 	sb.WriteString("    }\n")
 
@@ -333,6 +714,7 @@ func (s *SVGGenerator) generateCustomCSS(diagram *Diagram) string {
 	sb.WriteString("      dominant-baseline: middle;\n")
 	sb.WriteString("      fill: #000000;\n")
 	sb.WriteString("      pointer-events: none;\n")
+	sb.WriteString(nodeLabel)
 	sb.WriteString("    }\n")
 
 	sb.WriteString("    .edge-label {\n")
@@ -342,8 +724,42 @@ func (s *SVGGenerator) generateCustomCSS(diagram *Diagram) string {
 	sb.WriteString("      dominant-baseline: middle;\n")
 	sb.WriteString("      fill: #000000;\n")
 	sb.WriteString("      pointer-events: none;\n")
+	sb.WriteString(edgeLabel)
+	sb.WriteString("    }\n")
+
+	sb.WriteString("    .group {\n")
+	sb.WriteString("      fill: #f8f8f8;\n")
+	sb.WriteString("      fill-opacity: 0.6;\n")
+	sb.WriteString("      stroke: #999999;\n")
+	sb.WriteString("      stroke-width: 1;\n")
+	sb.WriteString("      stroke-dasharray: 4 2;\n")
 	sb.WriteString("    }\n")
 
+	sb.WriteString("    .group-label {\n")
+	sb.WriteString("      font-family: Arial, sans-serif;\n")
+	sb.WriteString("      font-size: 11px;\n")
+	sb.WriteString("      font-weight: bold;\n")
+	sb.WriteString("      text-anchor: start;\n")
+	sb.WriteString("      dominant-baseline: hanging;\n")
+	sb.WriteString("      fill: #555555;\n")
+	sb.WriteString("      pointer-events: none;\n")
+	sb.WriteString("    }\n")
+
+	sb.WriteString("    .diagram-title {\n")
+	sb.WriteString("      font-family: Arial, sans-serif;\n")
+	sb.WriteString("      font-size: 16px;\n")
+	sb.WriteString("      font-weight: bold;\n")
+	sb.WriteString("      text-anchor: middle;\n")
+	sb.WriteString("      dominant-baseline: middle;\n")
+	sb.WriteString("      fill: #000000;\n")
+	sb.WriteString("    }\n")
+
+	// Rules for defclass styles come last so they override the defaults
+	for _, class := range diagram.Classes {
+		sb.WriteString(s.generateClassCSS(".node."+class.Name, ".node."+class.Name+" + .node-label", class, TargetNode))
+		sb.WriteString(s.generateClassCSS(".edge."+class.Name, ".edge."+class.Name+" + .edge-label", class, TargetEdge))
+	}
+
 	sb.WriteString("  </style>\n")
 
 	return sb.String()
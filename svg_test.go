@@ -283,6 +283,59 @@ func TestSVGCustomStyles(t *testing.T) {
 	}
 }
 
+// TestSVGRegistryStyles tests that every style attribute the registry maps
+// to CSS reaches the stylesheet, label properties on the label rules
+func TestSVGRegistryStyles(t *testing.T) {
+	svg := CompletePipeline(t, `(diagram
+  (node-style :opacity 0.5 :color "#333" :stroke-dasharray "2 2")
+  (edge-style :font-size "8px")
+  (defclass "hot" :color "#c00" :stroke "red" :fill "#fee")
+  (nodes (id "A" :class "hot")))`)
+
+	AssertSVGContains(t, svg,
+		"      opacity: 0.5;\n      stroke-dasharray: 2 2;\n    }\n    .edge {",
+		"      pointer-events: none;\n      fill: #333333;\n    }\n    .edge-label {",
+		"      pointer-events: none;\n      font-size: 8px;\n    }\n    .group {",
+		"    .node.hot {\n      fill: #ffeeee;\n      stroke: #ff0000;\n    }\n",
+		"    .node.hot + .node-label {\n      fill: #cc0000;\n    }\n",
+		"    .edge.hot {\n      stroke: #ff0000;\n    }\n",
+		"    .edge.hot + .edge-label {\n      fill: #cc0000;\n    }\n",
+	)
+}
+
+// TestSVGStyleInjection tests that style values cannot break out of the
+// stylesheet, whether or not the diagram was validated
+func TestSVGStyleInjection(t *testing.T) {
+	input := `(diagram
+  (node-style :stroke-dasharray "1 2; } </style><script>alert(1)</script>")
+  (nodes (id "A")))`
+
+	diagram := ParseTestInput(t, input)
+	err := NewValidator().Validate(diagram)
+	if err == nil || !strings.Contains(err.Error(), "invalid :stroke-dasharray: expected dash array") {
+		t.Errorf("Expected a dash array error, got %v", err)
+	}
+
+	svg := GenerateTestSVG(t, LayoutTestDiagram(t, diagram), diagram)
+	AssertSVGNotContains(t, svg, "<script>", "stroke-dasharray: 1 2")
+}
+
+// TestSVGElementStyles tests that the style attributes of single nodes,
+// edges and groups are drawn on the element, winning over an edge :style
+func TestSVGElementStyles(t *testing.T) {
+	svg := CompletePipeline(t, `(diagram
+  (group "g" :fill "#eef" :stroke-dasharray "1 1" (nodes (id "A" :fill "red" :color "white" :font-size "14px")))
+  (nodes (id "B"))
+  (edges ("A" "B" :label "go" :style "dashed" :stroke-dasharray "6 3" :opacity 0.5)))`)
+
+	AssertSVGContains(t, svg,
+		`class="group" style="fill: #eeeeff; stroke-dasharray: 1 1"/>`,
+		`class="node rect" style="fill: #ff0000"/>`,
+		`class="node-label" style="fill: #ffffff; font-size: 14px"`,
+		`class="edge" style="opacity: 0.5; stroke-dasharray: 6 3" marker-end=`,
+	)
+}
+
 // TestSVGViewBox tests viewBox calculation
 func TestSVGViewBox(t *testing.T) {
 	generator := NewSVGGenerator()
@@ -354,6 +407,90 @@ func TestSVGXMLEscaping(t *testing.T) {
 	}
 }
 
+// TestSVGMultiLineLabels tests that multi-line labels render as stacked tspans
+func TestSVGMultiLineLabels(t *testing.T) {
+	generator := NewSVGGenerator()
+
+	layout := &Layout{
+		Width:  200,
+		Height: 200,
+		Nodes: map[string]LayoutNode{
+			"multi": {
+				ID:     "multi",
+				X:      100,
+				Y:      100,
+				Width:  80,
+				Height: 40,
+				Label:  "Order\n<Service>\nv2",
+				Shape:  "rect",
+			},
+		},
+		Edges: []LayoutEdge{
+			{
+				From:   "multi",
+				To:     "multi",
+				Points: []Point{{X: 10, Y: 10}, {X: 20, Y: 20}},
+				Label:  "yes\nno",
+				X:      15,
+				Y:      15,
+			},
+		},
+	}
+
+	svg := generator.Generate(layout, &Diagram{})
+
+	AssertSVGContains(t, svg,
+		`<tspan x="100.00" dy="-1.20em">Order</tspan>`,
+		`<tspan x="100.00" dy="1.20em">&lt;Service&gt;</tspan>`,
+		`<tspan x="100.00" dy="1.20em">v2</tspan></text>`,
+		`<tspan x="15.00" dy="-0.60em">yes</tspan><tspan x="15.00" dy="1.20em">no</tspan>`,
+	)
+
+	if CountSVGElements(svg, "text") != 2 {
+		t.Errorf("Expected one text element per label, got %d", CountSVGElements(svg, "text"))
+	}
+}
+
+// TestSVGLabelMarkup tests that label markup renders as styled tspans,
+// with lines of larger text given more room
+func TestSVGLabelMarkup(t *testing.T) {
+	generator := NewSVGGenerator()
+
+	single := generator.generateText(0, 0, "node-label", "", "**Order** *service* `v2`")
+	AssertSVGContains(t, single,
+		`><tspan font-weight="bold">Order</tspan> <tspan font-style="italic">service</tspan> <tspan font-family="monospace">v2</tspan></text>`)
+
+	multi := generator.generateText(10, 0, "node-label", "", "[Title]{size=24 color=#c00}\nbody")
+	AssertSVGContains(t, multi,
+		`<tspan x="10.00" dy="-0.60em"><tspan font-size="24px" fill="#cc0000">Title</tspan></tspan>`,
+		`<tspan x="10.00" dy="1.80em">body</tspan>`)
+
+	group := generator.generateGroup(LayoutGroup{ID: "g", Label: "**VPC**\nprivate", Width: 100, Height: 100})
+	AssertSVGContains(t, group, `><tspan font-weight="bold">VPC</tspan> private</text>`)
+}
+
+// TestSVGGroups tests rendering of group boxes and labels
+func TestSVGGroups(t *testing.T) {
+	layout := CreateTestLayout()
+	layout.Groups = []LayoutGroup{
+		{ID: "g", Label: "VPC <main>", X: 150, Y: 100, Width: 200, Height: 120},
+	}
+
+	svg := NewSVGGenerator().GenerateWithCustomStyles(layout, CreateTestDiagram())
+
+	AssertSVGContains(t, svg,
+		`<rect x="50.00" y="40.00" width="200.00" height="120.00" rx="6" ry="6" class="group"/>`,
+		`<text x="58.00" y="-155.00" class="group-label" transform="scale(1, -1)">VPC &lt;main&gt;</text>`,
+		".group {",
+		".group-label {",
+	)
+
+	// Groups are drawn before edges so they stay in the background
+	if strings.Index(svg, `class="group"`) > strings.Index(svg, `class="edge"`) {
+		t.Errorf("Group boxes should be drawn before edges")
+	}
+}
+
 // TestSVGMarkerDefinitions tests SVG marker definitions
 func TestSVGMarkerDefinitions(t *testing.T) {
 	generator := NewSVGGenerator()
@@ -387,6 +524,120 @@ func TestSVGMarkerDefinitions(t *testing.T) {
 	}
 }
 
+// TestSVGEdgeMarkers tests the arrowheads drawn for each edge direction
+func TestSVGEdgeMarkers(t *testing.T) {
+	tests := []struct {
+		dir      EdgeDir
+		expected string
+	}{
+		{"", `class="edge" marker-end="url(#arrowhead)"/>`},
+		{DirForward, `class="edge" marker-end="url(#arrowhead)"/>`},
+		{DirBack, `class="edge" marker-start="url(#arrowhead-start)"/>`},
+		{DirBoth, `class="edge" marker-start="url(#arrowhead-start)" marker-end="url(#arrowhead)"/>`},
+		{DirNone, `class="edge"/>`},
+	}
+
+	generator := NewSVGGenerator()
+	for _, tt := range tests {
+		t.Run(string(tt.dir), func(t *testing.T) {
+			edge := LayoutEdge{
+				From:   "A",
+				To:     "B",
+				Points: []Point{{X: 0, Y: 0}, {X: 0, Y: 100}},
+				Dir:    tt.dir,
+			}
+			svg := generator.generateEdge(edge)
+			if !strings.Contains(svg, tt.expected) {
+				t.Errorf("Expected %q in %q", tt.expected, svg)
+			}
+		})
+	}
+
+	svg := generator.Generate(&Layout{Nodes: map[string]LayoutNode{}}, &Diagram{})
+	if !strings.Contains(svg, `<marker id="arrowhead-start"`) {
+		t.Errorf("SVG should define the start arrowhead marker")
+	}
+}
+
+// TestSVGPortCurve tests that edges routed to ports are drawn as cubic curves
+func TestSVGPortCurve(t *testing.T) {
+	edge := LayoutEdge{
+		From:   "A",
+		To:     "B",
+		Points: []Point{{X: 0, Y: 0}, {X: 40, Y: 0}, {X: 100, Y: 140}, {X: 100, Y: 100}},
+	}
+
+	svg := NewSVGGenerator().generateEdge(edge)
+	expected := `d="M 0.00 0.00 C 40.00 0.00, 100.00 140.00, 100.00 100.00"`
+	if !strings.Contains(svg, expected) {
+		t.Errorf("Expected %q in %q", expected, svg)
+	}
+}
+
+// TestSVGMetadata tests the title, description and Dublin Core metadata
+func TestSVGMetadata(t *testing.T) {
+	layout := &Layout{Width: 400, Height: 300, Nodes: map[string]LayoutNode{}}
+	diagram := &Diagram{
+		Title:       "Checkout <v2>",
+		Description: "How an order is paid",
+		Meta:        map[string]string{"author": "Jane Doe", "version": "2.1"},
+	}
+
+	svg := NewSVGGenerator().GenerateWithCustomStyles(layout, diagram)
+	for _, expected := range []string{
+		"<title>Checkout &lt;v2&gt;</title>\n  <desc>How an order is paid</desc>\n  <metadata>",
+		`<rdf:Description rdf:about="">`,
+		"<dc:title>Checkout &lt;v2&gt;</dc:title>",
+		"<dc:description>How an order is paid</dc:description>",
+		"<dc:creator>Jane Doe</dc:creator>",
+		"<owl:versionInfo>2.1</owl:versionInfo>",
+	} {
+		if !strings.Contains(svg, expected) {
+			t.Errorf("Expected %q in SVG", expected)
+		}
+	}
+	if strings.Index(svg, "<title>") > strings.Index(svg, "<style>") {
+		t.Errorf("Expected <title> to be the first element of the SVG")
+	}
+	if strings.Contains(svg, "diagram-title\"") {
+		t.Errorf("Expected no visible title without a position")
+	}
+
+	empty := NewSVGGenerator().GenerateWithCustomStyles(layout, &Diagram{})
+	if strings.Contains(empty, "<title>") || strings.Contains(empty, "<metadata>") {
+		t.Errorf("Expected no metadata for a diagram without any")
+	}
+}
+
+// TestSVGTitleBand tests the visible title above and below the drawing
+func TestSVGTitleBand(t *testing.T) {
+	layout := &Layout{Width: 400, Height: 300, Nodes: map[string]LayoutNode{}}
+	tests := []struct {
+		position  string
+		title     string
+		transform string
+	}{
+		{"top", `<text x="220.00" y="35.00" class="diagram-title">Overview</text>`, `translate(20, 350)`},
+		{"bottom", `<text x="220.00" y="335.00" class="diagram-title">Overview</text>`, `translate(20, 320)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.position, func(t *testing.T) {
+			diagram := &Diagram{Title: "Overview", TitlePosition: tt.position}
+			svg := NewSVGGenerator().GenerateWithCustomStyles(layout, diagram)
+			if !strings.Contains(svg, `viewBox="0 0 440 370"`) {
+				t.Errorf("Expected the title band to add to the height")
+			}
+			if !strings.Contains(svg, tt.title) {
+				t.Errorf("Expected %q in SVG", tt.title)
+			}
+			if !strings.Contains(svg, tt.transform) {
+				t.Errorf("Expected drawing moved by %q", tt.transform)
+			}
+		})
+	}
+}
+
 // TestSVGEmptyLayout tests SVG generation with empty layout
 func TestSVGEmptyLayout(t *testing.T) {
 	generator := NewSVGGenerator()
@@ -735,10 +986,10 @@ func TestSVGGeneratorErrorCases(t *testing.T) {
 		}
 
 		svg := generator.GenerateWithCustomStyles(layout, diagram)
-		// CSS values are NOT escaped - this is a security issue
-		// But for this test, we'll just document the actual behavior
-		if !strings.Contains(svg, "<script>") {
-			t.Errorf("CSS values are not escaped - script tags present")
+		// Labels are escaped and CSS values that could end the stylesheet
+		// are dropped
+		if strings.Contains(svg, "<script>") {
+			t.Errorf("Script tags should not reach the SVG:\n%s", svg)
 		}
 	})
 }
@@ -752,11 +1003,11 @@ func TestSVGEdgeStyleMapping(t *testing.T) {
 		expected string
 	}{
 		{"solid", "stroke-dasharray: none"},
-		{"dashed", "stroke-dasharray: 5,5"},
-		{"dotted", "stroke-dasharray: 2,2"},
+		{"dashed", "stroke-dasharray: 5 5"},
+		{"dotted", "stroke-dasharray: 2 2"},
 		{"bold", "stroke-width: 3"},
-		{"invis", "stroke: none"},
-		{"invisible", "stroke: none"},
+		{"invis", "visibility: hidden"},
+		{"invisible", "visibility: hidden"},
 	}
 
 	for _, tt := range tests {
@@ -783,11 +1034,7 @@ func TestSVGEdgeStyleMapping(t *testing.T) {
 			}
 
 			svg := generator.GenerateWithCustomStyles(layout, diagram)
-			// For now, just check that it generates valid SVG
-			// The actual style implementation may vary
-			if !strings.Contains(svg, "<svg") {
-				t.Errorf("Expected valid SVG for style '%s'", tt.style)
-			}
+			AssertSVGContains(t, svg, "    .edge {\n      fill: none;\n      stroke: #000000;\n      stroke-width: 1;\n      "+tt.expected+";\n")
 		})
 	}
 }
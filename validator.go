@@ -2,18 +2,49 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
-// ValidatorError represents a validation error
+// ValidatorError represents a validation error. NodeID and EdgeID name
+// the node or edge it is about, if any; Related points at other places
+// involved, such as the first definition of a duplicate ID.
 type ValidatorError struct {
+	Code    DiagnosticCode
 	Message string
 	NodeID  string
 	EdgeID  string
+	Span    Span
+	Related []RelatedLocation
 }
 
 func (e ValidatorError) Error() string {
-	return e.Message
+	return formatSourceMessage(e.Span, e.Message)
+}
+
+// Diagnostic returns the error as a diagnostic
+func (e ValidatorError) Diagnostic() Diagnostic {
+	return Diagnostic{Code: e.Code, Message: e.Message, Span: e.Span, Related: e.Related}
+}
+
+// ValidationErrors is the error returned by Validate
+type ValidationErrors []ValidatorError
+
+func (l ValidationErrors) Error() string {
+	messages := make([]string, len(l))
+	for i, err := range l {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("validation failed with %d errors:\n%s", len(l), strings.Join(messages, "\n"))
+}
+
+// firstDefinedAt returns the related location of the first definition of
+// a duplicate
+func firstDefinedAt(span Span) []RelatedLocation {
+	if !span.IsValid() {
+		return nil
+	}
+	return []RelatedLocation{{Span: span, Message: "first defined here"}}
 }
 
 // Validator validates AST diagrams
@@ -34,142 +65,427 @@ func (v *Validator) Validate(diagram *Diagram) error {
 	// Validate node ID uniqueness
 	v.validateNodeIDUniqueness(diagram)
 
+	// Validate group IDs
+	v.validateGroups(diagram)
+
 	// Validate edge references
 	v.validateEdgeReferences(diagram)
 
+	// Validate class definitions and uses
+	v.validateClasses(diagram)
+
+	// Validate profile names
+	v.validateProfiles(diagram)
+
+	// Validate port declarations and the ports edges attach to
+	v.validatePorts(diagram)
+
 	// Validate node and edge attributes
 	v.validateAttributes(diagram)
 
+	// Validate markup in labels
+	v.validateLabels(diagram)
+
+	// Check the (assert ...) forms against the graph
+	v.validateAssertions(diagram)
+
 	if len(v.errors) > 0 {
-		return fmt.Errorf("validation failed with %d errors: %s", len(v.errors), v.formatErrors())
+		return ValidationErrors(v.errors)
 	}
 
 	return nil
 }
 
 func (v *Validator) validateNodeIDUniqueness(diagram *Diagram) {
-	nodeIDs := make(map[string]bool)
-	duplicates := []string{}
+	first := make(map[string]Node)
+	duplicates := []Node{}
 
 	for _, node := range diagram.Nodes {
 		if node.ID == "" {
 			v.errors = append(v.errors, ValidatorError{
+				Code:    CodeEmptyID,
 				Message: "node ID cannot be empty",
 				NodeID:  node.ID,
+				Span:    node.Span,
 			})
 			continue
 		}
 
-		if nodeIDs[node.ID] {
-			duplicates = append(duplicates, node.ID)
+		if _, ok := first[node.ID]; ok {
+			duplicates = append(duplicates, node)
+		} else {
+			first[node.ID] = node
 		}
-		nodeIDs[node.ID] = true
 	}
 
-	for _, id := range duplicates {
+	for _, node := range duplicates {
 		v.errors = append(v.errors, ValidatorError{
-			Message: fmt.Sprintf("duplicate node ID: %s", id),
-			NodeID:  id,
+			Code:    CodeDuplicateNodeID,
+			Message: fmt.Sprintf("duplicate node ID: %s", node.ID),
+			NodeID:  node.ID,
+			Span:    node.Span,
+			Related: firstDefinedAt(first[node.ID].Span),
 		})
 	}
 }
 
+func (v *Validator) validateGroups(diagram *Diagram) {
+	nodes := make(map[string]Node)
+	for _, node := range diagram.Nodes {
+		if _, ok := nodes[node.ID]; !ok {
+			nodes[node.ID] = node
+		}
+	}
+
+	groups := make(map[string]Group)
+	for _, group := range diagram.AllGroups() {
+		first, duplicate := groups[group.ID]
+		node, conflict := nodes[group.ID]
+		switch {
+		case group.ID == "":
+			v.errors = append(v.errors, ValidatorError{
+				Code:    CodeEmptyID,
+				Message: "group ID cannot be empty",
+				Span:    group.Span,
+			})
+		case duplicate:
+			v.errors = append(v.errors, ValidatorError{
+				Code:    CodeDuplicateGroupID,
+				Message: fmt.Sprintf("duplicate group ID: %s", group.ID),
+				Span:    group.Span,
+				Related: firstDefinedAt(first.Span),
+			})
+		case conflict:
+			var related []RelatedLocation
+			if node.Span.IsValid() {
+				related = []RelatedLocation{{Span: node.Span, Message: fmt.Sprintf("node '%s' defined here", node.ID)}}
+			}
+			v.errors = append(v.errors, ValidatorError{
+				Code:    CodeGroupIDConflict,
+				Message: fmt.Sprintf("group ID '%s' conflicts with a node ID", group.ID),
+				Span:    group.Span,
+				Related: related,
+			})
+		}
+		if !duplicate {
+			groups[group.ID] = group
+		}
+	}
+}
+
+// reservedClasses are the CSS classes the SVG generator uses itself
+var reservedClasses = map[string]bool{
+	"node": true, "edge": true, "rect": true, "ellipse": true, "diamond": true,
+	"node-label": true, "edge-label": true, "group": true, "group-label": true,
+}
+
+func (v *Validator) validateClasses(diagram *Diagram) {
+	defined := make(map[string]bool)
+	first := make(map[string]Span)
+	for _, class := range diagram.Classes {
+		switch {
+		case !isValidClassName(class.Name):
+			v.errors = append(v.errors, ValidatorError{
+				Code:    CodeInvalidClassName,
+				Message: fmt.Sprintf("invalid class name '%s'", class.Name),
+				Span:    class.Span,
+			})
+		case reservedClasses[class.Name]:
+			v.errors = append(v.errors, ValidatorError{
+				Code:    CodeReservedClass,
+				Message: fmt.Sprintf("class '%s' conflicts with a built-in class", class.Name),
+				Span:    class.Span,
+			})
+		case defined[class.Name]:
+			v.errors = append(v.errors, ValidatorError{
+				Code:    CodeDuplicateClass,
+				Message: fmt.Sprintf("duplicate class: %s", class.Name),
+				Span:    class.Span,
+				Related: firstDefinedAt(first[class.Name]),
+			})
+		}
+		if !defined[class.Name] {
+			first[class.Name] = class.Span
+		}
+		defined[class.Name] = true
+	}
+
+	for _, node := range diagram.Nodes {
+		for _, name := range node.Classes {
+			if !defined[name] {
+				v.errors = append(v.errors, ValidatorError{
+					Code:    CodeUnknownClass,
+					Message: fmt.Sprintf("node '%s': unknown class '%s'", node.ID, name),
+					NodeID:  node.ID,
+					Span:    node.AttrSpan("class"),
+				})
+			}
+		}
+	}
+	for i, edge := range diagram.Edges {
+		for _, name := range edge.Classes {
+			if !defined[name] {
+				v.errors = append(v.errors, ValidatorError{
+					Code:    CodeUnknownClass,
+					Message: fmt.Sprintf("edge %d: unknown class '%s'", i, name),
+					EdgeID:  fmt.Sprintf("edge_%d", i),
+					Span:    edge.AttrSpan("class"),
+				})
+			}
+		}
+	}
+}
+
+// isValidClassName reports whether name can be used as a CSS class
+func isValidClassName(name string) bool {
+	rest := strings.TrimPrefix(name, "-")
+	if rest == "" || rest[0] == '-' || (rest[0] >= '0' && rest[0] <= '9') {
+		return false
+	}
+	for _, r := range name {
+		if !(r == '-' || r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
 func (v *Validator) validateEdgeReferences(diagram *Diagram) {
+	// Edges may connect nodes or whole groups
 	nodeIDs := make(map[string]bool)
 	for _, node := range diagram.Nodes {
 		nodeIDs[node.ID] = true
 	}
+	for _, group := range diagram.AllGroups() {
+		nodeIDs[group.ID] = true
+	}
 
 	for i, edge := range diagram.Edges {
 		if edge.From == "" {
 			v.errors = append(v.errors, ValidatorError{
+				Code:    CodeEmptyID,
 				Message: fmt.Sprintf("edge %d: 'from' node ID cannot be empty", i),
 				EdgeID:  fmt.Sprintf("edge_%d", i),
+				Span:    edge.Span,
 			})
 		} else if !nodeIDs[edge.From] {
 			v.errors = append(v.errors, ValidatorError{
+				Code:    CodeUnknownEndpoint,
 				Message: fmt.Sprintf("edge %d: 'from' node '%s' does not exist", i, edge.From),
 				EdgeID:  fmt.Sprintf("edge_%d", i),
+				Span:    edge.Span,
 			})
 		}
 
 		if edge.To == "" {
 			v.errors = append(v.errors, ValidatorError{
+				Code:    CodeEmptyID,
 				Message: fmt.Sprintf("edge %d: 'to' node ID cannot be empty", i),
 				EdgeID:  fmt.Sprintf("edge_%d", i),
+				Span:    edge.Span,
 			})
 		} else if !nodeIDs[edge.To] {
 			v.errors = append(v.errors, ValidatorError{
+				Code:    CodeUnknownEndpoint,
 				Message: fmt.Sprintf("edge %d: 'to' node '%s' does not exist", i, edge.To),
 				EdgeID:  fmt.Sprintf("edge_%d", i),
+				Span:    edge.Span,
+			})
+		}
+	}
+}
+
+// checkAttributeTypes reports the attributes that do not apply to the
+// elements in target, and those whose value does not have the type the
+// attribute expects or is not one of its allowed values. attr looks up
+// the typed value.
+func (v *Validator) checkAttributeTypes(owner string, target AttributeTarget, attrs map[string]string, attr func(string) (Value, bool), span func(string) Span, nodeID, edgeID string) {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		code := CodeInvalidValue
+		err := checkAttributeName(key, target)
+		if err != nil {
+			code = CodeMisplacedAttribute
+			if _, known := LookupAttribute(key); !known {
+				code = CodeUnknownAttribute
+			}
+		} else {
+			value, _ := attr(key)
+			spec, _ := LookupAttribute(key)
+			if err = value.CheckType(spec.Type); err != nil {
+				err = fmt.Errorf("invalid :%s: %v", key, err)
+			} else if !spec.Allows(attrs[key]) {
+				err = fmt.Errorf("invalid %s '%s'", key, attrs[key])
+			}
+		}
+		if err != nil {
+			v.errors = append(v.errors, ValidatorError{
+				Code:    code,
+				Message: fmt.Sprintf("%s: %v", owner, err),
+				NodeID:  nodeID,
+				EdgeID:  edgeID,
+				Span:    span(key),
 			})
 		}
 	}
 }
 
+// validateAttributes checks attribute names and values against the
+// attribute registry
 func (v *Validator) validateAttributes(diagram *Diagram) {
-	// Validate node attributes
+	styleValue := func(style map[string]string) func(string) (Value, bool) {
+		return func(key string) (Value, bool) { return attrValue(nil, style, key) }
+	}
+	styleSpan := func(spans map[string]Span) func(string) Span {
+		return func(key string) Span { return spans[key] }
+	}
+	v.checkAttributeTypes("node-style", TargetNode, diagram.NodeStyle, styleValue(diagram.NodeStyle), styleSpan(diagram.NodeStyleSpans), "", "")
+	v.checkAttributeTypes("edge-style", TargetEdge, diagram.EdgeStyle, styleValue(diagram.EdgeStyle), styleSpan(diagram.EdgeStyleSpans), "", "")
+
+	for _, class := range diagram.Classes {
+		v.checkAttributeTypes(fmt.Sprintf("class '%s'", class.Name), TargetNode|TargetEdge, class.Attributes, class.Attr, class.AttrSpan, "", "")
+	}
+	for _, group := range diagram.AllGroups() {
+		v.checkAttributeTypes(fmt.Sprintf("group '%s'", group.ID), TargetGroup, group.Attributes, group.Attr, group.AttrSpan, "", "")
+	}
+	for _, node := range diagram.Nodes {
+		v.checkAttributeTypes(fmt.Sprintf("node '%s'", node.ID), TargetNode, node.Attributes, node.Attr, node.AttrSpan, node.ID, "")
+	}
+	for i, edge := range diagram.Edges {
+		v.checkAttributeTypes(fmt.Sprintf("edge %d", i), TargetEdge, edge.Attributes, edge.Attr, edge.AttrSpan, "", fmt.Sprintf("edge_%d", i))
+	}
+}
+
+func (v *Validator) validateProfiles(diagram *Diagram) {
+	first := make(map[string]Span)
+	for _, profile := range diagram.Profiles {
+		if span, defined := first[profile.Name]; defined {
+			v.errors = append(v.errors, ValidatorError{
+				Code:    CodeDuplicateProfile,
+				Message: fmt.Sprintf("duplicate profile: %s", profile.Name),
+				Span:    profile.Span,
+				Related: firstDefinedAt(span),
+			})
+			continue
+		}
+		first[profile.Name] = profile.Span
+	}
+}
+
+func (v *Validator) validatePorts(diagram *Diagram) {
+	nodes := make(map[string]Node)
 	for _, node := range diagram.Nodes {
-		if shape, ok := node.Attributes["shape"]; ok {
-			if !isValidShape(shape) {
+		nodes[node.ID] = node
+
+		seen := make(map[string]bool)
+		for _, port := range diagram.NodePorts(node) {
+			message := ""
+			if _, ok := compassPort(port); ok {
+				message = fmt.Sprintf("node '%s': port '%s' conflicts with a compass point", node.ID, port)
+			} else if seen[port] {
+				message = fmt.Sprintf("node '%s': duplicate port '%s'", node.ID, port)
+			}
+			seen[port] = true
+			if message != "" {
 				v.errors = append(v.errors, ValidatorError{
-					Message: fmt.Sprintf("node '%s': invalid shape '%s'", node.ID, shape),
+					Code:    CodeInvalidPort,
+					Message: message,
 					NodeID:  node.ID,
+					Span:    node.AttrSpan("ports"),
 				})
 			}
 		}
 	}
 
-	// Validate edge attributes
+	groups := make(map[string]Group)
+	for _, group := range diagram.AllGroups() {
+		groups[group.ID] = group
+	}
+
+	// portError describes why endpoint id lacks the port and where the
+	// endpoint is defined. Groups only have compass ports; unknown
+	// endpoints are reported elsewhere.
+	portError := func(id, port string) (string, Span) {
+		if _, ok := compassPort(port); ok {
+			return "", Span{}
+		}
+		if node, ok := nodes[id]; ok {
+			for _, name := range diagram.NodePorts(node) {
+				if name == port {
+					return "", Span{}
+				}
+			}
+			return fmt.Sprintf("node '%s' has no port '%s'", id, port), node.Span
+		}
+		if group, ok := groups[id]; ok {
+			return fmt.Sprintf("group '%s' has only compass ports, got '%s'", id, port), group.Span
+		}
+		return "", Span{}
+	}
+
 	for i, edge := range diagram.Edges {
-		if style, ok := edge.Attributes["style"]; ok {
-			if !isValidEdgeStyle(style) {
+		ends := []struct{ id, port, key string }{
+			{edge.From, edge.FromPort, "from-port"},
+			{edge.To, edge.ToPort, "to-port"},
+		}
+		for _, end := range ends {
+			if end.port == "" {
+				continue
+			}
+			if message, defined := portError(end.id, end.port); message != "" {
+				var related []RelatedLocation
+				if defined.IsValid() {
+					related = []RelatedLocation{{Span: defined, Message: fmt.Sprintf("'%s' defined here", end.id)}}
+				}
 				v.errors = append(v.errors, ValidatorError{
-					Message: fmt.Sprintf("edge %d: invalid style '%s'", i, style),
+					Code:    CodeUnknownPort,
+					Message: fmt.Sprintf("edge %d: %s", i, message),
 					EdgeID:  fmt.Sprintf("edge_%d", i),
+					Span:    edge.AttrSpan(end.key),
+					Related: related,
 				})
 			}
 		}
 	}
 }
 
-func isValidShape(shape string) bool {
-	validShapes := []string{
-		"rect", "rectangle", "box",
-		"ellipse", "circle", "oval",
-		"diamond", "rhombus",
-		"triangle", "trapezium",
-		"polygon", "hexagon", "octagon",
-	}
-
-	for _, valid := range validShapes {
-		if shape == valid {
-			return true
+// validateLabels reports invalid attributes of [text]{...} spans in
+// labels; the renderer ignores them
+func (v *Validator) validateLabels(diagram *Diagram) {
+	for _, node := range diagram.Nodes {
+		if _, err := ParseLabel(node.Label); err != nil {
+			v.errors = append(v.errors, ValidatorError{
+				Code:    CodeInvalidMarkup,
+				Message: fmt.Sprintf("node '%s': invalid label markup: %v", node.ID, err),
+				NodeID:  node.ID,
+				Span:    node.AttrSpan("label"),
+			})
 		}
 	}
-	return false
-}
-
-func isValidEdgeStyle(style string) bool {
-	validStyles := []string{
-		"solid", "dashed", "dotted", "bold",
-		"invis", "invisible",
-	}
-
-	for _, valid := range validStyles {
-		if style == valid {
-			return true
+	for i, edge := range diagram.Edges {
+		if _, err := ParseLabel(edge.Label); err != nil {
+			v.errors = append(v.errors, ValidatorError{
+				Code:    CodeInvalidMarkup,
+				Message: fmt.Sprintf("edge %d: invalid label markup: %v", i, err),
+				EdgeID:  fmt.Sprintf("edge_%d", i),
+				Span:    edge.AttrSpan("label"),
+			})
 		}
 	}
-	return false
-}
-
-func (v *Validator) formatErrors() string {
-	var messages []string
-	for _, err := range v.errors {
-		messages = append(messages, err.Message)
+	for _, group := range diagram.AllGroups() {
+		if _, err := ParseLabel(group.Label); err != nil {
+			v.errors = append(v.errors, ValidatorError{
+				Code:    CodeInvalidMarkup,
+				Message: fmt.Sprintf("group '%s': invalid label markup: %v", group.ID, err),
+				Span:    group.AttrSpan("label"),
+			})
+		}
 	}
-	return strings.Join(messages, "; ")
 }
 
 // GetErrors returns all validation errors
@@ -248,7 +248,8 @@ func TestValidatorAttributes(t *testing.T) {
 					{ID: "A", Attributes: map[string]string{"shape": "triangle"}},
 				},
 			},
-			expectErr: false, // triangle is valid now per isValidShape function
+			expectErr:   true, // the SVG generator cannot draw triangles
+			errContains: "node 'A': invalid shape 'triangle'",
 		},
 		{
 			name: "invalid node shape - completely wrong",
@@ -458,34 +459,34 @@ func TestValidatorComplexScenarios(t *testing.T) {
 	})
 }
 
-// TestIsValidShape tests the shape validation function
+// TestIsValidShape tests the values allowed for :shape
 func TestIsValidShape(t *testing.T) {
 	validShapes := []string{
 		"rect", "rectangle", "box",
 		"ellipse", "circle", "oval",
 		"diamond", "rhombus",
-		"triangle", "trapezium",
-		"polygon", "hexagon", "octagon",
 	}
 
 	invalidShapes := []string{
 		"star", "invalid", "random", "123", "",
+		"triangle", "trapezium", "polygon", "hexagon", "octagon",
 	}
 
+	spec, _ := LookupAttribute("shape")
 	for _, shape := range validShapes {
-		if !isValidShape(shape) {
+		if !spec.Allows(shape) {
 			t.Errorf("Expected '%s' to be valid shape", shape)
 		}
 	}
 
 	for _, shape := range invalidShapes {
-		if isValidShape(shape) {
+		if spec.Allows(shape) {
 			t.Errorf("Expected '%s' to be invalid shape", shape)
 		}
 	}
 }
 
-// TestIsValidEdgeStyle tests the edge style validation function
+// TestIsValidEdgeStyle tests the values allowed for :style
 func TestIsValidEdgeStyle(t *testing.T) {
 	validStyles := []string{
 		"solid", "dashed", "dotted", "bold",
@@ -496,14 +497,15 @@ func TestIsValidEdgeStyle(t *testing.T) {
 		"wavy", "invalid", "random", "123", "",
 	}
 
+	spec, _ := LookupAttribute("style")
 	for _, style := range validStyles {
-		if !isValidEdgeStyle(style) {
+		if !spec.Allows(style) {
 			t.Errorf("Expected '%s' to be valid edge style", style)
 		}
 	}
 
 	for _, style := range invalidStyles {
-		if isValidEdgeStyle(style) {
+		if spec.Allows(style) {
 			t.Errorf("Expected '%s' to be invalid edge style", style)
 		}
 	}
@@ -580,7 +582,8 @@ func TestValidatorEdgeCases(t *testing.T) {
 					}},
 				},
 			},
-			expectErr: false, // Both should be checked
+			expectErr:   true,
+			errContains: "node 'A': unknown attribute :Shape (did you mean :shape?)",
 		},
 		{
 			name: "cyclic edges",
@@ -765,6 +768,77 @@ func TestValidatorErrorAccumulation(t *testing.T) {
 	}
 }
 
+// TestValidatorErrorLocations tests that validation errors point into the source
+func TestValidatorErrorLocations(t *testing.T) {
+	input := `(diagram
+  (nodes
+    (id "A" :shape "star"))
+  (edges
+    ("A" "B")))`
+
+	diagram := ParseTestInput(t, input)
+	validator := NewValidator()
+	err := validator.Validate(diagram)
+	if err == nil {
+		t.Fatalf("Expected validation to fail")
+	}
+
+	errors := validator.GetErrors()
+	if len(errors) != 2 {
+		t.Fatalf("Expected 2 errors, got %d: %v", len(errors), err)
+	}
+
+	if !strings.HasPrefix(errors[0].Error(), "<input>:5:5: edge 0: 'to' node 'B' does not exist") {
+		t.Errorf("Unexpected edge error: %s", errors[0].Error())
+	}
+	if !strings.HasPrefix(errors[1].Error(), "<input>:3:13: node 'A': invalid shape 'star'") {
+		t.Errorf("Unexpected shape error: %s", errors[1].Error())
+	}
+	if !strings.Contains(err.Error(), "(id \"A\" :shape \"star\"))\n                ^") {
+		t.Errorf("Expected caret under shape attribute, got:\n%v", err)
+	}
+}
+
+// TestValidatorGroups tests group ID and group reference validation
+func TestValidatorGroups(t *testing.T) {
+	valid := &Diagram{
+		Nodes: []Node{{ID: "A"}, {ID: "B"}},
+		Groups: []Group{
+			{ID: "outer", Nodes: []string{"A"}, Groups: []Group{{ID: "inner", Nodes: []string{"B"}}}},
+		},
+		Edges: []Edge{{From: "A", To: "inner"}, {From: "outer", To: "B"}},
+	}
+	if err := NewValidator().Validate(valid); err != nil {
+		t.Errorf("Expected edges to groups to be valid, got: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		groups      []Group
+		errContains string
+	}{
+		{"empty group id", []Group{{ID: ""}}, "group ID cannot be empty"},
+		{"duplicate group id", []Group{{ID: "g"}, {ID: "x", Groups: []Group{{ID: "g"}}}}, "duplicate group ID: g"},
+		{"group id clashes with node", []Group{{ID: "A"}}, "group ID 'A' conflicts with a node ID"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagram := &Diagram{Nodes: []Node{{ID: "A"}}, Groups: tt.groups}
+			AssertValidationError(t, diagram, tt.errContains)
+		})
+	}
+
+	t.Run("unknown group reference", func(t *testing.T) {
+		diagram := &Diagram{
+			Nodes:  []Node{{ID: "A"}},
+			Groups: []Group{{ID: "g", Nodes: []string{"A"}}},
+			Edges:  []Edge{{From: "A", To: "h"}},
+		}
+		AssertValidationError(t, diagram, "'to' node 'h' does not exist")
+	})
+}
+
 // BenchmarkValidator benchmarks validator performance
 func BenchmarkValidator(b *testing.B) {
 	// Create a reasonably complex diagram
@@ -801,3 +875,260 @@ func BenchmarkValidator(b *testing.B) {
 		}
 	}
 }
+
+// TestValidatorClasses tests class definition and class reference validation
+func TestValidatorClasses(t *testing.T) {
+	valid := &Diagram{
+		Classes: []Class{{Name: "error", Attributes: map[string]string{"shape": "diamond"}}},
+		Nodes:   []Node{{ID: "A", Classes: []string{"error"}}, {ID: "B"}},
+		Edges:   []Edge{{From: "A", To: "B", Classes: []string{"error"}}},
+	}
+	if err := NewValidator().Validate(valid); err != nil {
+		t.Errorf("Expected classes to be valid, got: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		diagram     *Diagram
+		errContains string
+	}{
+		{
+			"unknown node class",
+			&Diagram{Nodes: []Node{{ID: "A", Classes: []string{"eror"}}}},
+			"node 'A': unknown class 'eror'",
+		},
+		{
+			"unknown edge class",
+			&Diagram{Nodes: []Node{{ID: "A"}}, Edges: []Edge{{From: "A", To: "A", Classes: []string{"x"}}}},
+			"edge 0: unknown class 'x'",
+		},
+		{
+			"duplicate class",
+			&Diagram{Classes: []Class{{Name: "a"}, {Name: "a"}}},
+			"duplicate class: a",
+		},
+		{
+			"invalid class name",
+			&Diagram{Classes: []Class{{Name: "1st"}}},
+			"invalid class name '1st'",
+		},
+		{
+			"built-in class name",
+			&Diagram{Classes: []Class{{Name: "node"}}},
+			"class 'node' conflicts with a built-in class",
+		},
+		{
+			"invalid class shape",
+			&Diagram{Classes: []Class{{Name: "a", Attributes: map[string]string{"shape": "star"}}}},
+			"class 'a': invalid shape 'star'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			AssertValidationError(t, tt.diagram, tt.errContains)
+		})
+	}
+}
+
+// TestValidatorAttributeTypes tests rejection of values of the wrong type
+func TestValidatorAttributeTypes(t *testing.T) {
+	input := `(diagram
+  (edge-style :stroke-width "thick")
+  (defclass "bad" :fill 12)
+  (group "g" :stroke "#12345"
+    (nodes
+      (id "A" :stroke-width 2px :tags ("x") :weight "heavy")))
+  (edges
+    ("A" "A" :stroke (1 2))))`
+
+	diagram := ParseTestInput(t, input)
+	validator := NewValidator()
+	if err := validator.Validate(diagram); err == nil {
+		t.Fatalf("Expected validation to fail")
+	}
+
+	expected := []string{
+		`<input>:2:15: edge-style: invalid :stroke-width: expected length, got "thick"`,
+		`<input>:3:19: class 'bad': invalid :fill: expected color, got 12`,
+		`<input>:4:14: group 'g': invalid :stroke: expected color, got "#12345"`,
+		`<input>:6:45: node 'A': invalid :weight: expected number, got "heavy"`,
+		`<input>:8:14: edge 0: invalid :stroke: expected color, got (1 2)`,
+	}
+	errors := validator.GetErrors()
+	if len(errors) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(expected), len(errors), errors)
+	}
+	for i, err := range errors {
+		if !strings.HasPrefix(err.Error(), expected[i]) {
+			t.Errorf("Expected error %q, got %q", expected[i], err.Error())
+		}
+	}
+}
+
+// TestValidatorUnknownAttributes tests that attribute names are checked
+// against the registry
+func TestValidatorUnknownAttributes(t *testing.T) {
+	input := `(diagram
+  (node-style :colour "red")
+  (edge-style :shape "ellipse")
+  (defclass "c" :strok "blue")
+  (group "g" :font-size 12
+    (nodes
+      (id "A" :dir "back")))
+  (edges
+    ("A" "A" :lable "x")))`
+
+	diagram := ParseTestInput(t, input)
+	validator := NewValidator()
+	if err := validator.Validate(diagram); err == nil {
+		t.Fatalf("Expected validation to fail")
+	}
+
+	expected := []string{
+		`<input>:2:15: node-style: unknown attribute :colour (did you mean :color?)`,
+		`<input>:3:15: edge-style: :shape does not apply to edges, only to nodes`,
+		`<input>:4:17: class 'c': unknown attribute :strok (did you mean :stroke?)`,
+		`<input>:5:14: group 'g': :font-size does not apply to groups, only to nodes or edges`,
+		`<input>:7:15: node 'A': :dir does not apply to nodes, only to edges`,
+		`<input>:9:14: edge 0: unknown attribute :lable (did you mean :label?)`,
+	}
+	errors := validator.GetErrors()
+	if len(errors) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(expected), len(errors), errors)
+	}
+	for i, err := range errors {
+		if !strings.HasPrefix(err.Error(), expected[i]) {
+			t.Errorf("Expected error %q, got %q", expected[i], err.Error())
+		}
+	}
+}
+
+// TestValidatorEdgeDirections tests that :dir values are checked
+func TestValidatorEdgeDirections(t *testing.T) {
+	input := `(diagram
+  (edge-style :dir "sideways")
+  (defclass "odd" :dir "up")
+  (nodes (id "A") (id "B"))
+  (edges
+    ("A" "B" :dir "none")
+    ("A" "B" :dir "reverse")))`
+
+	diagram := ParseTestInput(t, input)
+	validator := NewValidator()
+	if err := validator.Validate(diagram); err == nil {
+		t.Fatalf("Expected validation to fail")
+	}
+
+	expected := []string{
+		"<input>:2:15: edge-style: invalid dir 'sideways'",
+		"<input>:3:19: class 'odd': invalid dir 'up'",
+		"<input>:7:14: edge 1: invalid dir 'reverse'",
+	}
+	errors := validator.GetErrors()
+	if len(errors) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(expected), len(errors), errors)
+	}
+	for i, err := range errors {
+		if !strings.HasPrefix(err.Error(), expected[i]) {
+			t.Errorf("Expected error %q, got %q", expected[i], err.Error())
+		}
+	}
+}
+
+// TestValidatorAllowedValues tests that attributes with a fixed set of
+// values are checked wherever they are set
+func TestValidatorAllowedValues(t *testing.T) {
+	input := `(diagram
+  (node-style :shape "triangle")
+  (edge-style :style "wavy")
+  (nodes (id "A") (id "B"))
+  (edges ("A" "B")))`
+
+	diagram := ParseTestInput(t, input)
+	validator := NewValidator()
+	if err := validator.Validate(diagram); err == nil {
+		t.Fatalf("Expected validation to fail")
+	}
+
+	expected := []string{
+		"<input>:2:15: node-style: invalid shape 'triangle'",
+		"<input>:3:15: edge-style: invalid style 'wavy'",
+	}
+	errors := validator.GetErrors()
+	if len(errors) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(expected), len(errors), errors)
+	}
+	for i, err := range errors {
+		if errors[i].Code != CodeInvalidValue || !strings.HasPrefix(err.Error(), expected[i]) {
+			t.Errorf("Expected error %q, got %s %q", expected[i], errors[i].Code, err.Error())
+		}
+	}
+}
+
+// TestValidatorPorts tests that ports are checked against their nodes
+func TestValidatorPorts(t *testing.T) {
+	input := `(diagram
+  (defclass "record" :ports ("id" "name"))
+  (nodes
+    (id "table" :class "record")
+    (id "bad" :ports ("n" "a" "a"))
+    (id "db"))
+  (group "g" (nodes (id "member")))
+  (edges
+    ("db:north" "table:name")
+    ("db:southwest" "g:e")
+    ("db" "table:email")
+    ("db" "g" :to-port "top")))`
+
+	diagram := ParseTestInput(t, input)
+	validator := NewValidator()
+	if err := validator.Validate(diagram); err == nil {
+		t.Fatalf("Expected validation to fail")
+	}
+
+	expected := []string{
+		"<input>:5:15: node 'bad': port 'n' conflicts with a compass point",
+		"<input>:5:15: node 'bad': duplicate port 'a'",
+		"<input>:11:5: edge 2: node 'table' has no port 'email'",
+		"<input>:12:15: edge 3: group 'g' has only compass ports, got 'top'",
+	}
+	errors := validator.GetErrors()
+	if len(errors) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(expected), len(errors), errors)
+	}
+	for i, err := range errors {
+		if !strings.HasPrefix(err.Error(), expected[i]) {
+			t.Errorf("Expected error %q, got %q", expected[i], err.Error())
+		}
+	}
+}
+
+// TestValidatorLabelMarkup tests errors for invalid span attributes in labels
+func TestValidatorLabelMarkup(t *testing.T) {
+	input := `(diagram
+  (group "g" :label "[VPC]{size=0}" (nodes (id "a" :label "**ok** [x]{colour=red}")))
+  (nodes (id "b"))
+  (edges ("a" "b" :label "[y]{color=notacolor!}")))`
+
+	diagram := ParseTestInput(t, input)
+	validator := NewValidator()
+	if err := validator.Validate(diagram); err == nil {
+		t.Fatalf("Expected validation to fail")
+	}
+
+	expected := []string{
+		"<input>:2:52: node 'a': invalid label markup: unknown span attribute 'colour'",
+		"<input>:4:19: edge 0: invalid label markup: invalid color 'notacolor!'",
+		"<input>:2:14: group 'g': invalid label markup: invalid size '0'",
+	}
+	errors := validator.GetErrors()
+	if len(errors) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(expected), len(errors), errors)
+	}
+	for i, err := range errors {
+		if !strings.HasPrefix(err.Error(), expected[i]) {
+			t.Errorf("Expected error %q, got %q", expected[i], err.Error())
+		}
+	}
+}